@@ -4,3 +4,50 @@ resource "google_firestore_database" "default" {
   type        = "FIRESTORE_NATIVE"
   depends_on  = [google_project_service.enabled]
 }
+
+# triage-go: open incidents sharing a key and active within the correlation window
+resource "google_firestore_index" "incidents_correlation" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "incidents"
+
+  fields {
+    field_path = "status"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path   = "keys"
+    array_config = "CONTAINS"
+  }
+  fields {
+    field_path = "last_seen"
+    order      = "ASCENDING"
+  }
+}
+
+# triage-go: open incidents idle past the correlation window, to close them
+resource "google_firestore_index" "incidents_idle" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "incidents"
+
+  fields {
+    field_path = "status"
+    order      = "ASCENDING"
+  }
+  fields {
+    field_path = "updated"
+    order      = "ASCENDING"
+  }
+}
+
+# triage-go: markers for events already folded into an alert; kept only long
+# enough to recognise Pub/Sub redeliveries
+resource "google_firestore_field" "folded_events_ttl" {
+  project    = var.project_id
+  database   = google_firestore_database.default.name
+  collection = "folded_events"
+  field      = "expire_at"
+
+  ttl_config {}
+}
@@ -75,3 +75,20 @@ resource "google_project_iam_member" "ui_bindings" {
   role     = each.key
   member   = "serviceAccount:${google_service_account.ui.email}"
 }
+
+# Live remediation (opt-in): key disable, bucket IAM, instance tags + firewall rules
+locals {
+  actions_live_roles = var.actions_live_remediation ? toset([
+    "roles/iam.serviceAccountKeyAdmin",
+    "roles/storage.admin",
+    "roles/compute.instanceAdmin.v1",
+    "roles/compute.securityAdmin",
+  ]) : toset([])
+}
+
+resource "google_project_iam_member" "actions_live_bindings" {
+  for_each = local.actions_live_roles
+  project  = var.project_id
+  role     = each.key
+  member   = "serviceAccount:${google_service_account.actions.email}"
+}
@@ -14,3 +14,9 @@ variable "firestore_location" {
   type        = string
   default     = "nam5"
 }
+
+variable "actions_live_remediation" {
+  description = "Grant actions-sa the roles live executors need (EXECUTOR_MODE=live)"
+  type        = bool
+  default     = false
+}
@@ -0,0 +1,213 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+// What happens to an action still awaiting approval at its deadline.
+const (
+	OnExpiryAutoExecute = "auto_execute"
+	OnExpiryAutoReject  = "auto_reject"
+	OnExpiryLeaveOpen   = "leave_open"
+)
+
+var (
+	ErrSelfApproval    = errors.New("separation of duties: approver may not approve this action")
+	ErrNotApprover     = errors.New("approver is not in an allowed group")
+	ErrAlreadyApproved = errors.New("approver has already approved this action")
+)
+
+// Approval is one approver's sign-off, stored on the action document.
+type Approval struct {
+	By      string    `json:"by" firestore:"by"`
+	Comment string    `json:"comment,omitempty" firestore:"comment"`
+	At      time.Time `json:"at" firestore:"at"`
+}
+
+// Policy says who may approve an action type and how many must.
+type Policy struct {
+	Action           string   `json:"action"` // proposed action, "*" for the fallback
+	Required         int      `json:"required"`
+	Groups           []string `json:"groups,omitempty"` // empty: anyone may approve
+	ExcludeRequester bool     `json:"exclude_requester"`
+	ExcludePrincipal bool     `json:"exclude_principal"` // the event's principal
+
+	// Timers, measured from when the action was proposed. Zero disables.
+	Deadline      shared.Duration `json:"deadline,omitempty"`
+	EscalateEvery shared.Duration `json:"escalate_every,omitempty"`
+	OnExpiry      string          `json:"on_expiry,omitempty"` // default leave_open
+}
+
+// Config is the approval policy file (APPROVAL_POLICIES): policies plus the
+// approver directory mapping group names to member identities, and Slack
+// user ids to the identities they approve as from Slack buttons.
+type Config struct {
+	Policies   []Policy            `json:"policies"`
+	Groups     map[string][]string `json:"groups"`
+	SlackUsers map[string]string   `json:"slack_users,omitempty"`
+}
+
+// DefaultConfig requires two approvers for IAM reverts and one otherwise,
+// never the requester or the acting principal. Requests are re-announced
+// hourly and left open at the deadline.
+func DefaultConfig() Config {
+	return Config{
+		Policies: []Policy{
+			{Action: "revert_iam_binding", Required: 2, ExcludeRequester: true, ExcludePrincipal: true,
+				Deadline: shared.Duration(4 * time.Hour), EscalateEvery: shared.Duration(time.Hour), OnExpiry: OnExpiryLeaveOpen},
+			{Action: "*", Required: 1, ExcludeRequester: true, ExcludePrincipal: true,
+				Deadline: shared.Duration(24 * time.Hour), EscalateEvery: shared.Duration(4 * time.Hour), OnExpiry: OnExpiryLeaveOpen},
+		},
+	}
+}
+
+// LoadConfig reads and validates a policy file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, p := range c.Policies {
+		if p.Action == "" {
+			return Config{}, fmt.Errorf("policy: action is required")
+		}
+		if p.Required < 1 {
+			return Config{}, fmt.Errorf("policy %s: required must be at least 1", p.Action)
+		}
+		switch p.OnExpiry {
+		case "", OnExpiryAutoExecute, OnExpiryAutoReject, OnExpiryLeaveOpen:
+		default:
+			return Config{}, fmt.Errorf("policy %s: unknown on_expiry %q", p.Action, p.OnExpiry)
+		}
+		if p.Deadline < 0 || p.EscalateEvery < 0 {
+			return Config{}, fmt.Errorf("policy %s: timers must not be negative", p.Action)
+		}
+		for _, g := range p.Groups {
+			if _, ok := c.Groups[g]; !ok {
+				return Config{}, fmt.Errorf("policy %s: unknown group %q", p.Action, g)
+			}
+		}
+	}
+	return c, nil
+}
+
+// For returns the policy for action, falling back to "*" and then to a
+// single approver with no restrictions.
+func (c Config) For(action string) Policy {
+	var fallback *Policy
+	for i := range c.Policies {
+		switch c.Policies[i].Action {
+		case action:
+			return c.Policies[i]
+		case "*":
+			fallback = &c.Policies[i]
+		}
+	}
+	if fallback != nil {
+		p := *fallback
+		p.Action = action
+		return p
+	}
+	return Policy{Action: action, Required: 1}
+}
+
+// Check reports whether approver may add an approval to an action requested
+// by requester about principal, given the approvals so far.
+func (c Config) Check(p Policy, approver, requester, principal string, prior []Approval) error {
+	if p.ExcludeRequester && sameID(approver, requester) {
+		return ErrSelfApproval
+	}
+	if p.ExcludePrincipal && sameID(approver, principal) {
+		return ErrSelfApproval
+	}
+	if len(p.Groups) > 0 && !c.member(approver, p.Groups) {
+		return ErrNotApprover
+	}
+	for _, a := range prior {
+		if sameID(a.By, approver) {
+			return ErrAlreadyApproved
+		}
+	}
+	return nil
+}
+
+// Expiry returns the policy's on-expiry behavior, defaulting to leave_open.
+func (p Policy) Expiry() string {
+	if p.OnExpiry == "" {
+		return OnExpiryLeaveOpen
+	}
+	return p.OnExpiry
+}
+
+// DeadlineFrom returns when an action proposed at t expires, or nil.
+func (p Policy) DeadlineFrom(t time.Time) *time.Time {
+	if p.Deadline <= 0 {
+		return nil
+	}
+	d := t.Add(time.Duration(p.Deadline))
+	return &d
+}
+
+// NextEscalation returns when to re-announce after last, or nil when the
+// policy does not escalate or the next one would fall past the deadline.
+func (p Policy) NextEscalation(last time.Time, deadline *time.Time) *time.Time {
+	if p.EscalateEvery <= 0 {
+		return nil
+	}
+	n := last.Add(time.Duration(p.EscalateEvery))
+	if deadline != nil && !n.Before(*deadline) {
+		return nil
+	}
+	return &n
+}
+
+// Met reports whether approvals satisfy the policy's quorum.
+func (p Policy) Met(approvals []Approval) bool {
+	return len(approvals) >= p.Required
+}
+
+// SlackIdentity returns the approver identity of a Slack user, if mapped.
+func (c Config) SlackIdentity(userID string) (string, bool) {
+	id := strings.TrimSpace(c.SlackUsers[userID])
+	return id, id != ""
+}
+
+func (c Config) member(id string, groups []string) bool {
+	for _, g := range groups {
+		if slices.ContainsFunc(c.Groups[g], func(m string) bool { return sameID(m, id) }) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameID(a, b string) bool {
+	a = Identity(a)
+	return a != "" && a == Identity(b)
+}
+
+// Identity normalizes an identity for comparison: trimmed, lower-cased and
+// without an IAM member prefix, so "user:Alice@example.com" (as an event's
+// principal or a directory entry) and "alice@example.com" (an approver) are
+// the same person.
+func Identity(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, prefix := range []string{"user:", "serviceaccount:", "group:", "accounts.google.com:"} {
+		if rest, ok := strings.CutPrefix(id, prefix); ok {
+			return rest
+		}
+	}
+	return id
+}
@@ -0,0 +1,60 @@
+package approval
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckNormalizesMemberPrefixes(t *testing.T) {
+	c := Config{Groups: map[string][]string{"secops": {"user:Bob@example.com", "carol@example.com"}}}
+	p := Policy{Action: "revert_iam_binding", Required: 2, Groups: []string{"secops"}, ExcludeRequester: true, ExcludePrincipal: true}
+
+	tests := []struct {
+		name      string
+		approver  string
+		requester string
+		principal string
+		prior     []Approval
+		want      error
+	}{
+		{name: "principal as IAM member", approver: "carol@example.com", principal: "user:Carol@Example.com", want: ErrSelfApproval},
+		{name: "service account principal", approver: "serviceAccount:carol@example.com", principal: "carol@example.com", want: ErrSelfApproval},
+		{name: "requester with prefix", approver: "bob@example.com", requester: "user:bob@example.com", want: ErrSelfApproval},
+		{name: "directory entry with prefix", approver: "BOB@example.com", principal: "user:mallory@example.com"},
+		{name: "not in group", approver: "user:dave@example.com", want: ErrNotApprover},
+		{name: "prior approval under another form", approver: "user:bob@example.com",
+			prior: []Approval{{By: "bob@example.com"}}, want: ErrAlreadyApproved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Check(p, tt.approver, tt.requester, tt.principal, tt.prior); !errors.Is(err, tt.want) {
+				t.Fatalf("Check(%q) = %v, want %v", tt.approver, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuorumCountsDistinctApprovers(t *testing.T) {
+	c := Config{}
+	p := c.For("revert_iam_binding")
+	p.Required = 2
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var approvals []Approval
+	for _, by := range []string{"bob@example.com", "user:Bob@example.com", "carol@example.com"} {
+		if err := c.Check(p, by, "triage-go", "user:mallory@example.com", approvals); err != nil {
+			if !errors.Is(err, ErrAlreadyApproved) {
+				t.Fatalf("Check(%q) = %v", by, err)
+			}
+			continue
+		}
+		approvals = append(approvals, Approval{By: by, At: now})
+		if len(approvals) == 1 && p.Met(approvals) {
+			t.Fatalf("quorum met with one approval")
+		}
+	}
+	if len(approvals) != 2 || !p.Met(approvals) {
+		t.Fatalf("approvals = %+v, met = %v; want two distinct approvers meeting quorum", approvals, p.Met(approvals))
+	}
+}
@@ -0,0 +1,237 @@
+package baseline
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+// maxEntries caps each histogram so a busy principal cannot grow unbounded.
+const maxEntries = 200
+
+// maxRecent is how many of the latest event IDs a profile remembers to
+// recognise Pub/Sub redeliveries.
+const maxRecent = 100
+
+// Signal weights; the total is capped at 1.
+const (
+	weightNewEventType = 0.4
+	weightNewNetwork   = 0.3
+	weightOffHours     = 0.2
+	weightNewPeer      = 0.2
+)
+
+// offHoursShare is the share of past activity below which an hour counts as unusual.
+const offHoursShare = 0.05
+
+// Profile is the learned behavior of one principal or target.
+type Profile struct {
+	Key        string         `firestore:"key"` // principal:<p> | target:<t>
+	Total      int            `firestore:"total"`
+	EventTypes map[string]int `firestore:"event_types"`
+	Hours      []int          `firestore:"hours"` // 24 buckets, UTC
+	Networks   map[string]int `firestore:"networks"`
+	Peers      map[string]int `firestore:"peers"` // targets for a principal, principals for a target
+	Recent     []string       `firestore:"recent_event_ids"`
+	FirstSeen  time.Time      `firestore:"first_seen"`
+	LastSeen   time.Time      `firestore:"last_seen"`
+	Updated    time.Time      `firestore:"updated"`
+}
+
+// Anomaly is the deviation signal attached to a triage result.
+type Anomaly struct {
+	Score   float64  `json:"score" firestore:"score"`
+	Reasons []string `json:"reasons,omitempty" firestore:"reasons"`
+}
+
+// PrincipalKey and TargetKey name the two profiles an event touches.
+func PrincipalKey(ev shared.Event) string { return key("principal", ev.Principal) }
+func TargetKey(ev shared.Event) string    { return key("target", ev.Target) }
+
+func key(kind, v string) string {
+	if v == "" {
+		return ""
+	}
+	return kind + ":" + v
+}
+
+// DocID derives a Firestore-safe document ID for a profile key.
+func DocID(key string) string {
+	h := sha1.Sum([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// New returns an empty profile for key.
+func New(key string) *Profile {
+	return &Profile{
+		Key:        key,
+		EventTypes: map[string]int{},
+		Hours:      make([]int, 24),
+		Networks:   map[string]int{},
+		Peers:      map[string]int{},
+	}
+}
+
+// Score rates how unusual ev is for the profile (0..1). Profiles with fewer
+// than minEvents observations are still warming up and score 0.
+func (p *Profile) Score(ev shared.Event, ts time.Time, minEvents int) Anomaly {
+	var a Anomaly
+	if p == nil || p.Total < minEvents {
+		return a
+	}
+	kind := p.Key[:strings.IndexByte(p.Key, ':')]
+
+	if p.EventTypes[ev.EventType] == 0 {
+		a.add(weightNewEventType, kind+":new_event_type")
+	}
+	if n := networkBucket(ev.Network); n != "" && p.Networks[n] == 0 {
+		a.add(weightNewNetwork, kind+":new_network")
+	}
+	if h := ts.UTC().Hour(); float64(p.hourActivity(h)) < offHoursShare*float64(p.Total) {
+		a.add(weightOffHours, kind+":off_hours")
+	}
+	if peer := p.peerOf(ev); peer != "" && p.Peers[peer] == 0 {
+		if kind == "principal" {
+			a.add(weightNewPeer, kind+":new_target")
+		} else {
+			a.add(weightNewPeer, kind+":new_principal")
+		}
+	}
+	return a
+}
+
+// Observe folds ev into the profile and reports whether it did. An event
+// already observed (same ID among the recent ones) is a redelivery and is
+// not counted again.
+func (p *Profile) Observe(ev shared.Event, ts time.Time) bool {
+	if ev.ID != "" {
+		if slices.Contains(p.Recent, ev.ID) {
+			return false
+		}
+		p.Recent = append(p.Recent, ev.ID)
+		if len(p.Recent) > maxRecent {
+			p.Recent = slices.Clone(p.Recent[len(p.Recent)-maxRecent:])
+		}
+	}
+	p.normalize()
+	p.Total++
+	bump(p.EventTypes, ev.EventType)
+	bump(p.Networks, networkBucket(ev.Network))
+	bump(p.Peers, p.peerOf(ev))
+	p.Hours[ts.UTC().Hour()]++
+	if p.FirstSeen.IsZero() || ts.Before(p.FirstSeen) {
+		p.FirstSeen = ts
+	}
+	if ts.After(p.LastSeen) {
+		p.LastSeen = ts
+	}
+	return true
+}
+
+// Combine merges per-profile anomalies, keeping the strongest score and all reasons.
+func Combine(as ...Anomaly) Anomaly {
+	var out Anomaly
+	for _, a := range as {
+		if a.Score > out.Score {
+			out.Score = a.Score
+		}
+		out.Reasons = append(out.Reasons, a.Reasons...)
+	}
+	return out
+}
+
+func (a *Anomaly) add(w float64, reason string) {
+	a.Score += w
+	if a.Score > 1 {
+		a.Score = 1
+	}
+	a.Reasons = append(a.Reasons, reason)
+}
+
+// hourActivity counts activity in hour h and its neighbors, so a shift by an
+// hour is not flagged.
+func (p *Profile) hourActivity(h int) int {
+	if len(p.Hours) != 24 {
+		return 0
+	}
+	return p.Hours[(h+23)%24] + p.Hours[h] + p.Hours[(h+1)%24]
+}
+
+func (p *Profile) peerOf(ev shared.Event) string {
+	if strings.HasPrefix(p.Key, "principal:") {
+		return ev.Target
+	}
+	return ev.Principal
+}
+
+// normalize fills maps that come back nil from Firestore.
+func (p *Profile) normalize() {
+	if p.EventTypes == nil {
+		p.EventTypes = map[string]int{}
+	}
+	if p.Networks == nil {
+		p.Networks = map[string]int{}
+	}
+	if p.Peers == nil {
+		p.Peers = map[string]int{}
+	}
+	if len(p.Hours) != 24 {
+		p.Hours = make([]int, 24)
+	}
+}
+
+// networkBucket groups addresses by /24 (IPv4) or /48 (IPv6) so single-host
+// CIDRs from the same range count as one source network.
+func networkBucket(network string) string {
+	network = strings.TrimSpace(network)
+	if network == "" {
+		return ""
+	}
+	var addr netip.Addr
+	if p, err := netip.ParsePrefix(network); err == nil {
+		addr = p.Addr()
+	} else if a, err := netip.ParseAddr(network); err == nil {
+		addr = a
+	} else {
+		return network
+	}
+	bits := 24
+	if !addr.Is4() {
+		bits = 48
+	}
+	p, _ := addr.Prefix(bits)
+	return p.String()
+}
+
+func bump(m map[string]int, k string) {
+	if k == "" {
+		return
+	}
+	m[k]++
+	if len(m) <= maxEntries {
+		return
+	}
+	// evict the rarest entry (ties broken by key for determinism)
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] < m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		if key != k {
+			delete(m, key)
+			return
+		}
+	}
+}
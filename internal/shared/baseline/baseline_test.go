@@ -0,0 +1,33 @@
+package baseline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+func TestObserveSkipsRedeliveredEvents(t *testing.T) {
+	p := New("principal:alice")
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ev := shared.Event{ID: "e1", EventType: "a", Principal: "alice", Target: "t"}
+	if !p.Observe(ev, ts) {
+		t.Fatal("first delivery not observed")
+	}
+	if p.Observe(ev, ts) {
+		t.Fatal("redelivery observed")
+	}
+	if p.Total != 1 || p.EventTypes["a"] != 1 || p.Peers["t"] != 1 {
+		t.Fatalf("counted twice: %+v", p)
+	}
+
+	for i := range maxRecent {
+		p.Observe(shared.Event{ID: string(rune('A' + i)), EventType: "a"}, ts)
+	}
+	if len(p.Recent) != maxRecent {
+		t.Fatalf("recent ids = %d, want %d", len(p.Recent), maxRecent)
+	}
+	if !p.Observe(ev, ts) {
+		t.Fatal("event forgotten past maxRecent not observed again")
+	}
+}
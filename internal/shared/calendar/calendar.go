@@ -0,0 +1,213 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+// Entry kinds.
+const (
+	KindWindow = "window" // changes are expected: a maintenance or change window
+	KindFreeze = "freeze" // no disruptive changes
+)
+
+// What actions-go does with a disruptive automated action during a freeze.
+const (
+	OnFreezeDefer           = "defer"            // queue it to run when the freeze ends
+	OnFreezeRequireApproval = "require_approval" // hold it for a human
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Entry is a recurring or one-off window or freeze. A recurring entry
+// starts at Start (local time in TimeZone) on each of Days and lasts
+// Duration, so it may run past midnight or over a weekend. A one-off entry
+// covers [From, Until).
+type Entry struct {
+	Name     string          `json:"name"`
+	Kind     string          `json:"kind"`
+	Projects []string        `json:"projects,omitempty"`  // empty: every project
+	TimeZone string          `json:"time_zone,omitempty"` // IANA name, default UTC
+	Days     []string        `json:"days,omitempty"`      // recurring: mon..sun, empty for every day
+	Start    string          `json:"start,omitempty"`     // recurring: "15:04"
+	Duration shared.Duration `json:"duration,omitempty"`  // recurring
+	From     *time.Time      `json:"from,omitempty"`      // one-off
+	Until    *time.Time      `json:"until,omitempty"`     // one-off
+	OnFreeze string          `json:"on_freeze,omitempty"` // freezes: overrides Config.OnFreeze
+
+	loc   *time.Location
+	clock time.Time // Start parsed
+}
+
+// Config is the calendar file (CALENDAR_FILE).
+type Config struct {
+	Entries    []Entry  `json:"entries"`
+	Disruptive []string `json:"disruptive,omitempty"` // actions freezes gate; "*" for all
+	OnFreeze   string   `json:"on_freeze,omitempty"`  // default defer
+}
+
+// DefaultConfig has no windows or freezes; VM isolation and bucket policy
+// reverts count as disruptive once a calendar defines freezes.
+func DefaultConfig() Config {
+	return Config{Disruptive: []string{"isolate_vm_nic", "revert_bucket_policy"}, OnFreeze: OnFreezeDefer}
+}
+
+// LoadConfig reads and validates a calendar file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	c := DefaultConfig()
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if err := validFreezePolicy(c.OnFreeze); err != nil {
+		return Config{}, fmt.Errorf("calendar: %w", err)
+	}
+	for i := range c.Entries {
+		if err := c.Entries[i].compile(); err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
+
+func (e *Entry) compile() error {
+	if e.Name == "" {
+		return fmt.Errorf("calendar entry: name is required")
+	}
+	if e.Kind != KindWindow && e.Kind != KindFreeze {
+		return fmt.Errorf("calendar entry %s: kind must be window or freeze", e.Name)
+	}
+	if e.OnFreeze != "" {
+		if e.Kind != KindFreeze {
+			return fmt.Errorf("calendar entry %s: on_freeze only applies to freezes", e.Name)
+		}
+		if err := validFreezePolicy(e.OnFreeze); err != nil {
+			return fmt.Errorf("calendar entry %s: %w", e.Name, err)
+		}
+	}
+	loc, err := time.LoadLocation(e.TimeZone) // "" is UTC
+	if err != nil {
+		return fmt.Errorf("calendar entry %s: %w", e.Name, err)
+	}
+	e.loc = loc
+
+	oneOff := e.From != nil || e.Until != nil
+	recurring := e.Start != "" || e.Duration != 0 || len(e.Days) > 0
+	switch {
+	case oneOff && recurring:
+		return fmt.Errorf("calendar entry %s: use either from/until or days/start/duration", e.Name)
+	case oneOff:
+		if e.From == nil || e.Until == nil || !e.Until.After(*e.From) {
+			return fmt.Errorf("calendar entry %s: from must be before until", e.Name)
+		}
+	default:
+		if e.clock, err = time.Parse("15:04", e.Start); err != nil {
+			return fmt.Errorf("calendar entry %s: start must be HH:MM", e.Name)
+		}
+		if e.Duration <= 0 {
+			return fmt.Errorf("calendar entry %s: duration must be positive", e.Name)
+		}
+		for _, d := range e.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("calendar entry %s: unknown day %q", e.Name, d)
+			}
+		}
+	}
+	return nil
+}
+
+func validFreezePolicy(p string) error {
+	switch p {
+	case "", OnFreezeDefer, OnFreezeRequireApproval:
+		return nil
+	}
+	return fmt.Errorf("unknown on_freeze %q", p)
+}
+
+// Covers reports whether the entry applies to project.
+func (e Entry) Covers(project string) bool {
+	return len(e.Projects) == 0 || slices.Contains(e.Projects, project)
+}
+
+// Occurrence returns the end of the occurrence of e in effect at t.
+func (e Entry) Occurrence(t time.Time) (end time.Time, ok bool) {
+	if e.From != nil && e.Until != nil {
+		return *e.Until, !t.Before(*e.From) && t.Before(*e.Until)
+	}
+	loc := e.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	d := time.Duration(e.Duration)
+	lt := t.In(loc)
+	// an occurrence started on one of the last few local days
+	for back := 0; back <= int(d/(24*time.Hour))+1; back++ {
+		start := time.Date(lt.Year(), lt.Month(), lt.Day()-back, e.clock.Hour(), e.clock.Minute(), 0, 0, loc)
+		if !e.onDay(start.Weekday()) {
+			continue
+		}
+		if !t.Before(start) && t.Before(start.Add(d)) {
+			return start.Add(d), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (e Entry) onDay(wd time.Weekday) bool {
+	if len(e.Days) == 0 {
+		return true
+	}
+	for _, d := range e.Days {
+		if weekdays[strings.ToLower(d)] == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the entry of kind covering project at t and the end of
+// its occurrence. When several overlap, the one ending last wins.
+func (c Config) Active(kind, project string, t time.Time) (Entry, time.Time, bool) {
+	var (
+		best  Entry
+		until time.Time
+		found bool
+	)
+	for _, e := range c.Entries {
+		if e.Kind != kind || !e.Covers(project) {
+			continue
+		}
+		if end, ok := e.Occurrence(t); ok && (!found || end.After(until)) {
+			best, until, found = e, end, true
+		}
+	}
+	return best, until, found
+}
+
+// IsDisruptive reports whether freezes gate action.
+func (c Config) IsDisruptive(action string) bool {
+	return slices.Contains(c.Disruptive, "*") || slices.Contains(c.Disruptive, action)
+}
+
+// FreezePolicy is what to do with a disruptive action during freeze e.
+func (c Config) FreezePolicy(e Entry) string {
+	switch {
+	case e.OnFreeze != "":
+		return e.OnFreeze
+	case c.OnFreeze != "":
+		return c.OnFreeze
+	}
+	return OnFreezeDefer
+}
@@ -0,0 +1,109 @@
+package correlate
+
+import (
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+// Incident groups alerts that share a principal or target within a window.
+type Incident struct {
+	IncidentID string          `json:"incident_id" firestore:"incident_id"`
+	Keys       []string        `json:"keys" firestore:"keys"` // principal:<p>, target:<t>
+	AlertIDs   []string        `json:"alert_ids" firestore:"alert_ids"`
+	EventTypes []string        `json:"event_types" firestore:"event_types"`
+	Severity   shared.Severity `json:"severity" firestore:"severity"`
+	Status     string          `json:"status" firestore:"status"`
+	FirstSeen  time.Time       `json:"first_seen" firestore:"first_seen"`
+	LastSeen   time.Time       `json:"last_seen" firestore:"last_seen"`
+	Created    time.Time       `json:"created" firestore:"created"`
+	Updated    time.Time       `json:"updated" firestore:"updated"`
+}
+
+// Keys returns the correlation keys for an event.
+func Keys(ev shared.Event) []string {
+	var keys []string
+	if ev.Principal != "" {
+		keys = append(keys, "principal:"+ev.Principal)
+	}
+	if ev.Target != "" {
+		keys = append(keys, "target:"+ev.Target)
+	}
+	return keys
+}
+
+// Covers reports whether an event at ts with the given keys belongs in the
+// incident: it must be open, share a key, and fall within window of the
+// incident's first/last sighting (sliding).
+func (inc *Incident) Covers(keys []string, ts time.Time, window time.Duration) bool {
+	if inc.Status != StatusOpen {
+		return false
+	}
+	if ts.Before(inc.FirstSeen.Add(-window)) || ts.After(inc.LastSeen.Add(window)) {
+		return false
+	}
+	for _, k := range keys {
+		if contains(inc.Keys, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Idle reports whether the incident is open but nothing has joined it for
+// more than window before now. It goes by Updated, the wall-clock time of
+// the last join, not the event-time LastSeen, so an incident opened by a
+// late or backfilled event is not closed as soon as it opens.
+func (inc *Incident) Idle(now time.Time, window time.Duration) bool {
+	return inc.Status == StatusOpen && now.After(inc.Updated.Add(window))
+}
+
+// Add folds an alert into the incident, rolling severity up to the max.
+func (inc *Incident) Add(alertID, eventType string, keys []string, sev shared.Severity, ts time.Time) {
+	if !contains(inc.AlertIDs, alertID) {
+		inc.AlertIDs = append(inc.AlertIDs, alertID)
+	}
+	if eventType != "" && !contains(inc.EventTypes, eventType) {
+		inc.EventTypes = append(inc.EventTypes, eventType)
+	}
+	for _, k := range keys {
+		if !contains(inc.Keys, k) {
+			inc.Keys = append(inc.Keys, k)
+		}
+	}
+	inc.Severity = shared.MaxSeverity(inc.Severity, sev)
+	if inc.FirstSeen.IsZero() || ts.Before(inc.FirstSeen) {
+		inc.FirstSeen = ts
+	}
+	if ts.After(inc.LastSeen) {
+		inc.LastSeen = ts
+	}
+}
+
+// Pick returns the most recently active candidate that covers the event, or nil.
+func Pick(cands []*Incident, keys []string, ts time.Time, window time.Duration) *Incident {
+	var best *Incident
+	for _, c := range cands {
+		if !c.Covers(keys, ts, window) {
+			continue
+		}
+		if best == nil || c.LastSeen.After(best.LastSeen) {
+			best = c
+		}
+	}
+	return best
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package detect
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// maxHits bounds per-key state so a noisy key cannot grow a document forever.
+const maxHits = 500
+
+// Duration is kept as an alias so rule files and callers need not change.
+type Duration = shared.Duration
+
+// Config is the detections file (DETECTIONS_FILE).
+type Config struct {
+	Thresholds []Threshold `json:"thresholds"`
+	Sequences  []Sequence  `json:"sequences"`
+}
+
+// DefaultConfig covers the bulk-delete scenario when no file is given.
+func DefaultConfig() Config {
+	return Config{
+		Thresholds: []Threshold{{
+			Name:      "mass_deletes_storage",
+			EventType: "storage.objects.delete.bulk",
+			KeyBy:     "principal",
+			Window:    Duration(10 * time.Minute),
+			Mode:      ModeSliding,
+			Threshold: 3,
+			Severity:  shared.SeverityHigh,
+		}},
+		Sequences: []Sequence{{
+			Name:     "owner_grant_key_then_deletes",
+			KeyBy:    "principal",
+			Within:   Duration(30 * time.Minute),
+			Severity: shared.SeverityHigh,
+			Steps: []Step{
+				{EventType: "iam.setIamPolicy.bindingAdd", When: []match.Cond{{Field: "description", Op: "contains", Value: "roles/owner"}}},
+				{EventType: "iam.serviceAccountKeys.create"},
+				{EventType: "storage.objects.delete.bulk"},
+			},
+		}},
+	}
+}
+
+// LoadConfig reads and validates a detections file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for i := range c.Thresholds {
+		if err := c.Thresholds[i].validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	for i := range c.Sequences {
+		if err := c.Sequences[i].validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
+
+// Firing describes a detection that tripped; it is stored on the synthetic alert.
+type Firing struct {
+	Rule     string    `json:"rule" firestore:"rule"`
+	Kind     string    `json:"kind" firestore:"kind"` // threshold | sequence
+	KeyBy    string    `json:"key_by" firestore:"key_by"`
+	Key      string    `json:"key" firestore:"key"`
+	Count    int       `json:"count" firestore:"count"`
+	EventIDs []string  `json:"event_ids" firestore:"event_ids"`
+	At       time.Time `json:"at" firestore:"at"`
+}
+
+// StateID derives a Firestore-safe document ID for a rule/key pair.
+func StateID(rule, key string) string {
+	h := sha1.Sum([]byte(rule + "|" + key))
+	return hex.EncodeToString(h[:])
+}
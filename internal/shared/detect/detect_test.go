@@ -0,0 +1,103 @@
+package detect
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+func TestThresholdIgnoresRedeliveredEvents(t *testing.T) {
+	rule := Threshold{Name: "deletes", KeyBy: "principal", Window: Duration(10 * time.Minute), Mode: ModeSliding, Threshold: 3}
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	st := &WindowState{Rule: rule.Name, Key: "alice"}
+
+	for i, id := range []string{"e1", "e2", "e2", "e1"} {
+		ev := shared.Event{ID: id, Principal: "alice"}
+		if _, fired := rule.Observe(st, ev, t0.Add(time.Duration(i)*time.Minute)); fired {
+			t.Fatalf("event %d (%s): fired on %d distinct events", i, id, len(st.Hits))
+		}
+	}
+	if len(st.Hits) != 2 {
+		t.Fatalf("hits = %d, want 2", len(st.Hits))
+	}
+	f, fired := rule.Observe(st, shared.Event{ID: "e3", Principal: "alice"}, t0.Add(5*time.Minute))
+	if !fired || f.Count != 3 {
+		t.Fatalf("third distinct event: fired=%v firing=%+v", fired, f)
+	}
+}
+
+func TestSequenceTracksOverlappingPartials(t *testing.T) {
+	seq := Sequence{
+		Name:   "grant_then_key",
+		KeyBy:  "principal",
+		Within: Duration(30 * time.Minute),
+		Steps:  []Step{{EventType: "binding"}, {EventType: "key"}, {EventType: "delete"}},
+	}
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		id, typ string
+		at      time.Duration
+	}
+	tests := []struct {
+		name   string
+		events []step
+		want   []string // event ids of the firing; nil: no firing
+	}{
+		{
+			name:   "simple",
+			events: []step{{"b1", "binding", 0}, {"k1", "key", time.Minute}, {"d1", "delete", 2 * time.Minute}},
+			want:   []string{"b1", "k1", "d1"},
+		},
+		{
+			name:   "budget lapsed",
+			events: []step{{"b1", "binding", 0}, {"k1", "key", 20 * time.Minute}, {"d1", "delete", 31 * time.Minute}},
+		},
+		{
+			name: "newer start while older partial waits",
+			events: []step{
+				{"b1", "binding", 0}, {"b2", "binding", 29 * time.Minute},
+				{"k1", "key", 31 * time.Minute}, {"d1", "delete", 40 * time.Minute},
+			},
+			want: []string{"b2", "k1", "d1"},
+		},
+		{
+			name: "older partial ahead, newer one completes later",
+			events: []step{
+				{"b1", "binding", 0}, {"k1", "key", 5 * time.Minute}, {"b2", "binding", 25 * time.Minute},
+				{"k2", "key", 32 * time.Minute}, {"d1", "delete", 40 * time.Minute},
+			},
+			want: []string{"b2", "k2", "d1"},
+		},
+		{
+			name: "redelivered events are not steps",
+			events: []step{
+				{"b1", "binding", 0}, {"b1", "binding", time.Minute}, {"k1", "key", 2 * time.Minute},
+				{"k1", "key", 3 * time.Minute}, {"d1", "delete", 4 * time.Minute},
+			},
+			want: []string{"b1", "k1", "d1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &SeqState{Rule: seq.Name, Key: "alice"}
+			var got []string
+			for _, e := range tt.events {
+				ev := shared.Event{ID: e.id, EventType: e.typ, Principal: "alice"}
+				if f, ok := seq.Advance(st, ev, nil, t0.Add(e.at)); ok {
+					if got != nil {
+						t.Fatalf("fired twice: %v then %v", got, f.EventIDs)
+					}
+					got = f.EventIDs
+				}
+				if len(st.Partials) > len(seq.Steps) {
+					t.Fatalf("%d partials for %d steps", len(st.Partials), len(seq.Steps))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("fired with %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
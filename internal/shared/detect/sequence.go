@@ -0,0 +1,148 @@
+package detect
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Sequence is an ordered multi-step pattern per key that must complete
+// within a time budget measured from its first step.
+type Sequence struct {
+	Name     string          `json:"name"`
+	KeyBy    string          `json:"key_by"`
+	Within   Duration        `json:"within"`
+	Severity shared.Severity `json:"severity"`
+	Steps    []Step          `json:"steps"`
+}
+
+// Step matches one event in the sequence.
+type Step struct {
+	EventType string       `json:"event_type"`
+	When      []match.Cond `json:"when,omitempty"`
+}
+
+// SeqState is the persisted set of partial matches for a sequence/key.
+type SeqState struct {
+	Rule     string    `firestore:"rule"`
+	Key      string    `firestore:"key"`
+	Partials []Partial `firestore:"partials"` // at most one per step, the latest started
+	Updated  time.Time `firestore:"updated"`
+}
+
+// Partial is one sequence in progress.
+type Partial struct {
+	Step     int       `firestore:"step"` // index of the next step to match
+	Started  time.Time `firestore:"started"`
+	EventIDs []string  `firestore:"event_ids"`
+}
+
+func (s Sequence) validate() error {
+	if s.Name == "" || s.KeyBy == "" {
+		return fmt.Errorf("sequence rule needs name and key_by")
+	}
+	if s.Within <= 0 || len(s.Steps) < 2 {
+		return fmt.Errorf("sequence %s: needs a positive within and at least two steps", s.Name)
+	}
+	for _, st := range s.Steps {
+		if err := match.ValidateAll(st.When); err != nil {
+			return fmt.Errorf("sequence %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// StateRule namespaces sequence state apart from thresholds of the same name.
+func (s Sequence) StateRule() string { return "seq:" + s.Name }
+
+// Applies reports whether the event can take part in the sequence at all,
+// returning its key. Cheap pre-check before touching persisted state.
+func (s Sequence) Applies(ev shared.Event) (string, bool) {
+	key := ev.Field(s.KeyBy)
+	if key == "" {
+		return "", false
+	}
+	for _, st := range s.Steps {
+		if st.EventType == "" || st.EventType == ev.EventType {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Advance offers the event to every partial match whose time budget has
+// not lapsed, and starts a new one when it matches the first step, so a
+// fresh start is never lost behind an older partial. Of partials waiting on
+// the same step only the latest started is kept: it has the most budget
+// left, which bounds the state to one partial per step. It returns a firing
+// once a partial completes all steps, dropping that partial.
+func (s Sequence) Advance(st *SeqState, ev shared.Event, f match.Fields, ts time.Time) (*Firing, bool) {
+	var next []Partial
+	var done *Partial
+	for _, p := range st.Partials {
+		if ts.Sub(p.Started) > time.Duration(s.Within) {
+			continue
+		}
+		if slices.Contains(p.EventIDs, ev.ID) || !s.Steps[p.Step].matches(ev, f) {
+			next = append(next, p)
+			continue
+		}
+		p.EventIDs = append(slices.Clone(p.EventIDs), ev.ID)
+		p.Step++
+		if p.Step == len(s.Steps) {
+			if done == nil || p.Started.After(done.Started) {
+				done = &p
+			}
+			continue
+		}
+		next = append(next, p)
+	}
+	if s.Steps[0].matches(ev, f) && !startedBy(st.Partials, ev.ID) {
+		next = append(next, Partial{Step: 1, Started: ts, EventIDs: []string{ev.ID}})
+	}
+	st.Partials = latestPerStep(next)
+
+	if done == nil {
+		return nil, false
+	}
+	return &Firing{
+		Rule:     s.Name,
+		Kind:     "sequence",
+		KeyBy:    s.KeyBy,
+		Key:      st.Key,
+		Count:    len(done.EventIDs),
+		EventIDs: done.EventIDs,
+		At:       ts,
+	}, true
+}
+
+// startedBy reports whether a partial already began with event id, i.e.
+// the event is a redelivery.
+func startedBy(ps []Partial, id string) bool {
+	return slices.ContainsFunc(ps, func(p Partial) bool { return len(p.EventIDs) > 0 && p.EventIDs[0] == id })
+}
+
+func latestPerStep(ps []Partial) []Partial {
+	var out []Partial
+	for _, p := range ps {
+		i := slices.IndexFunc(out, func(q Partial) bool { return q.Step == p.Step })
+		switch {
+		case i < 0:
+			out = append(out, p)
+		case p.Started.After(out[i].Started):
+			out[i] = p
+		}
+	}
+	slices.SortFunc(out, func(a, b Partial) int { return a.Step - b.Step })
+	return out
+}
+
+func (st Step) matches(ev shared.Event, f match.Fields) bool {
+	if st.EventType != "" && st.EventType != ev.EventType {
+		return false
+	}
+	return match.All(st.When, f)
+}
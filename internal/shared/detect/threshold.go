@@ -0,0 +1,146 @@
+package detect
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+const (
+	ModeTumbling = "tumbling"
+	ModeSliding  = "sliding"
+)
+
+// Threshold counts (or distinct-counts) events per key in a window.
+type Threshold struct {
+	Name      string          `json:"name"`
+	EventType string          `json:"event_type"` // empty matches any
+	KeyBy     string          `json:"key_by"`     // event field, e.g. principal | target
+	Distinct  string          `json:"distinct"`   // optional field to distinct-count
+	Window    Duration        `json:"window"`
+	Mode      string          `json:"mode"` // tumbling | sliding
+	Threshold int             `json:"threshold"`
+	Severity  shared.Severity `json:"severity"`
+}
+
+// Hit is one counted event.
+type Hit struct {
+	TS      time.Time `firestore:"ts"`
+	Value   string    `firestore:"value"`
+	EventID string    `firestore:"event_id"`
+}
+
+// WindowState is the persisted per rule/key counter.
+type WindowState struct {
+	Rule        string    `firestore:"rule"`
+	Key         string    `firestore:"key"`
+	WindowStart time.Time `firestore:"window_start"`
+	Hits        []Hit     `firestore:"hits"`
+	FiredAt     time.Time `firestore:"fired_at"`
+	Updated     time.Time `firestore:"updated"`
+}
+
+func (t Threshold) validate() error {
+	if t.Name == "" || t.KeyBy == "" {
+		return fmt.Errorf("threshold rule needs name and key_by")
+	}
+	if t.Window <= 0 || t.Threshold <= 0 {
+		return fmt.Errorf("threshold %s: window and threshold must be positive", t.Name)
+	}
+	if t.Mode != ModeTumbling && t.Mode != ModeSliding {
+		return fmt.Errorf("threshold %s: mode must be tumbling or sliding", t.Name)
+	}
+	return nil
+}
+
+// Applies reports whether the rule counts this event, returning its key.
+func (t Threshold) Applies(ev shared.Event) (string, bool) {
+	if t.EventType != "" && t.EventType != ev.EventType {
+		return "", false
+	}
+	key := ev.Field(t.KeyBy)
+	return key, key != ""
+}
+
+// Observe adds the event to st and reports whether the threshold tripped.
+// Events already counted (same ID) are ignored.
+// A rule fires at most once per tumbling window, and in sliding mode not
+// again until a full window has passed since the last firing.
+func (t Threshold) Observe(st *WindowState, ev shared.Event, ts time.Time) (*Firing, bool) {
+	w := time.Duration(t.Window)
+
+	switch t.Mode {
+	case ModeTumbling:
+		start := ts.Truncate(w)
+		if !st.WindowStart.Equal(start) {
+			st.WindowStart = start
+			st.Hits = nil
+		}
+	default:
+		cutoff := ts.Add(-w)
+		kept := st.Hits[:0]
+		for _, h := range st.Hits {
+			if h.TS.After(cutoff) {
+				kept = append(kept, h)
+			}
+		}
+		st.Hits = kept
+	}
+
+	// a redelivered event is already counted
+	if ev.ID != "" && slices.ContainsFunc(st.Hits, func(h Hit) bool { return h.EventID == ev.ID }) {
+		return nil, false
+	}
+
+	h := Hit{TS: ts, EventID: ev.ID}
+	if t.Distinct != "" {
+		h.Value = ev.Field(t.Distinct)
+	}
+	st.Hits = append(st.Hits, h)
+	if len(st.Hits) > maxHits {
+		st.Hits = st.Hits[len(st.Hits)-maxHits:]
+	}
+
+	n := t.count(st.Hits)
+	if n < t.Threshold {
+		return nil, false
+	}
+	switch t.Mode {
+	case ModeTumbling:
+		if !st.FiredAt.Before(st.WindowStart) {
+			return nil, false
+		}
+	default:
+		if !st.FiredAt.IsZero() && st.FiredAt.After(ts.Add(-w)) {
+			return nil, false
+		}
+	}
+	st.FiredAt = ts
+
+	ids := make([]string, 0, len(st.Hits))
+	for _, h := range st.Hits {
+		ids = append(ids, h.EventID)
+	}
+	return &Firing{
+		Rule:     t.Name,
+		Kind:     "threshold",
+		KeyBy:    t.KeyBy,
+		Key:      st.Key,
+		Count:    n,
+		EventIDs: ids,
+		At:       ts,
+	}, true
+}
+
+func (t Threshold) count(hits []Hit) int {
+	if t.Distinct == "" {
+		return len(hits)
+	}
+	seen := map[string]struct{}{}
+	for _, h := range hits {
+		seen[h.Value] = struct{}{}
+	}
+	return len(seen)
+}
@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// publicMembers are the IAM members that make a bucket public.
+var publicMembers = []string{"allUsers", "allAuthenticatedUsers"}
+
+// RevertBucketPolicy removes public members from a bucket's IAM policy.
+type RevertBucketPolicy struct {
+	Storage *storage.Service
+}
+
+func (RevertBucketPolicy) Validate(req Request) error {
+	if segment(req.Target(), "buckets") == "" {
+		return fmt.Errorf("%w: revert_bucket_policy target must name a bucket, got %q", ErrInvalid, req.Target())
+	}
+	return nil
+}
+
+func (RevertBucketPolicy) DryRun(_ context.Context, req Request) (Result, error) {
+	return Result{Summary: "would remove allUsers/allAuthenticatedUsers from the IAM policy of bucket " + segment(req.Target(), "buckets")}, nil
+}
+
+func (e RevertBucketPolicy) Execute(ctx context.Context, req Request) (Result, error) {
+	if e.Storage == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	bucket := segment(req.Target(), "buckets")
+	pol, err := e.Storage.Buckets.GetIamPolicy(bucket).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get iam policy of %s: %w", bucket, err)
+	}
+	before := asJSON(pol.Bindings) // also the snapshot Rollback restores
+
+	removed := 0
+	var kept []*storage.PolicyBindings
+	for _, b := range pol.Bindings {
+		n := len(b.Members)
+		b.Members = slices.DeleteFunc(b.Members, func(m string) bool { return slices.Contains(publicMembers, m) })
+		removed += n - len(b.Members)
+		if len(b.Members) > 0 {
+			kept = append(kept, b)
+		}
+	}
+	if removed == 0 {
+		return Result{Summary: "bucket " + bucket + " is not public", Before: before, After: before, Snapshot: before}, nil
+	}
+	pol.Bindings = kept
+
+	out, err := e.Storage.Buckets.SetIamPolicy(bucket, pol).Context(ctx).Do()
+	if err != nil {
+		return Result{Before: before}, fmt.Errorf("set iam policy of %s: %w", bucket, err)
+	}
+	return Result{
+		Summary:  fmt.Sprintf("removed %d public member binding(s) from bucket %s", removed, bucket),
+		Before:   before,
+		After:    asJSON(out.Bindings),
+		Snapshot: before,
+	}, nil
+}
+
+// Rollback puts back the bindings captured before Execute (the snapshot).
+func (e RevertBucketPolicy) Rollback(ctx context.Context, req Request, snapshot string) (Result, error) {
+	if e.Storage == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	var bindings []*storage.PolicyBindings
+	if err := json.Unmarshal([]byte(snapshot), &bindings); err != nil {
+		return Result{}, fmt.Errorf("%w: bad revert_bucket_policy snapshot: %v", ErrInvalid, err)
+	}
+	bucket := segment(req.Target(), "buckets")
+	pol, err := e.Storage.Buckets.GetIamPolicy(bucket).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get iam policy of %s: %w", bucket, err)
+	}
+	before := asJSON(pol.Bindings)
+	pol.Bindings = bindings
+	out, err := e.Storage.Buckets.SetIamPolicy(bucket, pol).Context(ctx).Do()
+	if err != nil {
+		return Result{Before: before}, fmt.Errorf("set iam policy of %s: %w", bucket, err)
+	}
+	return Result{Summary: "restored the previous IAM policy of bucket " + bucket, Before: before, After: asJSON(out.Bindings)}, nil
+}
+
+// Verify checks that the bucket's IAM policy has no public member.
+func (e RevertBucketPolicy) Verify(ctx context.Context, req Request) (Result, error) {
+	if e.Storage == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	bucket := segment(req.Target(), "buckets")
+	pol, err := e.Storage.Buckets.GetIamPolicy(bucket).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get iam policy of %s: %w", bucket, err)
+	}
+	state := asJSON(pol.Bindings)
+	for _, b := range pol.Bindings {
+		for _, m := range b.Members {
+			if slices.Contains(publicMembers, m) {
+				return Result{After: state}, fmt.Errorf("%w: %s has %s on bucket %s", ErrNotInEffect, m, b.Role, bucket)
+			}
+		}
+	}
+	return Result{Summary: "bucket " + bucket + " is not public", After: state}, nil
+}
@@ -0,0 +1,200 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Mode selects whether an executor only plans or really changes resources.
+type Mode string
+
+const (
+	ModeDryRun Mode = "dry_run"
+	ModeLive   Mode = "live"
+)
+
+var (
+	ErrUnknownAction       = errors.New("no executor registered for action")
+	ErrLiveUnsupported     = errors.New("executor has no live implementation")
+	ErrRollbackUnsupported = errors.New("executor cannot roll back")
+	ErrInvalid             = errors.New("invalid action request")
+	ErrNotInEffect         = errors.New("remediation is not in effect")
+)
+
+// Request is what an executor acts on: the action plus the event attributes
+// actions-go copied onto it (principal, target, event_type, ...).
+type Request struct {
+	ActionID string
+	AlertID  string
+	Action   string
+	Details  map[string]string
+}
+
+// Target is the resource the triggering event was about.
+func (r Request) Target() string { return r.Details["target"] }
+
+// Result is recorded on the action document.
+type Result struct {
+	Mode     Mode   `json:"mode" firestore:"mode"`
+	Summary  string `json:"summary" firestore:"summary"`
+	Before   string `json:"before,omitempty" firestore:"before"`     // JSON of the affected state
+	After    string `json:"after,omitempty" firestore:"after"`       // JSON of the state afterwards
+	Snapshot string `json:"snapshot,omitempty" firestore:"snapshot"` // what Rollback restores
+}
+
+// Executor implements one remediation action.
+type Executor interface {
+	// Validate rejects requests the executor cannot act on.
+	Validate(req Request) error
+	// DryRun describes what Execute would do without changing anything.
+	DryRun(ctx context.Context, req Request) (Result, error)
+	// Execute performs the remediation.
+	Execute(ctx context.Context, req Request) (Result, error)
+	// Rollback restores the state captured in a prior Result.Snapshot.
+	Rollback(ctx context.Context, req Request, snapshot string) (Result, error)
+}
+
+// Verifier is implemented by executors that can check, after the fact, that
+// their remediation still holds.
+type Verifier interface {
+	// Verify returns ErrNotInEffect (wrapped) if the resource is back in the
+	// state the remediation addressed.
+	Verify(ctx context.Context, req Request) (Result, error)
+}
+
+// Registry maps action names to executors and their per-environment mode.
+type Registry struct {
+	execs map[string]Executor
+	modes map[string]Mode
+	def   Mode
+}
+
+// NewRegistry returns an empty registry whose actions run in def unless set
+// otherwise.
+func NewRegistry(def Mode) *Registry {
+	return &Registry{execs: map[string]Executor{}, modes: map[string]Mode{}, def: def}
+}
+
+func (r *Registry) Register(name string, e Executor) { r.execs[name] = e }
+
+func (r *Registry) Get(name string) (Executor, bool) {
+	e, ok := r.execs[name]
+	return e, ok
+}
+
+func (r *Registry) SetMode(name string, m Mode) { r.modes[name] = m }
+
+// Mode returns the mode name runs in.
+func (r *Registry) Mode(name string) Mode {
+	if m, ok := r.modes[name]; ok {
+		return m
+	}
+	return r.def
+}
+
+// Run validates the request and dry-runs or executes it per the action's mode.
+func (r *Registry) Run(ctx context.Context, req Request) (Result, error) {
+	e, ok := r.execs[req.Action]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknownAction, req.Action)
+	}
+	if err := e.Validate(req); err != nil {
+		return Result{}, err
+	}
+	mode := r.Mode(req.Action)
+	var (
+		res Result
+		err error
+	)
+	if mode == ModeLive {
+		res, err = e.Execute(ctx, req)
+	} else {
+		res, err = e.DryRun(ctx, req)
+	}
+	res.Mode = mode
+	return res, err
+}
+
+// Rollback undoes an earlier run of req.Action from its snapshot. ran is
+// the mode that run was in, not the action's current mode: a live change is
+// always undone live (failing if the executor has no live client), and a
+// dry run has nothing to undo.
+func (r *Registry) Rollback(ctx context.Context, req Request, ran Mode, snapshot string) (Result, error) {
+	e, ok := r.execs[req.Action]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknownAction, req.Action)
+	}
+	if ran != ModeLive {
+		return Result{Mode: ModeDryRun, Summary: req.Action + " ran in dry_run; nothing to undo"}, nil
+	}
+	res, err := e.Rollback(ctx, req, snapshot)
+	res.Mode = ModeLive
+	return res, err
+}
+
+// Verify checks that req.Action's remediation is in effect. In dry_run mode,
+// and for executors that cannot check, it only says so.
+func (r *Registry) Verify(ctx context.Context, req Request) (Result, error) {
+	e, ok := r.execs[req.Action]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknownAction, req.Action)
+	}
+	mode := r.Mode(req.Action)
+	v, ok := e.(Verifier)
+	switch {
+	case mode != ModeLive:
+		return Result{Mode: mode, Summary: "would verify " + req.Action + " on " + req.Target()}, nil
+	case !ok:
+		return Result{Mode: mode, Summary: req.Action + " has no verifier"}, nil
+	}
+	res, err := v.Verify(ctx, req)
+	res.Mode = mode
+	return res, err
+}
+
+// ParseMode accepts "dry_run" or "live".
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.TrimSpace(s)); m {
+	case ModeDryRun, ModeLive:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown executor mode %q", s)
+}
+
+// ParseModes reads per-action overrides such as
+// "revoke_sa_key=live,isolate_vm_nic=dry_run".
+func ParseModes(s string) (map[string]Mode, error) {
+	out := map[string]Mode{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("executor mode %q: want action=mode", kv)
+		}
+		m, err := ParseMode(val)
+		if err != nil {
+			return nil, err
+		}
+		out[strings.TrimSpace(name)] = m
+	}
+	return out, nil
+}
+
+// Builtin returns a registry with the stock actions. With nil clients the
+// GCP-backed executors can only dry-run.
+func Builtin(def Mode, c *Clients) *Registry {
+	if c == nil {
+		c = &Clients{}
+	}
+	r := NewRegistry(def)
+	r.Register("revoke_sa_key", RevokeSAKey{IAM: c.IAM})
+	r.Register("revert_bucket_policy", RevertBucketPolicy{Storage: c.Storage})
+	r.Register("isolate_vm_nic", IsolateVMNIC{Compute: c.Compute})
+	r.Register("revert_iam_binding", RevertIAMBinding{})
+	r.Register("require_approval", Review{})
+	return r
+}
@@ -0,0 +1,355 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	iam "google.golang.org/api/iam/v1"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// fakeGCP serves the slice of the IAM, Storage and Compute APIs the live
+// executors call, holding one service account, one bucket and one instance.
+type fakeGCP struct {
+	mu        sync.Mutex
+	keys      []*iam.ServiceAccountKey
+	bindings  []*storage.PolicyBindings
+	tags      []string
+	network   string
+	firewalls map[string]*compute.Firewall
+}
+
+func (f *fakeGCP) serve(t *testing.T) *Clients {
+	t.Helper()
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	done := func(w http.ResponseWriter, _ *http.Request) {
+		reply(w, &compute.Operation{Name: "op-1", Status: "DONE"})
+	}
+
+	mux.HandleFunc("GET /v1/projects/{p}/serviceAccounts/{sa}/keys", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		reply(w, &iam.ListServiceAccountKeysResponse{Keys: f.keys})
+	})
+	mux.HandleFunc("POST /v1/projects/{p}/serviceAccounts/{sa}/keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id, verb, _ := strings.Cut(r.PathValue("key"), ":")
+		for _, k := range f.keys {
+			if strings.HasSuffix(k.Name, "/keys/"+id) {
+				k.Disabled = verb == "disable"
+				reply(w, struct{}{})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	mux.HandleFunc("GET /storage/v1/b/{bucket}/iam", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		reply(w, &storage.Policy{Bindings: f.bindings})
+	})
+	mux.HandleFunc("PUT /storage/v1/b/{bucket}/iam", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var p storage.Policy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.bindings = p.Bindings
+		reply(w, &p)
+	})
+
+	mux.HandleFunc("GET /compute/v1/projects/{p}/zones/{z}/instances/{i}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		reply(w, &compute.Instance{
+			Name:              r.PathValue("i"),
+			Tags:              &compute.Tags{Items: f.tags, Fingerprint: "fp"},
+			NetworkInterfaces: []*compute.NetworkInterface{{Network: f.network}},
+		})
+	})
+	mux.HandleFunc("POST /compute/v1/projects/{p}/zones/{z}/instances/{i}/setTags", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var tags compute.Tags
+		if err := json.NewDecoder(r.Body).Decode(&tags); err != nil || tags.Fingerprint != "fp" {
+			http.Error(w, "bad tags", http.StatusPreconditionFailed)
+			return
+		}
+		f.tags = tags.Items
+		done(w, r)
+	})
+	mux.HandleFunc("GET /compute/v1/projects/{p}/global/firewalls/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		fw, ok := f.firewalls[r.PathValue("name")]
+		if !ok {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		reply(w, fw)
+	})
+	mux.HandleFunc("POST /compute/v1/projects/{p}/global/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var fw compute.Firewall
+		if err := json.NewDecoder(r.Body).Decode(&fw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.firewalls[fw.Name] = &fw
+		done(w, r)
+	})
+	mux.HandleFunc("GET /compute/v1/projects/{p}/zones/{z}/operations/{op}", done)
+	mux.HandleFunc("GET /compute/v1/projects/{p}/global/operations/{op}", done)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c, err := NewClients(context.Background(), Endpoints{
+		IAM:     srv.URL + "/",
+		Storage: srv.URL + "/storage/v1/",
+		Compute: srv.URL + "/compute/v1/",
+		NoAuth:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRevokeSAKey(t *testing.T) {
+	const sa = "projects/p/serviceAccounts/build@p.iam.gserviceaccount.com"
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) string { return ts.Add(d).Format(time.RFC3339) }
+
+	tests := []struct {
+		name    string
+		details map[string]string
+		want    []string // key ids disabled
+	}{
+		{name: "by key_id", details: map[string]string{"key_id": "k2"}, want: []string{"k2"}},
+		{name: "by event_ts within 15m", details: map[string]string{"event_ts": ts.Format(time.RFC3339Nano)}, want: []string{"k2", "k3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeGCP{keys: []*iam.ServiceAccountKey{
+				{Name: sa + "/keys/k1", ValidAfterTime: at(-20 * time.Minute)},
+				{Name: sa + "/keys/k2", ValidAfterTime: at(-10 * time.Minute)},
+				{Name: sa + "/keys/k3", ValidAfterTime: at(5 * time.Minute)},
+				{Name: sa + "/keys/k4", ValidAfterTime: at(time.Minute), Disabled: true},
+			}}
+			e := RevokeSAKey{IAM: f.serve(t).IAM}
+			ctx := context.Background()
+			req := Request{Action: "revoke_sa_key", Details: map[string]string{"target": sa}}
+			for k, v := range tt.details {
+				req.Details[k] = v
+			}
+
+			if err := e.Validate(req); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			res, err := e.Execute(ctx, req)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			var got []string
+			for _, k := range f.keys {
+				if k.Disabled && !strings.HasSuffix(k.Name, "/k4") {
+					got = append(got, k.Name[strings.LastIndex(k.Name, "/")+1:])
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("disabled %v, want %v", got, tt.want)
+			}
+			if _, err := e.Verify(ctx, req); err != nil {
+				t.Fatalf("Verify after Execute: %v", err)
+			}
+
+			if _, err := e.Rollback(ctx, req, res.Snapshot); err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			for _, k := range f.keys {
+				if k.Disabled != strings.HasSuffix(k.Name, "/k4") {
+					t.Fatalf("after rollback %s disabled=%v", k.Name, k.Disabled)
+				}
+			}
+			if _, err := e.Verify(ctx, req); !errors.Is(err, ErrNotInEffect) {
+				t.Fatalf("Verify after Rollback = %v, want ErrNotInEffect", err)
+			}
+		})
+	}
+}
+
+func TestRevokeSAKeyValidate(t *testing.T) {
+	for _, d := range []map[string]string{
+		{"target": "projects/p/buckets/b", "key_id": "k1"},
+		{"target": "projects/p/serviceAccounts/build"},
+		{"target": "projects/p/serviceAccounts/build", "event_ts": "yesterday"},
+	} {
+		if err := (RevokeSAKey{}).Validate(Request{Details: d}); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Validate(%v) = %v, want ErrInvalid", d, err)
+		}
+	}
+}
+
+func TestRevertBucketPolicy(t *testing.T) {
+	f := &fakeGCP{bindings: []*storage.PolicyBindings{
+		{Role: "roles/storage.objectViewer", Members: []string{"allUsers", "user:alice@example.com"}},
+		{Role: "roles/storage.legacyBucketReader", Members: []string{"allAuthenticatedUsers"}},
+		{Role: "roles/storage.admin", Members: []string{"group:ops@example.com"}},
+	}}
+	orig := asJSON(f.bindings)
+	e := RevertBucketPolicy{Storage: f.serve(t).Storage}
+	ctx := context.Background()
+	req := Request{Action: "revert_bucket_policy", Details: map[string]string{"target": "projects/_/buckets/data"}}
+
+	if err := e.Validate(Request{Details: map[string]string{"target": "projects/p"}}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Validate without bucket = %v, want ErrInvalid", err)
+	}
+	if err := e.Validate(req); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, err := e.Verify(ctx, req); !errors.Is(err, ErrNotInEffect) {
+		t.Fatalf("Verify on public bucket = %v, want ErrNotInEffect", err)
+	}
+
+	res, err := e.Execute(ctx, req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	want := `[{"members":["user:alice@example.com"],"role":"roles/storage.objectViewer"},{"members":["group:ops@example.com"],"role":"roles/storage.admin"}]`
+	if got := asJSON(f.bindings); got != want {
+		t.Fatalf("bindings after Execute = %s, want %s", got, want)
+	}
+	if res.Snapshot != orig {
+		t.Fatalf("snapshot = %s, want %s", res.Snapshot, orig)
+	}
+	if _, err := e.Verify(ctx, req); err != nil {
+		t.Fatalf("Verify after Execute: %v", err)
+	}
+
+	if _, err := e.Rollback(ctx, req, res.Snapshot); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if got := asJSON(f.bindings); got != orig {
+		t.Fatalf("bindings after Rollback = %s, want %s", got, orig)
+	}
+	if _, err := e.Verify(ctx, req); !errors.Is(err, ErrNotInEffect) {
+		t.Fatalf("Verify after Rollback = %v, want ErrNotInEffect", err)
+	}
+}
+
+func TestIsolateVMNIC(t *testing.T) {
+	f := &fakeGCP{
+		tags:      []string{"web"},
+		network:   "projects/p/global/networks/prod",
+		firewalls: map[string]*compute.Firewall{},
+	}
+	e := IsolateVMNIC{Compute: f.serve(t).Compute}
+	ctx := context.Background()
+	req := Request{Action: "isolate_vm_nic", Details: map[string]string{"target": "projects/p/zones/us-east1-b/instances/vm1"}}
+
+	if err := e.Validate(Request{Details: map[string]string{"target": "projects/p/zones/us-east1-b"}}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Validate without instance = %v, want ErrInvalid", err)
+	}
+	if err := e.Validate(req); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	res, err := e.Execute(ctx, req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !slices.Equal(f.tags, []string{"web", QuarantineTag}) {
+		t.Fatalf("tags after Execute = %v", f.tags)
+	}
+	fw, ok := f.firewalls["sf-quarantine-deny-ingress-prod"]
+	if !ok {
+		t.Fatalf("firewall not created: %v", f.firewalls)
+	}
+	if fw.Direction != "INGRESS" || fw.Network != f.network || len(fw.Denied) != 1 || fw.Denied[0].IPProtocol != "all" ||
+		!slices.Equal(fw.TargetTags, []string{QuarantineTag}) || !slices.Equal(fw.SourceRanges, []string{"0.0.0.0/0"}) {
+		t.Fatalf("firewall = %+v", fw)
+	}
+	if _, err := e.Verify(ctx, req); err != nil {
+		t.Fatalf("Verify after Execute: %v", err)
+	}
+
+	// the rule is shared, so a second run finds it instead of creating it
+	if _, err := e.Execute(ctx, req); err != nil || len(f.firewalls) != 1 {
+		t.Fatalf("second Execute: err=%v firewalls=%d", err, len(f.firewalls))
+	}
+
+	delete(f.firewalls, fw.Name)
+	if _, err := e.Verify(ctx, req); !errors.Is(err, ErrNotInEffect) {
+		t.Fatalf("Verify with firewall removed = %v, want ErrNotInEffect", err)
+	}
+	f.firewalls[fw.Name] = fw
+
+	if _, err := e.Rollback(ctx, req, res.Snapshot); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if !slices.Equal(f.tags, []string{"web"}) {
+		t.Fatalf("tags after Rollback = %v", f.tags)
+	}
+	if _, err := e.Verify(ctx, req); !errors.Is(err, ErrNotInEffect) {
+		t.Fatalf("Verify after Rollback = %v, want ErrNotInEffect", err)
+	}
+}
+
+func TestFirewallName(t *testing.T) {
+	tests := []struct{ network, want string }{
+		{"global/networks/default", "sf-quarantine-deny-ingress-default"},
+		// truncation at 63 would leave a trailing dash, which GCE rejects
+		{"global/networks/" + strings.Repeat("a", 35) + "-net", "sf-quarantine-deny-ingress-" + strings.Repeat("a", 35)},
+	}
+	for _, tt := range tests {
+		if got := firewallName(tt.network); got != tt.want {
+			t.Errorf("firewallName(%q) = %q, want %q", tt.network, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryRollbackFollowsRecordedMode(t *testing.T) {
+	ctx := context.Background()
+	req := Request{Action: "revert_bucket_policy", Details: map[string]string{"target": "projects/_/buckets/data"}}
+	snapshot := `[{"members":["allUsers"],"role":"roles/storage.objectViewer"}]`
+
+	// the action has since been switched to dry_run; the live change is
+	// still undone live
+	f := &fakeGCP{}
+	r := Builtin(ModeDryRun, f.serve(t))
+	res, err := r.Rollback(ctx, req, ModeLive, snapshot)
+	if err != nil || res.Mode != ModeLive {
+		t.Fatalf("Rollback = %+v, %v; want a live undo", res, err)
+	}
+	if got := asJSON(f.bindings); got != snapshot {
+		t.Fatalf("bindings = %s, want %s", got, snapshot)
+	}
+
+	if _, err := Builtin(ModeLive, nil).Rollback(ctx, req, ModeLive, snapshot); !errors.Is(err, ErrLiveUnsupported) {
+		t.Fatalf("Rollback without a client = %v, want ErrLiveUnsupported", err)
+	}
+
+	f = &fakeGCP{}
+	res, err = Builtin(ModeLive, f.serve(t)).Rollback(ctx, req, ModeDryRun, "")
+	if err != nil || res.Mode != ModeDryRun || f.bindings != nil {
+		t.Fatalf("Rollback of a dry run = %+v, %v (bindings %v); want nothing undone", res, err, f.bindings)
+	}
+}
@@ -0,0 +1,248 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// QuarantineTag is the network tag the deny-all rules target.
+const QuarantineTag = "sf-quarantine"
+
+// IsolateVMNIC cuts a VM off by tagging it and making sure a deny-all
+// ingress rule targeting the tag exists on its network.
+type IsolateVMNIC struct {
+	Compute *compute.Service
+}
+
+func (IsolateVMNIC) Validate(req Request) error {
+	if segment(req.Target(), "projects") == "" || segment(req.Target(), "instances") == "" {
+		return fmt.Errorf("%w: isolate_vm_nic target must name a project and instance, got %q", ErrInvalid, req.Target())
+	}
+	return nil
+}
+
+func (IsolateVMNIC) DryRun(_ context.Context, req Request) (Result, error) {
+	return Result{Summary: fmt.Sprintf("would tag instance %s with %s and apply deny-all ingress firewall",
+		segment(req.Target(), "instances"), QuarantineTag)}, nil
+}
+
+// vmState is what isolate_vm_nic captures before and after.
+type vmState struct {
+	Project  string   `json:"project"`
+	Zone     string   `json:"zone"`
+	Instance string   `json:"instance"`
+	Tags     []string `json:"tags"`
+	Firewall string   `json:"firewall,omitempty"`
+}
+
+func (e IsolateVMNIC) Execute(ctx context.Context, req Request) (Result, error) {
+	if e.Compute == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	project, name := segment(req.Target(), "projects"), segment(req.Target(), "instances")
+	zone, err := e.zone(ctx, req)
+	if err != nil {
+		return Result{}, err
+	}
+
+	inst, err := e.Compute.Instances.Get(project, zone, name).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get instance %s: %w", name, err)
+	}
+	if inst.Tags == nil {
+		inst.Tags = &compute.Tags{}
+	}
+	before := vmState{Project: project, Zone: zone, Instance: name, Tags: slices.Clone(inst.Tags.Items)}
+
+	if !slices.Contains(inst.Tags.Items, QuarantineTag) {
+		tags := &compute.Tags{Items: append(inst.Tags.Items, QuarantineTag), Fingerprint: inst.Tags.Fingerprint}
+		op, err := e.Compute.Instances.SetTags(project, zone, name, tags).Context(ctx).Do()
+		if err == nil {
+			err = waitOp(ctx, op, func() (*compute.Operation, error) {
+				return e.Compute.ZoneOperations.Get(project, zone, op.Name).Context(ctx).Do()
+			})
+		}
+		if err != nil {
+			return Result{Before: asJSON(before)}, fmt.Errorf("tag instance %s: %w", name, err)
+		}
+	}
+
+	network := ""
+	if len(inst.NetworkInterfaces) > 0 {
+		network = inst.NetworkInterfaces[0].Network
+	}
+	fw, err := e.ensureFirewall(ctx, project, network)
+	if err != nil {
+		return Result{Before: asJSON(before)}, err
+	}
+
+	after := before
+	if !slices.Contains(before.Tags, QuarantineTag) {
+		after.Tags = append(slices.Clone(before.Tags), QuarantineTag)
+	}
+	after.Firewall = fw
+	return Result{
+		Summary:  fmt.Sprintf("tagged %s/%s with %s; ingress denied by %s", zone, name, QuarantineTag, fw),
+		Before:   asJSON(before),
+		After:    asJSON(after),
+		Snapshot: asJSON(before),
+	}, nil
+}
+
+// Rollback restores the instance's previous network tags. The shared deny
+// rule stays in place for any other quarantined instances; it no longer
+// applies once the tag is gone.
+func (e IsolateVMNIC) Rollback(ctx context.Context, _ Request, snapshot string) (Result, error) {
+	if e.Compute == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	var prev vmState
+	if err := json.Unmarshal([]byte(snapshot), &prev); err != nil || prev.Instance == "" {
+		return Result{}, fmt.Errorf("%w: bad isolate_vm_nic snapshot", ErrInvalid)
+	}
+	inst, err := e.Compute.Instances.Get(prev.Project, prev.Zone, prev.Instance).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get instance %s: %w", prev.Instance, err)
+	}
+	cur := vmState{Project: prev.Project, Zone: prev.Zone, Instance: prev.Instance}
+	fingerprint := ""
+	if inst.Tags != nil {
+		cur.Tags, fingerprint = inst.Tags.Items, inst.Tags.Fingerprint
+	}
+	tags := &compute.Tags{Items: prev.Tags, Fingerprint: fingerprint, ForceSendFields: []string{"Items"}}
+	op, err := e.Compute.Instances.SetTags(prev.Project, prev.Zone, prev.Instance, tags).Context(ctx).Do()
+	if err == nil {
+		err = waitOp(ctx, op, func() (*compute.Operation, error) {
+			return e.Compute.ZoneOperations.Get(prev.Project, prev.Zone, op.Name).Context(ctx).Do()
+		})
+	}
+	if err != nil {
+		return Result{Before: asJSON(cur)}, fmt.Errorf("restore tags of %s: %w", prev.Instance, err)
+	}
+	return Result{
+		Summary: fmt.Sprintf("restored network tags of %s/%s", prev.Zone, prev.Instance),
+		Before:  asJSON(cur),
+		After:   asJSON(prev),
+	}, nil
+}
+
+// Verify checks that the instance carries the quarantine tag and that the
+// deny rule for its network exists.
+func (e IsolateVMNIC) Verify(ctx context.Context, req Request) (Result, error) {
+	if e.Compute == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	project, name := segment(req.Target(), "projects"), segment(req.Target(), "instances")
+	zone, err := e.zone(ctx, req)
+	if err != nil {
+		return Result{}, err
+	}
+	inst, err := e.Compute.Instances.Get(project, zone, name).Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("get instance %s: %w", name, err)
+	}
+	cur := vmState{Project: project, Zone: zone, Instance: name}
+	if inst.Tags != nil {
+		cur.Tags = inst.Tags.Items
+	}
+	if !slices.Contains(cur.Tags, QuarantineTag) {
+		return Result{After: asJSON(cur)}, fmt.Errorf("%w: %s is not tagged %s", ErrNotInEffect, name, QuarantineTag)
+	}
+	network := "global/networks/default"
+	if len(inst.NetworkInterfaces) > 0 && inst.NetworkInterfaces[0].Network != "" {
+		network = inst.NetworkInterfaces[0].Network
+	}
+	cur.Firewall = firewallName(network)
+	if _, err := e.Compute.Firewalls.Get(project, cur.Firewall).Context(ctx).Do(); err != nil {
+		if isNotFound(err) {
+			return Result{After: asJSON(cur)}, fmt.Errorf("%w: firewall %s is missing", ErrNotInEffect, cur.Firewall)
+		}
+		return Result{}, fmt.Errorf("get firewall %s: %w", cur.Firewall, err)
+	}
+	return Result{Summary: fmt.Sprintf("%s/%s is tagged %s and %s exists", zone, name, QuarantineTag, cur.Firewall), After: asJSON(cur)}, nil
+}
+
+// zone is the instance's zone from the target or details, else looked up.
+func (e IsolateVMNIC) zone(ctx context.Context, req Request) (string, error) {
+	if z := segment(req.Target(), "zones"); z != "" {
+		return z, nil
+	}
+	if z := req.Details["zone"]; z != "" {
+		return z, nil
+	}
+	return e.findZone(ctx, segment(req.Target(), "projects"), segment(req.Target(), "instances"))
+}
+
+// findZone locates an instance by name when the target omits its zone.
+func (e IsolateVMNIC) findZone(ctx context.Context, project, name string) (string, error) {
+	zone := ""
+	err := e.Compute.Instances.AggregatedList(project).Filter("name = "+name).Context(ctx).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+		for scope, items := range l.Items {
+			for _, in := range items.Instances {
+				if in.Name == name && zone == "" {
+					zone = strings.TrimPrefix(scope, "zones/")
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("find instance %s: %w", name, err)
+	}
+	if zone == "" {
+		return "", fmt.Errorf("instance %s not found in project %s", name, project)
+	}
+	return zone, nil
+}
+
+// ensureFirewall creates the deny-all ingress rule for network if missing
+// and returns its name.
+func (e IsolateVMNIC) ensureFirewall(ctx context.Context, project, network string) (string, error) {
+	if network == "" {
+		network = "global/networks/default"
+	}
+	name := firewallName(network)
+	_, err := e.Compute.Firewalls.Get(project, name).Context(ctx).Do()
+	if err == nil {
+		return name, nil
+	}
+	if !isNotFound(err) {
+		return "", fmt.Errorf("get firewall %s: %w", name, err)
+	}
+	op, err := e.Compute.Firewalls.Insert(project, &compute.Firewall{
+		Name:            name,
+		Network:         network,
+		Direction:       "INGRESS",
+		Priority:        0,
+		Denied:          []*compute.FirewallDenied{{IPProtocol: "all"}},
+		SourceRanges:    []string{"0.0.0.0/0"},
+		TargetTags:      []string{QuarantineTag},
+		Description:     "sentinelflow quarantine: deny all ingress to tagged instances",
+		ForceSendFields: []string{"Priority"},
+	}).Context(ctx).Do()
+	if err == nil {
+		err = waitOp(ctx, op, func() (*compute.Operation, error) {
+			return e.Compute.GlobalOperations.Get(project, op.Name).Context(ctx).Do()
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("create firewall %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// firewallName is the deny rule for network, cut to the 63 characters GCE
+// allows without leaving a trailing dash.
+func firewallName(network string) string {
+	name := QuarantineTag + "-deny-ingress-" + path.Base(network)
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
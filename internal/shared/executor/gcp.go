@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	iam "google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// Clients are the Google API clients the live executors call. A nil client
+// leaves the corresponding executors dry-run only.
+type Clients struct {
+	IAM     *iam.Service
+	Storage *storage.Service
+	Compute *compute.Service
+}
+
+// Endpoints override the API base URLs, e.g. to point the executors at
+// tools/fakeserver-go. NoAuth skips credentials (fakes only).
+type Endpoints struct {
+	IAM     string // e.g. http://localhost:9099/
+	Storage string // e.g. http://localhost:9099/storage/v1/
+	Compute string // e.g. http://localhost:9099/compute/v1/
+	NoAuth  bool
+}
+
+// NewClients builds the API clients with Application Default Credentials,
+// honoring any endpoint overrides.
+func NewClients(ctx context.Context, ep Endpoints) (*Clients, error) {
+	opts := func(endpoint string) []option.ClientOption {
+		var o []option.ClientOption
+		if endpoint != "" {
+			o = append(o, option.WithEndpoint(endpoint))
+		}
+		if ep.NoAuth {
+			o = append(o, option.WithoutAuthentication(), option.WithHTTPClient(http.DefaultClient))
+		}
+		return o
+	}
+	iamSvc, err := iam.NewService(ctx, opts(ep.IAM)...)
+	if err != nil {
+		return nil, fmt.Errorf("iam client: %w", err)
+	}
+	storageSvc, err := storage.NewService(ctx, opts(ep.Storage)...)
+	if err != nil {
+		return nil, fmt.Errorf("storage client: %w", err)
+	}
+	computeSvc, err := compute.NewService(ctx, opts(ep.Compute)...)
+	if err != nil {
+		return nil, fmt.Errorf("compute client: %w", err)
+	}
+	return &Clients{IAM: iamSvc, Storage: storageSvc, Compute: computeSvc}, nil
+}
+
+// segment returns the path element following key in a resource name such as
+// projects/p/zones/z/instances/i.
+func segment(resource, key string) string {
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == key {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// asJSON renders captured state for the action document.
+func asJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+// waitOp polls a compute operation until it is done.
+func waitOp(ctx context.Context, op *compute.Operation, poll func() (*compute.Operation, error)) error {
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		var err error
+		if op, err = poll(); err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("operation %s: %s", op.Name, op.Error.Errors[0].Message)
+	}
+	return nil
+}
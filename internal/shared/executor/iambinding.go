@@ -0,0 +1,28 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+)
+
+// RevertIAMBinding removes a risky binding added to a resource's IAM policy.
+type RevertIAMBinding struct{}
+
+func (RevertIAMBinding) Validate(req Request) error {
+	if req.Target() == "" {
+		return fmt.Errorf("%w: revert_iam_binding needs a target", ErrInvalid)
+	}
+	return nil
+}
+
+func (RevertIAMBinding) DryRun(_ context.Context, req Request) (Result, error) {
+	return Result{Summary: "would remove the added binding from the IAM policy of " + req.Target()}, nil
+}
+
+func (RevertIAMBinding) Execute(context.Context, Request) (Result, error) {
+	return Result{}, ErrLiveUnsupported
+}
+
+func (RevertIAMBinding) Rollback(context.Context, Request, string) (Result, error) {
+	return Result{}, ErrRollbackUnsupported
+}
@@ -0,0 +1,21 @@
+package executor
+
+import "context"
+
+// Review is the action for alerts that only needed a human look (e.g. an
+// anomalous but otherwise unremarkable event); approving it changes nothing.
+type Review struct{}
+
+func (Review) Validate(Request) error { return nil }
+
+func (Review) DryRun(context.Context, Request) (Result, error) {
+	return Result{Summary: "noop (reviewed)"}, nil
+}
+
+func (r Review) Execute(ctx context.Context, req Request) (Result, error) {
+	return r.DryRun(ctx, req)
+}
+
+func (Review) Rollback(context.Context, Request, string) (Result, error) {
+	return Result{Summary: "noop"}, nil
+}
@@ -0,0 +1,147 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	iam "google.golang.org/api/iam/v1"
+)
+
+// keyWindow is how long before the event a key may have been created and
+// still be considered the one the event reported.
+const keyWindow = 15 * time.Minute
+
+// RevokeSAKey disables the user-managed key(s) the event reported: the key
+// named by details.key_id, otherwise enabled keys created around event_ts.
+type RevokeSAKey struct {
+	IAM *iam.Service
+}
+
+func (RevokeSAKey) Validate(req Request) error {
+	if saName(req.Target()) == "" {
+		return fmt.Errorf("%w: revoke_sa_key target must name a service account, got %q", ErrInvalid, req.Target())
+	}
+	if req.Details["key_id"] == "" {
+		if _, err := time.Parse(time.RFC3339Nano, req.Details["event_ts"]); err != nil {
+			return fmt.Errorf("%w: revoke_sa_key needs key_id or event_ts", ErrInvalid)
+		}
+	}
+	return nil
+}
+
+func (RevokeSAKey) DryRun(_ context.Context, req Request) (Result, error) {
+	return Result{Summary: "would disable matching user-managed keys of " + saName(req.Target())}, nil
+}
+
+func (e RevokeSAKey) Execute(ctx context.Context, req Request) (Result, error) {
+	if e.IAM == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	name := saName(req.Target())
+	resp, err := e.IAM.Projects.ServiceAccounts.Keys.List(name).KeyTypes("USER_MANAGED").Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("list keys of %s: %w", name, err)
+	}
+	before := keyStates(resp.Keys)
+
+	var disabled []string
+	for _, k := range resp.Keys {
+		if k.Disabled || !keyMatches(k, req.Details) {
+			continue
+		}
+		if _, err := e.IAM.Projects.ServiceAccounts.Keys.Disable(k.Name, &iam.DisableServiceAccountKeyRequest{}).Context(ctx).Do(); err != nil {
+			return Result{Before: asJSON(before)}, fmt.Errorf("disable %s: %w", k.Name, err)
+		}
+		k.Disabled = true
+		disabled = append(disabled, k.Name)
+	}
+
+	res := Result{Before: asJSON(before), After: asJSON(keyStates(resp.Keys)), Snapshot: asJSON(disabled)}
+	if len(disabled) == 0 {
+		res.Summary = "no enabled key of " + name + " matched"
+	} else {
+		res.Summary = fmt.Sprintf("disabled %d key(s) of %s", len(disabled), name)
+	}
+	return res, nil
+}
+
+// Rollback re-enables the keys Execute disabled (the snapshot lists them).
+func (e RevokeSAKey) Rollback(ctx context.Context, _ Request, snapshot string) (Result, error) {
+	if e.IAM == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(snapshot), &names); err != nil {
+		return Result{}, fmt.Errorf("%w: bad revoke_sa_key snapshot: %v", ErrInvalid, err)
+	}
+	for _, n := range names {
+		if _, err := e.IAM.Projects.ServiceAccounts.Keys.Enable(n, &iam.EnableServiceAccountKeyRequest{}).Context(ctx).Do(); err != nil {
+			return Result{}, fmt.Errorf("enable %s: %w", n, err)
+		}
+	}
+	return Result{Summary: fmt.Sprintf("re-enabled %d key(s)", len(names)), After: asJSON(names)}, nil
+}
+
+// Verify checks that no key matching the event is enabled.
+func (e RevokeSAKey) Verify(ctx context.Context, req Request) (Result, error) {
+	if e.IAM == nil {
+		return Result{}, ErrLiveUnsupported
+	}
+	name := saName(req.Target())
+	resp, err := e.IAM.Projects.ServiceAccounts.Keys.List(name).KeyTypes("USER_MANAGED").Context(ctx).Do()
+	if err != nil {
+		return Result{}, fmt.Errorf("list keys of %s: %w", name, err)
+	}
+	state := asJSON(keyStates(resp.Keys))
+	for _, k := range resp.Keys {
+		if !k.Disabled && keyMatches(k, req.Details) {
+			return Result{After: state}, fmt.Errorf("%w: key %s is enabled", ErrNotInEffect, k.Name)
+		}
+	}
+	return Result{Summary: "no matching key of " + name + " is enabled", After: state}, nil
+}
+
+type keyState struct {
+	Name       string `json:"name"`
+	Disabled   bool   `json:"disabled"`
+	ValidAfter string `json:"valid_after"`
+}
+
+func keyStates(keys []*iam.ServiceAccountKey) []keyState {
+	out := make([]keyState, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, keyState{Name: k.Name, Disabled: k.Disabled, ValidAfter: k.ValidAfterTime})
+	}
+	return out
+}
+
+func keyMatches(k *iam.ServiceAccountKey, details map[string]string) bool {
+	if id := details["key_id"]; id != "" {
+		return strings.HasSuffix(k.Name, "/keys/"+id)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, details["event_ts"])
+	if err != nil {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339, k.ValidAfterTime)
+	if err != nil {
+		return false
+	}
+	return !created.Before(ts.Add(-keyWindow)) && !created.After(ts.Add(keyWindow))
+}
+
+// saName turns projects/p/serviceAccounts/{id|email} into the IAM resource
+// name, expanding a bare account id to its email.
+func saName(target string) string {
+	project, sa := segment(target, "projects"), segment(target, "serviceAccounts")
+	if project == "" || sa == "" {
+		return ""
+	}
+	if !strings.Contains(sa, "@") {
+		sa = sa + "@" + project + ".iam.gserviceaccount.com"
+	}
+	return "projects/" + project + "/serviceAccounts/" + sa
+}
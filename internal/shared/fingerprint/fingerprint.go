@@ -0,0 +1,39 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// DefaultFields identify "the same thing happening again".
+var DefaultFields = []string{"event_type", "principal", "target"}
+
+// ParseFields splits a comma-separated field list, falling back to DefaultFields.
+func ParseFields(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	if len(out) == 0 {
+		return DefaultFields
+	}
+	return out
+}
+
+// Compute hashes the named field values. Field names are part of the input
+// so changing the configured fields never collides with old fingerprints.
+func Compute(f match.Fields, fields []string) string {
+	h := sha256.New()
+	for _, name := range fields {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.ToLower(f[name])))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
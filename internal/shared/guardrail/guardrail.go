@@ -0,0 +1,240 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// What a rate limit counts per key.
+const (
+	PerAction        = "action"         // each action type, across projects
+	PerProject       = "project"        // each target project, across action types
+	PerActionProject = "action_project" // each action type in each project (default)
+)
+
+// KillSwitchDoc is the id of the kill switch document in the guardrails
+// collection; every other document there is a State.
+const KillSwitchDoc = "kill_switch"
+
+// maxHits bounds the timestamps kept per state document.
+const maxHits = 500
+
+// Limit caps how many actions run without a human in a sliding window.
+type Limit struct {
+	Name   string          `json:"name"`
+	Action string          `json:"action"` // "*" or empty: any action
+	Per    string          `json:"per,omitempty"`
+	Max    int             `json:"max"`
+	Window shared.Duration `json:"window"`
+}
+
+// Protect marks resources that are never changed without approval.
+// Conditions see the alert fields plus action and project.
+type Protect struct {
+	Name string       `json:"name"`
+	When []match.Cond `json:"when"`
+}
+
+// Breaker opens after Failures automated actions of one type end dead
+// within Window. An open breaker, like a tripped limit, sends that action
+// type to approval until Cooldown has passed.
+type Breaker struct {
+	Failures int             `json:"failures"` // 0 disables
+	Window   shared.Duration `json:"window"`
+	Cooldown shared.Duration `json:"cooldown"`
+}
+
+// Config is the guardrails file (GUARDRAILS_FILE).
+type Config struct {
+	Limits    []Limit   `json:"limits"`
+	Protected []Protect `json:"protected"`
+	Breaker   Breaker   `json:"breaker"`
+}
+
+// State is the persisted counter behind a limit or the breaker for one key.
+type State struct {
+	Key       string      `json:"key" firestore:"key"`
+	Hits      []time.Time `json:"hits" firestore:"hits"` // actions counted, or failures for the breaker
+	OpenUntil *time.Time  `json:"open_until,omitempty" firestore:"open_until"`
+	Reason    string      `json:"reason,omitempty" firestore:"reason"` // why it opened
+	Updated   time.Time   `json:"updated" firestore:"updated"`
+}
+
+// KillSwitch holds every automated action for approval while engaged.
+type KillSwitch struct {
+	Engaged bool      `json:"engaged" firestore:"engaged"`
+	By      string    `json:"by,omitempty" firestore:"by"`
+	Reason  string    `json:"reason,omitempty" firestore:"reason"`
+	Updated time.Time `json:"updated" firestore:"updated"`
+}
+
+// DefaultConfig allows five VM isolations per project and twenty automated
+// actions per project an hour, protects resources labelled "protected", and
+// opens the breaker for an hour after three dead actions of a type.
+func DefaultConfig() Config {
+	return Config{
+		Limits: []Limit{
+			{Name: "isolate_vm_nic", Action: "isolate_vm_nic", Per: PerActionProject, Max: 5, Window: shared.Duration(time.Hour)},
+			{Name: "project", Action: "*", Per: PerProject, Max: 20, Window: shared.Duration(time.Hour)},
+		},
+		Protected: []Protect{
+			{Name: "protected_label", When: []match.Cond{{Field: "labels", Op: "has", Value: "protected"}}},
+		},
+		Breaker: Breaker{Failures: 3, Window: shared.Duration(time.Hour), Cooldown: shared.Duration(time.Hour)},
+	}
+}
+
+// LoadConfig reads and validates a guardrails file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, l := range c.Limits {
+		if l.Name == "" || seen[l.Name] || strings.Contains(l.Name, "/") {
+			return Config{}, fmt.Errorf("guardrail limit: needs a unique name without '/', got %q", l.Name)
+		}
+		seen[l.Name] = true
+		if l.Max <= 0 || l.Window <= 0 {
+			return Config{}, fmt.Errorf("guardrail limit %s: max and window must be positive", l.Name)
+		}
+		if l.Max > maxHits {
+			// the state keeps only maxHits timestamps, so a higher max never trips
+			return Config{}, fmt.Errorf("guardrail limit %s: max must be at most %d", l.Name, maxHits)
+		}
+		switch l.Per {
+		case "", PerAction, PerProject, PerActionProject:
+		default:
+			return Config{}, fmt.Errorf("guardrail limit %s: unknown per %q", l.Name, l.Per)
+		}
+	}
+	for _, p := range c.Protected {
+		if p.Name == "" || len(p.When) == 0 {
+			return Config{}, fmt.Errorf("guardrail protected: needs a name and conditions")
+		}
+		if err := match.ValidateAll(p.When); err != nil {
+			return Config{}, fmt.Errorf("guardrail protected %s: %w", p.Name, err)
+		}
+	}
+	if b := c.Breaker; b.Failures < 0 || (b.Failures > 0 && b.Window <= 0) {
+		return Config{}, fmt.Errorf("guardrail breaker: failures needs a positive window")
+	}
+	if c.Breaker.Failures > maxHits {
+		return Config{}, fmt.Errorf("guardrail breaker: failures must be at most %d", maxHits)
+	}
+	if (len(c.Limits) > 0 || c.Breaker.Failures > 0) && c.Breaker.Cooldown <= 0 {
+		return Config{}, fmt.Errorf("guardrail breaker: cooldown must be positive")
+	}
+	return c, nil
+}
+
+// Project returns the project a target resource lives in, "_" if none.
+func Project(target string) string {
+	if p := shared.Project(target); p != "" {
+		return p
+	}
+	return "_"
+}
+
+// ProtectedBy returns the first protected rule matching f.
+func (c Config) ProtectedBy(f match.Fields) (string, bool) {
+	for _, p := range c.Protected {
+		if match.All(p.When, f) {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// Key returns the state document id the limit counts action in project
+// under, and whether the limit applies to action at all.
+func (l Limit) Key(action, project string) (string, bool) {
+	if l.Action != "" && l.Action != "*" && l.Action != action {
+		return "", false
+	}
+	switch l.Per {
+	case PerAction:
+		return "limit:" + l.Name + ":" + action, true
+	case PerProject:
+		return "limit:" + l.Name + ":" + project, true
+	default:
+		return "limit:" + l.Name + ":" + action + ":" + project, true
+	}
+}
+
+// Check reports why the limit holds the next action, opening it for
+// cooldown when the window is already full. An empty reason means the
+// action may run; Record then counts it.
+func (l Limit) Check(st *State, now time.Time, cooldown time.Duration) string {
+	if st.IsOpen(now) {
+		return st.Reason
+	}
+	st.prune(now.Add(-time.Duration(l.Window)))
+	if len(st.Hits) < l.Max {
+		return ""
+	}
+	st.open(now, cooldown, fmt.Sprintf("rate limit %s: %d automated action(s) for %s within %s",
+		l.Name, len(st.Hits), strings.TrimPrefix(st.Key, "limit:"+l.Name+":"), time.Duration(l.Window)))
+	return st.Reason
+}
+
+// Record counts an action that ran without approval.
+func (st *State) Record(now time.Time) {
+	st.Hits = append(st.Hits, now)
+	if len(st.Hits) > maxHits {
+		st.Hits = st.Hits[len(st.Hits)-maxHits:]
+	}
+	st.Updated = now
+}
+
+// Key returns the breaker's state document id for action.
+func (b Breaker) Key(action string) string {
+	return "breaker:" + action
+}
+
+// Fail counts a dead automated action and reports whether it opened the
+// breaker.
+func (b Breaker) Fail(st *State, now time.Time) bool {
+	if b.Failures <= 0 || st.IsOpen(now) {
+		return false
+	}
+	st.prune(now.Add(-time.Duration(b.Window)))
+	st.Record(now)
+	if len(st.Hits) < b.Failures {
+		return false
+	}
+	st.open(now, time.Duration(b.Cooldown), fmt.Sprintf("circuit breaker: %d %s action(s) failed within %s",
+		len(st.Hits), strings.TrimPrefix(st.Key, "breaker:"), time.Duration(b.Window)))
+	return true
+}
+
+// IsOpen reports whether the state is holding actions for approval.
+func (st *State) IsOpen(now time.Time) bool {
+	return st.OpenUntil != nil && now.Before(*st.OpenUntil)
+}
+
+func (st *State) open(now time.Time, cooldown time.Duration, reason string) {
+	until := now.Add(cooldown)
+	st.OpenUntil, st.Reason, st.Hits, st.Updated = &until, reason, nil, now
+}
+
+func (st *State) prune(cutoff time.Time) {
+	kept := st.Hits[:0]
+	for _, t := range st.Hits {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	st.Hits = kept
+}
@@ -0,0 +1,144 @@
+package intel
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfidence is used when a feed does not carry one.
+const defaultConfidence = 50
+
+// stixComparison pulls `object:property = 'value'` pairs out of a STIX pattern.
+var stixComparison = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name|email-addr|autonomous-system):(?:value|number)\s*=\s*'?([^'\]\s]+)'?`)
+
+type stixBundle struct {
+	Type    string       `json:"type"`
+	Objects []stixObject `json:"objects"`
+}
+
+type stixObject struct {
+	Type        string     `json:"type"`
+	Name        string     `json:"name"`
+	Pattern     string     `json:"pattern"`
+	PatternType string     `json:"pattern_type"`
+	Confidence  *int       `json:"confidence"`
+	ValidUntil  *time.Time `json:"valid_until"`
+	Revoked     bool       `json:"revoked"`
+}
+
+// LoadFile loads a feed by extension: .json as a STIX 2.1 bundle, .csv as a
+// simple type,value[,confidence] list. Source defaults to the file name.
+func (s *Store) LoadFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	source := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return s.LoadSTIX(f, source)
+	case ".csv":
+		return s.LoadCSV(f, source)
+	default:
+		return 0, fmt.Errorf("unsupported feed format: %s", path)
+	}
+}
+
+// LoadSTIX indexes indicator objects from a STIX 2.1 bundle. Expired or
+// revoked indicators and non-STIX patterns are skipped.
+func (s *Store) LoadSTIX(r io.Reader, source string) (int, error) {
+	var b stixBundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return 0, fmt.Errorf("stix decode: %w", err)
+	}
+	if b.Type != "bundle" {
+		return 0, fmt.Errorf("stix: expected bundle, got %q", b.Type)
+	}
+
+	now := time.Now().UTC()
+	added := 0
+	for _, o := range b.Objects {
+		if o.Type != "indicator" || o.Revoked {
+			continue
+		}
+		if o.PatternType != "" && o.PatternType != "stix" {
+			continue
+		}
+		if o.ValidUntil != nil && o.ValidUntil.Before(now) {
+			continue
+		}
+		conf := defaultConfidence
+		if o.Confidence != nil {
+			conf = *o.Confidence
+		}
+		for _, m := range stixComparison.FindAllStringSubmatch(o.Pattern, -1) {
+			ind := Indicator{Value: m[2], Source: source, Confidence: conf}
+			switch m[1] {
+			case "ipv4-addr", "ipv6-addr":
+				ind.Type = TypeIP
+				if strings.Contains(m[2], "/") {
+					ind.Type = TypeCIDR
+				}
+			case "domain-name":
+				ind.Type = TypeDomain
+			case "email-addr":
+				ind.Type = TypeEmail
+			case "autonomous-system":
+				ind.Type = TypeASN
+			}
+			if s.Add(ind) {
+				added++
+			}
+		}
+	}
+	return added, nil
+}
+
+// LoadCSV indexes rows of type,value[,confidence]. Blank lines, comments (#)
+// and a leading header row are ignored.
+func (s *Store) LoadCSV(r io.Reader, source string) (int, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	added := 0
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return added, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		typ := Type(strings.ToLower(strings.TrimSpace(rec[0])))
+		if line == 1 && typ == "type" {
+			continue
+		}
+		conf := defaultConfidence
+		if len(rec) > 2 && strings.TrimSpace(rec[2]) != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(rec[2]))
+			if err != nil {
+				return added, fmt.Errorf("csv line %d: bad confidence %q", line, rec[2])
+			}
+			conf = n
+		}
+		if s.Add(Indicator{Type: typ, Value: rec[1], Source: source, Confidence: conf}) {
+			added++
+		}
+	}
+	return added, nil
+}
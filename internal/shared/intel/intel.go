@@ -0,0 +1,235 @@
+package intel
+
+import (
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+type Type string
+
+const (
+	TypeIP     Type = "ip"
+	TypeCIDR   Type = "cidr"
+	TypeASN    Type = "asn"
+	TypeDomain Type = "domain"
+	TypeEmail  Type = "email"
+)
+
+// Indicator is a single observable from a feed.
+type Indicator struct {
+	Type       Type   `json:"type"`
+	Value      string `json:"value"`
+	Source     string `json:"source"`
+	Confidence int    `json:"confidence"` // 0..100
+}
+
+// Match records which event field hit which indicator.
+type Match struct {
+	Type       Type   `json:"type" firestore:"type"`
+	Value      string `json:"value" firestore:"value"`
+	Source     string `json:"source" firestore:"source"`
+	Confidence int    `json:"confidence" firestore:"confidence"`
+	Field      string `json:"field" firestore:"field"`       // network | principal | description
+	Observed   string `json:"observed" firestore:"observed"` // value seen on the event
+}
+
+var asnRe = regexp.MustCompile(`\bAS(\d+)\b`)
+
+// node is a binary trie node keyed on address bits.
+type node struct {
+	child [2]*node
+	inds  []Indicator
+}
+
+// Store holds indicators indexed for lookup. Not safe for concurrent writes;
+// load everything at startup, then match from many goroutines.
+type Store struct {
+	v4      *node
+	v6      *node
+	asns    map[uint32][]Indicator
+	domains map[string][]Indicator
+	emails  map[string][]Indicator
+	n       int
+}
+
+// NewStore creates an empty indicator store.
+func NewStore() *Store {
+	return &Store{
+		v4:      &node{},
+		v6:      &node{},
+		asns:    make(map[uint32][]Indicator),
+		domains: make(map[string][]Indicator),
+		emails:  make(map[string][]Indicator),
+	}
+}
+
+// Len returns the number of indicators loaded.
+func (s *Store) Len() int { return s.n }
+
+// Add normalizes and indexes an indicator. Unparseable values are reported
+// as false and skipped.
+func (s *Store) Add(ind Indicator) bool {
+	v := strings.TrimSpace(ind.Value)
+	switch ind.Type {
+	case TypeIP, TypeCIDR:
+		p, ok := parsePrefix(v)
+		if !ok {
+			return false
+		}
+		root := s.v4
+		if !p.Addr().Is4() {
+			root = s.v6
+		}
+		insert(root, p, ind)
+	case TypeASN:
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 32)
+		if err != nil {
+			return false
+		}
+		s.asns[uint32(n)] = append(s.asns[uint32(n)], ind)
+	case TypeDomain:
+		d := strings.TrimSuffix(strings.ToLower(v), ".")
+		if d == "" {
+			return false
+		}
+		s.domains[d] = append(s.domains[d], ind)
+	case TypeEmail:
+		e := strings.ToLower(v)
+		if !strings.Contains(e, "@") {
+			return false
+		}
+		s.emails[e] = append(s.emails[e], ind)
+	default:
+		return false
+	}
+	s.n++
+	return true
+}
+
+// Match checks the event's network, principal and description against the store.
+func (s *Store) Match(ev shared.Event) []Match {
+	var out []Match
+
+	if p, ok := parsePrefix(ev.Network); ok {
+		root := s.v4
+		if !p.Addr().Is4() {
+			root = s.v6
+		}
+		for _, ind := range lookup(root, p) {
+			out = append(out, newMatch(ind, "network", ev.Network))
+		}
+	}
+
+	if email := principalEmail(ev.Principal); email != "" {
+		for _, ind := range s.emails[email] {
+			out = append(out, newMatch(ind, "principal", ev.Principal))
+		}
+		domain := email[strings.LastIndex(email, "@")+1:]
+		for _, ind := range s.matchDomain(domain) {
+			out = append(out, newMatch(ind, "principal", ev.Principal))
+		}
+	}
+
+	for _, m := range asnRe.FindAllStringSubmatch(ev.Description, -1) {
+		n, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		for _, ind := range s.asns[uint32(n)] {
+			out = append(out, newMatch(ind, "description", m[0]))
+		}
+	}
+	return out
+}
+
+// matchDomain walks from the full domain up to its parents.
+func (s *Store) matchDomain(d string) []Indicator {
+	var out []Indicator
+	for d != "" {
+		out = append(out, s.domains[d]...)
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return out
+}
+
+func newMatch(ind Indicator, field, observed string) Match {
+	return Match{
+		Type:       ind.Type,
+		Value:      ind.Value,
+		Source:     ind.Source,
+		Confidence: ind.Confidence,
+		Field:      field,
+		Observed:   observed,
+	}
+}
+
+// principalEmail strips IAM member prefixes (user:, serviceAccount:, ...).
+func principalEmail(p string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if i := strings.IndexByte(p, ':'); i >= 0 {
+		p = p[i+1:]
+	}
+	if !strings.Contains(p, "@") {
+		return ""
+	}
+	return p
+}
+
+func parsePrefix(v string) (netip.Prefix, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return netip.Prefix{}, false
+	}
+	if strings.Contains(v, "/") {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		return p.Masked(), true
+	}
+	a, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(a, a.BitLen()), true
+}
+
+func bit(b []byte, i int) int {
+	return int(b[i/8]>>(7-uint(i%8))) & 1
+}
+
+func insert(root *node, p netip.Prefix, ind Indicator) {
+	b := p.Addr().AsSlice()
+	n := root
+	for i := 0; i < p.Bits(); i++ {
+		c := bit(b, i)
+		if n.child[c] == nil {
+			n.child[c] = &node{}
+		}
+		n = n.child[c]
+	}
+	n.inds = append(n.inds, ind)
+}
+
+// lookup returns indicators whose prefix covers p.
+func lookup(root *node, p netip.Prefix) []Indicator {
+	b := p.Addr().AsSlice()
+	n := root
+	out := append([]Indicator(nil), n.inds...)
+	for i := 0; i < p.Bits(); i++ {
+		n = n.child[bit(b, i)]
+		if n == nil {
+			break
+		}
+		out = append(out, n.inds...)
+	}
+	return out
+}
@@ -0,0 +1,421 @@
+// Package jira opens Jira issues for alerts and keeps them in step with
+// the alert lifecycle over the Jira REST API (v2 or v3).
+package jira
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Policy opens an issue for alerts whose fields match When.
+type Policy struct {
+	Name string       `json:"name"`
+	When []match.Cond `json:"when"`
+}
+
+// Mapping says how issues for alerts in some GCP projects are filed.
+// Summary, Description and string values in Fields expand ${field} from
+// the alert fields.
+type Mapping struct {
+	Projects    []string          `json:"projects,omitempty"` // GCP projects; empty: any
+	JiraProject string            `json:"jira_project"`
+	IssueType   string            `json:"issue_type,omitempty"` // default Task
+	Priorities  map[string]string `json:"priorities,omitempty"` // severity -> Jira priority name
+	Labels      []string          `json:"labels,omitempty"`
+	Components  []string          `json:"components,omitempty"`
+	Summary     string            `json:"summary,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Fields      map[string]any    `json:"fields,omitempty"` // extra fields, e.g. customfield_10010
+}
+
+// Config is the Jira file (JIRA_FILE).
+type Config struct {
+	BaseURL     string `json:"base_url"`
+	APIVersion  string `json:"api_version,omitempty"` // "3" (default, Cloud) or "2"
+	User        string `json:"user,omitempty"`        // with the token: basic auth (Cloud); without: bearer PAT
+	TokenSecret string `json:"token_secret,omitempty"`
+	Token       string `json:"token,omitempty"` // development only
+
+	// secret id of the Jira webhook secret api-go checks X-Hub-Signature with
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	Policies []Policy  `json:"policies"`
+	Projects []Mapping `json:"projects"`
+	// transition applied when the alert is closed in sentinelflow
+	ResolveTransition string `json:"resolve_transition,omitempty"` // default Done
+}
+
+// LoadConfig reads and validates a Jira file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if _, err := url.ParseRequestURI(c.BaseURL); err != nil {
+		return Config{}, fmt.Errorf("jira: base_url: %w", err)
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	switch c.APIVersion {
+	case "":
+		c.APIVersion = "3"
+	case "2", "3":
+	default:
+		return Config{}, fmt.Errorf("jira: api_version must be 2 or 3")
+	}
+	if c.Token == "" && c.TokenSecret == "" {
+		return Config{}, fmt.Errorf("jira: token_secret is required")
+	}
+	if c.ResolveTransition == "" {
+		c.ResolveTransition = "Done"
+	}
+	for _, p := range c.Policies {
+		if err := match.ValidateAll(p.When); err != nil {
+			return Config{}, fmt.Errorf("jira policy %s: %w", p.Name, err)
+		}
+	}
+	if len(c.Projects) == 0 {
+		return Config{}, fmt.Errorf("jira: at least one project mapping is required")
+	}
+	for _, m := range c.Projects {
+		if m.JiraProject == "" {
+			return Config{}, fmt.Errorf("jira project mapping: jira_project is required")
+		}
+	}
+	return c, nil
+}
+
+// Wants returns the first policy matching the alert fields f.
+func (c Config) Wants(f match.Fields) (string, bool) {
+	for _, p := range c.Policies {
+		if match.All(p.When, f) {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// MappingFor returns the mapping for a GCP project: the first listing it,
+// else the first listing none.
+func (c Config) MappingFor(project string) (Mapping, bool) {
+	var fallback *Mapping
+	for i, m := range c.Projects {
+		if len(m.Projects) == 0 {
+			if fallback == nil {
+				fallback = &c.Projects[i]
+			}
+			continue
+		}
+		for _, p := range m.Projects {
+			if p == project {
+				return m, true
+			}
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Mapping{}, false
+}
+
+// SecretFunc resolves a Secret Manager secret id to its latest value.
+type SecretFunc func(ctx context.Context, id string) (string, error)
+
+// Client talks to one Jira site.
+type Client struct {
+	cfg     Config
+	secrets SecretFunc
+	http    *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewClient returns a client for c; secrets resolves its token.
+func NewClient(c Config, secrets SecretFunc) *Client {
+	return &Client{cfg: c, secrets: secrets, http: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Config returns the client's configuration.
+func (c *Client) Config() Config { return c.cfg }
+
+// IssueURL is the browse link of an issue.
+func (c *Client) IssueURL(key string) string {
+	return c.cfg.BaseURL + "/browse/" + key
+}
+
+// Create files an issue under m for an alert with fields f and returns its
+// key.
+func (c *Client) Create(ctx context.Context, m Mapping, f match.Fields) (string, error) {
+	summary := expand(m.Summary, f)
+	if summary == "" {
+		summary = fmt.Sprintf("[%s] %s on %s", f["severity"], f["event_type"], f["target"])
+	}
+	desc := expand(m.Description, f)
+	if desc == "" {
+		desc = fmt.Sprintf("sentinelflow alert %s\nEvent: %s\nPrincipal: %s\nTarget: %s\nSeverity: %s\nReasons: %s",
+			f["alert_id"], f["event_type"], f["principal"], f["target"], f["severity"], f["reason_tokens"])
+	}
+	issueType := m.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": m.JiraProject},
+		"issuetype":   map[string]string{"name": issueType},
+		"summary":     oneLine(summary, 255),
+		"description": c.body(desc),
+	}
+	if p := m.Priorities[f["severity"]]; p != "" {
+		fields["priority"] = map[string]string{"name": p}
+	}
+	// the alert label lets a retry find an issue whose key was never stored
+	fields["labels"] = append(slices.Clone(m.Labels), AlertLabel(f["alert_id"]))
+	if len(m.Components) > 0 {
+		var cs []map[string]string
+		for _, n := range m.Components {
+			cs = append(cs, map[string]string{"name": n})
+		}
+		fields["components"] = cs
+	}
+	for k, v := range m.Fields {
+		if s, ok := v.(string); ok {
+			v = expand(s, f)
+		}
+		fields[k] = v
+	}
+	var out struct {
+		Key string `json:"key"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/issue", map[string]any{"fields": fields}, &out); err != nil {
+		return "", err
+	}
+	if out.Key == "" {
+		return "", errors.New("jira: create returned no issue key")
+	}
+	return out.Key, nil
+}
+
+// AlertLabel is the label every issue filed for alertID carries.
+func AlertLabel(alertID string) string {
+	return "sentinelflow-" + strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-') {
+			return r
+		}
+		return '-'
+	}, alertID)
+}
+
+// FindByLabel returns the key of an issue carrying label, or "" if none
+// does.
+func (c *Client) FindByLabel(ctx context.Context, label string) (string, error) {
+	path := "/search"
+	if c.cfg.APIVersion == "3" {
+		path = "/search/jql"
+	}
+	q := url.Values{"jql": {fmt.Sprintf("labels = %q", label)}, "fields": {"key"}, "maxResults": {"1"}}
+	var out struct {
+		Issues []struct {
+			Key string `json:"key"`
+		} `json:"issues"`
+	}
+	if err := c.do(ctx, http.MethodGet, path+"?"+q.Encode(), nil, &out); err != nil {
+		return "", err
+	}
+	if len(out.Issues) == 0 {
+		return "", nil
+	}
+	return out.Issues[0].Key, nil
+}
+
+// Comment adds a comment to an issue.
+func (c *Client) Comment(ctx context.Context, key, text string) error {
+	return c.do(ctx, http.MethodPost, "/issue/"+url.PathEscape(key)+"/comment", map[string]any{"body": c.body(text)}, nil)
+}
+
+// ErrNoTransition is returned when an issue has no transition by that name
+// from its current status, e.g. because it is already closed.
+var ErrNoTransition = errors.New("jira: no such transition from the issue's status")
+
+// Transition moves an issue through the transition named name, or the one
+// leading to a status of that name.
+func (c *Client) Transition(ctx context.Context, key, name string) error {
+	var ts struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	path := "/issue/" + url.PathEscape(key) + "/transitions"
+	if err := c.do(ctx, http.MethodGet, path, nil, &ts); err != nil {
+		return err
+	}
+	for _, t := range ts.Transitions {
+		if strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name) {
+			return c.do(ctx, http.MethodPost, path, map[string]any{"transition": map[string]string{"id": t.ID}}, nil)
+		}
+	}
+	return fmt.Errorf("%w: %s on %s", ErrNoTransition, name, key)
+}
+
+// body is text in the format the API version takes: a string for v2, an
+// Atlassian document for v3.
+func (c *Client) body(text string) any {
+	if c.cfg.APIVersion == "2" {
+		return text
+	}
+	var paras []map[string]any
+	for _, line := range strings.Split(text, "\n") {
+		p := map[string]any{"type": "paragraph"}
+		if line != "" {
+			p["content"] = []map[string]any{{"type": "text", "text": line}}
+		}
+		paras = append(paras, p)
+	}
+	return map[string]any{"type": "doc", "version": 1, "content": paras}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	tok, err := c.secret(ctx)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if in != nil {
+		b, _ := json.Marshal(in)
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+"/rest/api/"+c.cfg.APIVersion+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.User != "" {
+		req.SetBasicAuth(c.cfg.User, tok)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("jira %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("jira %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (c *Client) secret(ctx context.Context) (string, error) {
+	if c.cfg.Token != "" {
+		return c.cfg.Token, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	if c.secrets == nil {
+		return "", errors.New("jira: no secret lookup configured")
+	}
+	v, err := c.secrets(ctx, c.cfg.TokenSecret)
+	if err != nil {
+		return "", fmt.Errorf("jira token secret %s: %w", c.cfg.TokenSecret, err)
+	}
+	c.token = strings.TrimSpace(v)
+	return c.token, nil
+}
+
+// WebhookEvent is the part of a Jira issue webhook we use.
+type WebhookEvent struct {
+	WebhookEvent string `json:"webhookEvent"` // jira:issue_updated, ...
+	User         struct {
+		DisplayName  string `json:"displayName"`
+		EmailAddress string `json:"emailAddress"`
+	} `json:"user"`
+	Issue struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Status struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"` // new | indeterminate | done
+				} `json:"statusCategory"`
+			} `json:"status"`
+			Resolution *struct {
+				Name string `json:"name"`
+			} `json:"resolution"`
+		} `json:"fields"`
+	} `json:"issue"`
+}
+
+// Closed reports whether the issue is in a done status.
+func (e WebhookEvent) Closed() bool {
+	return e.Issue.Fields.Status.StatusCategory.Key == "done"
+}
+
+// Actor names who changed the issue.
+func (e WebhookEvent) Actor() string {
+	who := e.User.EmailAddress
+	if who == "" {
+		who = e.User.DisplayName
+	}
+	if who == "" {
+		who = "unknown"
+	}
+	return "jira:" + who
+}
+
+// VerifySignature checks a webhook's X-Hub-Signature ("sha256=<hex HMAC of
+// the body>") against secret.
+func VerifySignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(sig))
+}
+
+func expand(s string, f match.Fields) string {
+	return os.Expand(s, func(k string) string { return f[k] })
+}
+
+func oneLine(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > limit {
+		s = strings.ToValidUTF8(s[:limit-1], "") + "…"
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Alert statuses.
+const (
+	StatusTriaged          = "triaged"
+	StatusReviewed         = "reviewed" // automated review found nothing to do
+	StatusAwaitingApproval = "awaiting_approval"
+	StatusActionExecuted   = "action_executed"
+	StatusAcknowledged     = "acknowledged"
+	StatusInProgress       = "in_progress"
+	StatusResolved         = "resolved"
+	StatusFalsePositive    = "false_positive"
+	StatusSuppressed       = "suppressed"
+	StatusRejected         = "rejected" // proposed action declined by an approver
+)
+
+var (
+	ErrNotFound   = errors.New("alert not found")
+	ErrNotAllowed = errors.New("transition not allowed")
+)
+
+// transitions lists the statuses reachable from each status.
+var transitions = map[string][]string{
+	StatusTriaged: {StatusReviewed, StatusAwaitingApproval, StatusActionExecuted, StatusAcknowledged,
+		StatusInProgress, StatusResolved, StatusFalsePositive, StatusSuppressed},
+	// a later playbook step (or an escalated repeat) can still act or ask
+	// for approval after an earlier one
+	StatusReviewed:         {StatusAwaitingApproval, StatusActionExecuted, StatusAcknowledged, StatusInProgress, StatusResolved, StatusFalsePositive},
+	StatusAwaitingApproval: {StatusActionExecuted, StatusRejected, StatusAcknowledged, StatusInProgress, StatusResolved, StatusFalsePositive},
+	StatusActionExecuted:   {StatusAwaitingApproval, StatusAcknowledged, StatusInProgress, StatusResolved, StatusFalsePositive},
+	StatusAcknowledged:     {StatusInProgress, StatusAwaitingApproval, StatusActionExecuted, StatusResolved, StatusFalsePositive},
+	StatusInProgress:       {StatusAwaitingApproval, StatusActionExecuted, StatusResolved, StatusFalsePositive},
+	// reopen
+	StatusResolved:      {StatusTriaged, StatusAcknowledged, StatusInProgress},
+	StatusFalsePositive: {StatusTriaged, StatusAcknowledged, StatusInProgress},
+	StatusRejected:      {StatusTriaged, StatusAcknowledged, StatusInProgress},
+	StatusSuppressed:    {StatusTriaged, StatusResolved},
+}
+
+// Transition is one entry in an alert's history.
+type Transition struct {
+	From   string    `json:"from" firestore:"from"`
+	To     string    `json:"to" firestore:"to"`
+	By     string    `json:"by" firestore:"by"`
+	Reason string    `json:"reason,omitempty" firestore:"reason"`
+	At     time.Time `json:"at" firestore:"at"`
+}
+
+// Normalize maps legacy status names onto the state machine.
+func Normalize(s string) string {
+	if s == "pending" || s == "" {
+		return StatusTriaged
+	}
+	return s
+}
+
+// Known reports whether s is a status of the state machine.
+func Known(s string) bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Manual reports whether a person may move an alert to s by hand: triage
+// work, closing it, or reopening it (triaged). The other statuses are set
+// by the response workflow only.
+func Manual(s string) bool {
+	switch s {
+	case StatusTriaged, StatusAcknowledged, StatusInProgress, StatusResolved, StatusFalsePositive:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether from → to is allowed.
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[Normalize(from)] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether the alert is closed (it can still be reopened).
+func IsTerminal(s string) bool {
+	switch Normalize(s) {
+	case StatusResolved, StatusFalsePositive, StatusSuppressed, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// Initial returns the document fields for a freshly created alert.
+func Initial(status, by string, now time.Time) map[string]any {
+	return map[string]any{
+		"status":  status,
+		"updated": now,
+		"history": []Transition{{To: status, By: by, At: now}},
+	}
+}
+
+// Apply moves the alert at ref to status `to` inside a transaction, stamping
+// `updated` and appending to `history`. extra updates are written in the same
+// transaction. Moving to the current status is a no-op. It returns the
+// status the alert was in.
+func Apply(ctx context.Context, client *firestore.Client, ref *firestore.DocumentRef, to, by, reason string, extra ...firestore.Update) (string, error) {
+	var from string
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return ErrNotFound
+		}
+		cur, _ := snaps[0].Data()["status"].(string)
+		from = Normalize(cur)
+		if from == to {
+			return nil
+		}
+		updates, err := Updates(from, to, by, reason)
+		if err != nil {
+			return err
+		}
+		return tx.Update(ref, append(updates, extra...))
+	})
+	return from, err
+}
+
+// Updates returns the document updates that move an alert from status
+// `from` to `to`, for callers that change the alert inside a transaction of
+// their own. It fails with ErrNotAllowed if the transition is not allowed.
+func Updates(from, to, by, reason string) ([]firestore.Update, error) {
+	from = Normalize(from)
+	if !CanTransition(from, to) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrNotAllowed, from, to)
+	}
+	now := time.Now().UTC()
+	return []firestore.Update{
+		{Path: "status", Value: to},
+		{Path: "updated", Value: now},
+		{Path: "history", Value: firestore.ArrayUnion(Transition{From: from, To: to, By: by, Reason: reason, At: now})},
+	}, nil
+}
+
+// Note appends a history entry that does not change status (e.g. a reminder
+// or escalation), stamping `updated`.
+func Note(ctx context.Context, client *firestore.Client, ref *firestore.DocumentRef, by, reason string) error {
+	return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return ErrNotFound
+		}
+		cur, _ := snaps[0].Data()["status"].(string)
+		cur = Normalize(cur)
+		now := time.Now().UTC()
+		return tx.Update(ref, []firestore.Update{
+			{Path: "updated", Value: now},
+			{Path: "history", Value: firestore.ArrayUnion(Transition{From: cur, To: cur, By: by, Reason: reason, At: now})},
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package match
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+// Fields is a flat view of an event (plus any triage features) that rule
+// conditions are evaluated against.
+type Fields map[string]string
+
+// EventFields returns the event attributes keyed by their JSON names.
+func EventFields(ev shared.Event) Fields {
+	f := Fields{}
+	for _, k := range []string{"id", "event_type", "principal", "target", "network", "severity_hint", "labels", "description", "project"} {
+		f[k] = ev.Field(k)
+	}
+	return f
+}
+
+// Cond is a single field comparison. Ops: eq, ne, contains, prefix, suffix,
+// in, not_in, has (comma-separated list membership, e.g. labels), regex,
+// exists, gt, gte, lt, lte.
+type Cond struct {
+	Field  string   `json:"field" firestore:"field"`
+	Op     string   `json:"op" firestore:"op"`
+	Value  string   `json:"value,omitempty" firestore:"value,omitempty"`
+	Values []string `json:"values,omitempty" firestore:"values,omitempty"`
+}
+
+var (
+	reMu    sync.Mutex
+	reCache = map[string]*regexp.Regexp{}
+)
+
+// Validate checks the op is known and its operand is usable.
+func (c Cond) Validate() error {
+	if c.Field == "" {
+		return fmt.Errorf("condition missing field")
+	}
+	switch c.Op {
+	case "eq", "ne", "contains", "prefix", "suffix", "has", "exists":
+	case "in", "not_in":
+		if len(c.Values) == 0 {
+			return fmt.Errorf("condition on %s: %s needs values", c.Field, c.Op)
+		}
+	case "regex":
+		if _, err := compile(c.Value); err != nil {
+			return fmt.Errorf("condition on %s: %w", c.Field, err)
+		}
+	case "gt", "gte", "lt", "lte":
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+			return fmt.Errorf("condition on %s: %s needs a number", c.Field, c.Op)
+		}
+	default:
+		return fmt.Errorf("condition on %s: unknown op %q", c.Field, c.Op)
+	}
+	return nil
+}
+
+// Match evaluates the condition. String comparisons are case-insensitive.
+func (c Cond) Match(f Fields) bool {
+	v, ok := f[c.Field]
+	lv, lw := strings.ToLower(v), strings.ToLower(c.Value)
+	switch c.Op {
+	case "exists":
+		return ok && v != ""
+	case "eq":
+		return lv == lw
+	case "ne":
+		return lv != lw
+	case "contains":
+		return strings.Contains(lv, lw)
+	case "prefix":
+		return strings.HasPrefix(lv, lw)
+	case "suffix":
+		return strings.HasSuffix(lv, lw)
+	case "in":
+		return inList(lv, c.Values)
+	case "not_in":
+		return !inList(lv, c.Values)
+	case "has":
+		for _, item := range strings.Split(lv, ",") {
+			if strings.TrimSpace(item) == lw {
+				return true
+			}
+		}
+		return false
+	case "regex":
+		re, err := compile(c.Value)
+		return err == nil && re.MatchString(v)
+	case "gt", "gte", "lt", "lte":
+		a, err1 := strconv.ParseFloat(v, 64)
+		b, err2 := strconv.ParseFloat(c.Value, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch c.Op {
+		case "gt":
+			return a > b
+		case "gte":
+			return a >= b
+		case "lt":
+			return a < b
+		default:
+			return a <= b
+		}
+	}
+	return false
+}
+
+// All reports whether every condition matches (true for none).
+func All(conds []Cond, f Fields) bool {
+	for _, c := range conds {
+		if !c.Match(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateAll validates each condition.
+func ValidateAll(conds []Cond) error {
+	for _, c := range conds {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inList(v string, list []string) bool {
+	for _, s := range list {
+		if strings.ToLower(s) == v {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	reMu.Lock()
+	defer reMu.Unlock()
+	if re, ok := reCache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	reCache[expr] = re
+	return re, nil
+}
@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// smtpTimeout bounds one email delivery, from dial to QUIT.
+const smtpTimeout = 15 * time.Second
+
+// secretTTL is how long a resolved secret is cached, so a rotated webhook
+// URL or password is picked up without a restart.
+const secretTTL = 10 * time.Minute
+
+// New returns the Notifier for a channel.
+func New(c Channel, secrets SecretFunc) Notifier {
+	s := &secret{id: c.Secret, lookup: secrets}
+	switch c.Type {
+	case TypeEmail:
+		return Email{Channel: c, password: s}
+	case TypeTeams:
+		return Teams{url: urlFrom(c, s)}
+	case TypeWebhook:
+		return Webhook{url: urlFrom(c, s), headers: c.Headers}
+	case TypePagerDuty:
+		return PagerDuty{url: endpoint(c.URL, pagerDutyURL), key: keyFrom(c, s)}
+	case TypeOpsgenie:
+		return Opsgenie{url: endpoint(c.URL, opsgenieURL), key: keyFrom(c, s)}
+	default:
+		return Slack{url: urlFrom(c, s)}
+	}
+}
+
+// Slack posts to an incoming webhook.
+type Slack struct {
+	url func(context.Context) (string, error)
+}
+
+func (n Slack) Notify(ctx context.Context, m Message) error {
+	body := map[string]any{"text": m.Text}
+	if len(m.Buttons) > 0 {
+		body["blocks"] = SlackBlocks(m.Text, "", m.Buttons)
+	}
+	return postJSON(ctx, n.url, nil, body)
+}
+
+// maxSectionText is Slack's limit on a section block's text.
+const maxSectionText = 3000
+
+// SlackBlocks lays out a message as Block Kit blocks: the text, an optional
+// context line (e.g. the outcome of a button) and the buttons.
+func SlackBlocks(text, note string, buttons []Button) []map[string]any {
+	if len(text) > maxSectionText {
+		text = strings.ToValidUTF8(text[:maxSectionText-3], "") + "..."
+	}
+	blocks := []map[string]any{
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": text}},
+	}
+	if note != "" {
+		blocks = append(blocks, map[string]any{"type": "context", "elements": []map[string]any{{"type": "mrkdwn", "text": note}}})
+	}
+	if len(buttons) > 0 {
+		elems := make([]map[string]any, 0, len(buttons))
+		for _, b := range buttons {
+			e := map[string]any{
+				"type":      "button",
+				"action_id": b.ID,
+				"value":     b.Value,
+				"text":      map[string]any{"type": "plain_text", "text": b.Text},
+			}
+			if b.Style != "" {
+				e["style"] = b.Style
+			}
+			elems = append(elems, e)
+		}
+		blocks = append(blocks, map[string]any{"type": "actions", "elements": elems})
+	}
+	return blocks
+}
+
+// Teams posts a message card to an incoming webhook.
+type Teams struct {
+	url func(context.Context) (string, error)
+}
+
+func (n Teams) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, n.url, nil, map[string]any{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  m.Subject(),
+		"title":    m.Subject(),
+		"text":     m.Text,
+	})
+}
+
+// Webhook posts the message as JSON, with optional extra headers.
+type Webhook struct {
+	url     func(context.Context) (string, error)
+	headers map[string]string
+}
+
+func (n Webhook) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, n.url, n.headers, m)
+}
+
+// Email sends plain-text mail over SMTP, with STARTTLS when the server
+// offers it and PLAIN auth when User is set.
+type Email struct {
+	Channel
+	password *secret
+}
+
+func (n Email) Notify(ctx context.Context, m Message) error {
+	var auth smtp.Auth
+	if n.User != "" {
+		pw, err := n.password.value(ctx)
+		if err != nil {
+			return err
+		}
+		host, _, _ := strings.Cut(n.SMTP, ":")
+		auth = smtp.PlainAuth("", n.User, pw, host)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", oneLine(m.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return sendMail(ctx, n.SMTP, auth, n.From, n.To, b.Bytes())
+}
+
+// sendMail is smtp.SendMail bounded by ctx and smtpTimeout, so a stalled
+// server cannot hold up the request that sends the notification.
+func sendMail(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	// a cancelled ctx ends the session at once
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server does not support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func urlFrom(c Channel, s *secret) func(context.Context) (string, error) {
+	if c.URL != "" {
+		return func(context.Context) (string, error) { return c.URL, nil }
+	}
+	return s.value
+}
+
+func endpoint(u, def string) func(context.Context) (string, error) {
+	if u == "" {
+		u = def
+	}
+	return func(context.Context) (string, error) { return u, nil }
+}
+
+func keyFrom(c Channel, s *secret) func(context.Context) (string, error) {
+	if c.Key != "" {
+		return func(context.Context) (string, error) { return c.Key, nil }
+	}
+	return s.value
+}
+
+func postJSON(ctx context.Context, url func(context.Context) (string, error), headers map[string]string, body any) error {
+	u, err := url(ctx)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// secret resolves a Secret Manager value and caches it for secretTTL. If a
+// refresh fails, the last value keeps being used until one succeeds.
+type secret struct {
+	id     string
+	lookup SecretFunc
+
+	mu      sync.Mutex
+	val     string
+	fetched time.Time
+}
+
+func (s *secret) value(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.val != "" && time.Since(s.fetched) < secretTTL {
+		return s.val, nil
+	}
+	if s.id == "" || s.lookup == nil {
+		return "", fmt.Errorf("no secret configured")
+	}
+	v, err := s.lookup(ctx, s.id)
+	v = strings.TrimSpace(v)
+	switch {
+	case err == nil && v != "":
+		s.val, s.fetched = v, time.Now()
+	case s.val != "":
+		// keep the last value until a refresh succeeds
+	case err != nil:
+		return "", fmt.Errorf("secret %s: %w", s.id, err)
+	default:
+		return "", fmt.Errorf("secret %s is empty", s.id)
+	}
+	return s.val, nil
+}
@@ -0,0 +1,523 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Event types.
+const (
+	EventApprovalRequested = "approval_requested"
+	EventApprovalRecorded  = "approval_recorded" // one of several approvals
+	EventApprovalGranted   = "approval_granted"
+	EventApprovalRejected  = "approval_rejected" // rejected, changes requested or expired into auto_reject
+	EventApprovalEscalated = "approval_escalated"
+	EventApprovalExpired   = "approval_expired" // expired into auto_execute or left open
+	EventActionExecuted    = "action_executed"
+	EventActionFailed      = "action_failed"
+	EventActionHeld        = "action_held" // a guardrail or freeze wants approval
+	EventActionDeferred    = "action_deferred"
+	EventRollbackRequested = "rollback_requested"
+	EventRolledBack        = "rolled_back"
+	EventGuardrail         = "guardrail"  // tripped, reset, kill switch
+	EventPlaybook          = "playbook"   // notify steps
+	EventEscalation        = "escalation" // notify steps on the escalation channel
+
+	// Alert lifecycle, for paging. These go only where a route sends them,
+	// never to the default channels.
+	EventAlertOpened       = "alert_opened" // a new or escalated alert, or a reopened one
+	EventAlertAcknowledged = "alert_acknowledged"
+	EventAlertResolved     = "alert_resolved" // resolved, false positive, suppressed or rejected
+
+	// Messages a limited channel held back, summarised; sent straight to
+	// that channel, never routed.
+	EventDigest = "digest"
+)
+
+// Events lists the event types.
+var Events = []string{
+	EventApprovalRequested, EventApprovalRecorded, EventApprovalGranted, EventApprovalRejected,
+	EventApprovalEscalated, EventApprovalExpired, EventActionExecuted, EventActionFailed,
+	EventActionHeld, EventActionDeferred, EventRollbackRequested, EventRolledBack,
+	EventGuardrail, EventPlaybook, EventEscalation,
+	EventAlertOpened, EventAlertAcknowledged, EventAlertResolved,
+	EventDigest,
+}
+
+func routedOnly(event string) bool {
+	return event == EventAlertOpened || event == EventAlertAcknowledged || event == EventAlertResolved || event == EventDigest
+}
+
+// Channel types.
+const (
+	TypeSlack   = "slack"
+	TypeEmail   = "email"
+	TypeTeams   = "teams"
+	TypeWebhook = "webhook"
+	// paging services
+	TypePagerDuty = "pagerduty"
+	TypeOpsgenie  = "opsgenie"
+)
+
+// Message is one notification. Fields are the alert fields routing rules
+// and team rules see, when the sender has them.
+type Message struct {
+	Event    string `json:"event"`
+	Severity string `json:"severity,omitempty"`
+	Team     string `json:"team,omitempty"`
+	AlertID  string `json:"alert_id,omitempty"`
+	ActionID string `json:"action_id,omitempty"`
+	// alert fingerprint, the dedup key of pages
+	Fingerprint string       `json:"fingerprint,omitempty"`
+	Title       string       `json:"title,omitempty"` // email subject, card title; derived if empty
+	Text        string       `json:"text"`            // Slack mrkdwn
+	Fields      match.Fields `json:"fields,omitempty"`
+	Buttons     []Button     `json:"buttons,omitempty"` // Slack only
+
+	// what templates see besides the above, when the sender has it
+	Alert  *Alert  `json:"-"`
+	Action *Action `json:"-"`
+	Digest *Digest `json:"-"`
+}
+
+// Button ids, the Block Kit action_id api-go's interactivity endpoint
+// dispatches on.
+const (
+	ButtonApprove = "approve"
+	ButtonReject  = "reject"
+)
+
+// Button is an interactive choice on a Slack message. Value is the id of
+// the action it decides.
+type Button struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Value string `json:"value"`
+	Style string `json:"style,omitempty"` // primary or danger
+}
+
+// ApprovalButtons are Approve and Reject buttons for an action.
+func ApprovalButtons(actionID string) []Button {
+	return []Button{
+		{ID: ButtonApprove, Text: "Approve", Value: actionID, Style: "primary"},
+		{ID: ButtonReject, Text: "Reject", Value: actionID, Style: "danger"},
+	}
+}
+
+// Subject is the message title, or one made from the event and alert.
+func (m Message) Subject() string {
+	if m.Title != "" {
+		return m.Title
+	}
+	s := "[sentinelflow] " + strings.ReplaceAll(m.Event, "_", " ")
+	if m.AlertID != "" {
+		s += " on alert " + m.AlertID
+	}
+	return s
+}
+
+// Notifier delivers a message to one channel.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// SecretFunc resolves a Secret Manager secret id to its latest value.
+type SecretFunc func(ctx context.Context, id string) (string, error)
+
+// Channel configures one destination. URL (slack, teams, webhook) may come
+// from Secret instead; for email Secret holds the SMTP password. Paging
+// channels take their routing or API key from Secret, or from Key in
+// development, and URL overrides the service endpoint. Limit throttles
+// the channel into digests.
+type Channel struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	URL     string            `json:"url,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+	Key     string            `json:"key,omitempty"`     // pagerduty, opsgenie
+	Headers map[string]string `json:"headers,omitempty"` // webhook
+	SMTP    string            `json:"smtp,omitempty"`    // email: host:port
+	From    string            `json:"from,omitempty"`    // email
+	To      []string          `json:"to,omitempty"`      // email
+	User    string            `json:"user,omitempty"`    // email: SMTP auth user
+	Limit   *Limit            `json:"limit,omitempty"`
+}
+
+// Route sends matching messages to Channels. Conditions see the message
+// Fields plus event, severity, team, alert_id and action_id.
+type Route struct {
+	Name     string       `json:"name"`
+	When     []match.Cond `json:"when"`
+	Channels []string     `json:"channels"`
+}
+
+// Team assigns messages whose fields match When to a team.
+type Team struct {
+	Name string       `json:"name"`
+	When []match.Cond `json:"when"`
+}
+
+// Config is the notifications file (NOTIFY_FILE). A message goes to the
+// channels of every matching route, or to Default when none matches.
+type Config struct {
+	Channels []Channel `json:"channels"`
+	Teams    []Team    `json:"teams,omitempty"`
+	Routes   []Route   `json:"routes,omitempty"`
+	Default  []string  `json:"default"`
+	// console base URL digests link alerts to, e.g. https://console.example.com
+	ConsoleURL string `json:"console_url,omitempty"`
+}
+
+// DefaultConfig mirrors the Slack-only setup: everything goes to the
+// webhook in slackSecret and, when escalationSecret is set, escalations
+// are paged there too.
+func DefaultConfig(slackSecret, escalationSecret string) Config {
+	c := Config{
+		Channels: []Channel{{Name: "slack", Type: TypeSlack, Secret: slackSecret}},
+		Default:  []string{"slack"},
+	}
+	if escalationSecret != "" {
+		c.Channels = append(c.Channels, Channel{Name: "escalation", Type: TypeSlack, Secret: escalationSecret})
+		c.Routes = []Route{
+			{Name: "escalations", Channels: []string{"slack", "escalation"},
+				When: []match.Cond{{Field: "event", Op: "in", Values: []string{EventApprovalEscalated, EventApprovalExpired}}}},
+			{Name: "paging", Channels: []string{"escalation"},
+				When: []match.Cond{{Field: "event", Op: "eq", Value: EventEscalation}}},
+		}
+	}
+	return c
+}
+
+// LoadConfig reads and validates a notifications file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return c, c.validate()
+}
+
+func (c Config) validate() error {
+	names := map[string]bool{}
+	for _, ch := range c.Channels {
+		if ch.Name == "" || names[ch.Name] {
+			return fmt.Errorf("notify channel: needs a unique name, got %q", ch.Name)
+		}
+		names[ch.Name] = true
+		switch ch.Type {
+		case TypeSlack, TypeTeams, TypeWebhook:
+			if ch.URL == "" && ch.Secret == "" {
+				return fmt.Errorf("notify channel %s: url or secret is required", ch.Name)
+			}
+		case TypeEmail:
+			if ch.SMTP == "" || ch.From == "" || len(ch.To) == 0 {
+				return fmt.Errorf("notify channel %s: email needs smtp, from and to", ch.Name)
+			}
+		case TypePagerDuty, TypeOpsgenie:
+			if ch.Key == "" && ch.Secret == "" {
+				return fmt.Errorf("notify channel %s: key or secret is required", ch.Name)
+			}
+		default:
+			return fmt.Errorf("notify channel %s: unknown type %q", ch.Name, ch.Type)
+		}
+		if ch.Limit != nil {
+			if ch.Type == TypePagerDuty || ch.Type == TypeOpsgenie {
+				return fmt.Errorf("notify channel %s: paging channels cannot be limited; they already dedupe by fingerprint", ch.Name)
+			}
+			if err := ch.Limit.validate(); err != nil {
+				return fmt.Errorf("notify channel %s: limit: %w", ch.Name, err)
+			}
+		}
+	}
+	known := func(where string, list []string) error {
+		for _, n := range list {
+			if !names[n] {
+				return fmt.Errorf("notify %s: unknown channel %q", where, n)
+			}
+		}
+		return nil
+	}
+	for _, t := range c.Teams {
+		if t.Name == "" {
+			return fmt.Errorf("notify team: name is required")
+		}
+		if err := match.ValidateAll(t.When); err != nil {
+			return fmt.Errorf("notify team %s: %w", t.Name, err)
+		}
+	}
+	for _, r := range c.Routes {
+		if len(r.Channels) == 0 {
+			return fmt.Errorf("notify route %s: no channels", r.Name)
+		}
+		if err := match.ValidateAll(r.When); err != nil {
+			return fmt.Errorf("notify route %s: %w", r.Name, err)
+		}
+		if err := known("route "+r.Name, r.Channels); err != nil {
+			return err
+		}
+	}
+	return known("default", c.Default)
+}
+
+// Delivery is the outcome of sending a message to one channel.
+type Delivery struct {
+	Channel string `json:"channel" firestore:"channel"`
+	Type    string `json:"type" firestore:"type"`
+	OK      bool   `json:"ok" firestore:"ok"`
+	Error   string `json:"error,omitempty" firestore:"error"`
+	// template the text came from; a template that failed to render is
+	// noted in Error and the built-in text sent instead
+	Template string `json:"template,omitempty" firestore:"template"`
+	// held back by the channel's limit for its next digest, not sent
+	Held bool      `json:"held,omitempty" firestore:"held"`
+	At   time.Time `json:"at" firestore:"at"`
+}
+
+// Record is a sent notification with its deliveries, as stored by the
+// services.
+type Record struct {
+	ID         string     `json:"id" firestore:"id"`
+	Event      string     `json:"event" firestore:"event"`
+	Severity   string     `json:"severity,omitempty" firestore:"severity"`
+	Team       string     `json:"team,omitempty" firestore:"team"`
+	AlertID    string     `json:"alert_id,omitempty" firestore:"alert_id"`
+	ActionID   string     `json:"action_id,omitempty" firestore:"action_id"`
+	Title      string     `json:"title" firestore:"title"`
+	Text       string     `json:"text" firestore:"text"`
+	Source     string     `json:"source" firestore:"source"` // sending service
+	Deliveries []Delivery `json:"deliveries" firestore:"deliveries"`
+	Created    time.Time  `json:"created" firestore:"created"`
+}
+
+type channel struct {
+	Channel
+	n     Notifier
+	local *localThrottle // with a Limit
+}
+
+// Router delivers messages to the channels their routes select.
+type Router struct {
+	cfg       Config
+	channels  map[string]channel
+	templates *Templates
+
+	// channel limits' state; nil until UseThrottle
+	fs          *firestore.Client
+	throttleCol string
+
+	// where sent notifications are recorded; nil until UseStore
+	store     *firestore.Client
+	storeCol  string
+	alertsCol string
+	source    string
+}
+
+// NewRouter builds the channels of c; secrets resolves their secrets.
+func NewRouter(c Config, secrets SecretFunc) (*Router, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	r := &Router{cfg: c, channels: map[string]channel{}}
+	for _, ch := range c.Channels {
+		c := channel{Channel: ch, n: New(ch, secrets)}
+		if ch.Limit != nil {
+			c.local = &localThrottle{}
+		}
+		r.channels[ch.Name] = c
+	}
+	return r, nil
+}
+
+// UseTemplates renders messages with t where it has a template for them.
+func (r *Router) UseTemplates(t *Templates) {
+	r.templates = t
+}
+
+// Templated reports whether any templates are in use, i.e. whether senders
+// should attach the alert and action.
+func (r *Router) Templated() bool {
+	return r.templates != nil && len(r.templates.set) > 0
+}
+
+// Render returns m as it would be sent to the named channel: the template
+// used (empty for the built-in text), the title and the text.
+func (r *Router) Render(m Message, channel string) (tmpl, title, text string, err error) {
+	ch, ok := r.channels[channel]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown channel %q", channel)
+	}
+	t := r.templates.For(m.Event, ch.Channel)
+	if t == nil {
+		return "", m.Subject(), m.Text, nil
+	}
+	title, text, err = Render(t, DataFor(m))
+	if title == "" {
+		title = m.Subject()
+	}
+	return t.Name(), title, text, err
+}
+
+// Resolve fills in the message's team and returns the channels it goes to.
+func (r *Router) Resolve(m *Message) []string {
+	f := match.Fields{}
+	for k, v := range m.Fields {
+		f[k] = v
+	}
+	if m.Team == "" {
+		for _, t := range r.cfg.Teams {
+			if match.All(t.When, f) {
+				m.Team = t.Name
+				break
+			}
+		}
+	}
+	f["event"], f["severity"], f["team"] = m.Event, m.Severity, m.Team
+	f["alert_id"], f["action_id"] = m.AlertID, m.ActionID
+
+	var out []string
+	for _, rt := range r.cfg.Routes {
+		if !match.All(rt.When, f) {
+			continue
+		}
+		for _, n := range rt.Channels {
+			if !slices.Contains(out, n) {
+				out = append(out, n)
+			}
+		}
+	}
+	if len(out) == 0 && !routedOnly(m.Event) {
+		out = r.cfg.Default
+	}
+	return out
+}
+
+// Send delivers m to every channel it routes to, one after another, and
+// returns what happened on each. A failing channel does not stop the rest.
+func (r *Router) Send(ctx context.Context, m Message) Record {
+	return r.deliver(ctx, m, r.Resolve(&m))
+}
+
+// deliver sends m to the named channels, holding it back from those whose
+// limit is reached.
+func (r *Router) deliver(ctx context.Context, m Message, names []string) Record {
+	rec := Record{
+		Event:    m.Event,
+		Severity: m.Severity,
+		Team:     m.Team,
+		AlertID:  m.AlertID,
+		ActionID: m.ActionID,
+		Title:    m.Subject(),
+		Text:     m.Text,
+		Created:  time.Now().UTC(),
+	}
+	for _, name := range names {
+		ch := r.channels[name]
+		d := Delivery{Channel: name, Type: ch.Type, OK: true}
+		if ch.Limit != nil && r.fs != nil && ch.Limit.applies(m) {
+			send, err := r.admit(ctx, ch, m)
+			if err != nil {
+				// Fail open: a throttle that can't be checked never
+				// swallows a notification.
+				d.Error, send = "throttle: "+err.Error(), true
+			}
+			if !send {
+				d.Held, d.At = true, time.Now().UTC()
+				rec.Deliveries = append(rec.Deliveries, d)
+				continue
+			}
+		}
+		out := m
+		tmpl, title, text, err := r.Render(m, name)
+		switch {
+		case err != nil:
+			d.Template, d.Error = tmpl, "template: "+err.Error()
+		case tmpl != "":
+			d.Template, out.Title, out.Text = tmpl, title, text
+		}
+		if err := ch.n.Notify(ctx, out); err != nil {
+			if d.Error != "" {
+				d.Error += "; "
+			}
+			d.OK, d.Error = false, d.Error+err.Error()
+		}
+		d.At = time.Now().UTC()
+		rec.Deliveries = append(rec.Deliveries, d)
+	}
+	return rec
+}
+
+// ForAlert is a message about an alert; f are its fields (event attributes,
+// alert_id, severity, ...), which routes and teams see.
+func ForAlert(event string, f match.Fields, text string) Message {
+	return Message{Event: event, Severity: f["severity"], AlertID: f["alert_id"], Fingerprint: f["fingerprint"], Text: text, Fields: f}
+}
+
+// ForAction is a message about an action. Its details (severity, target,
+// principal, ...) plus action and project are what routes and teams see.
+func ForAction(event, alertID, actionID, action string, details map[string]string, text string) Message {
+	f := match.Fields{}
+	for k, v := range details {
+		f[k] = v
+	}
+	f["alert_id"], f["action"], f["project"] = alertID, action, shared.Project(details["target"])
+	return Message{Event: event, Severity: details["severity"], AlertID: alertID, ActionID: actionID, Text: text, Fields: f}
+}
+
+// ActionRecord is what a notification about a stored action uses of it.
+// api-go and actions-go each fill one from their action document.
+type ActionRecord struct {
+	AlertID           string
+	ActionID          string
+	Name              string // proposed action
+	Status            string
+	Simulation        bool
+	Details           map[string]string
+	Approvals         []approval.Approval
+	ApprovalsRequired int
+	Deadline          *time.Time
+	Guardrail         string
+	LastError         string
+	Summary           string // executor result
+	RollbackOf        string
+}
+
+// ActionMessage is a message about the action r, which templates see as
+// .Action.
+func ActionMessage(r ActionRecord, event, text string) Message {
+	m := ForAction(event, r.AlertID, r.ActionID, r.Name, r.Details, text)
+	a := &Action{
+		ID:                r.ActionID,
+		Name:              r.Name,
+		Status:            r.Status,
+		Simulation:        r.Simulation,
+		Details:           r.Details,
+		ApprovalsRequired: r.ApprovalsRequired,
+		Guardrail:         r.Guardrail,
+		LastError:         r.LastError,
+		Summary:           r.Summary,
+		RollbackOf:        r.RollbackOf,
+	}
+	for _, ap := range r.Approvals {
+		a.Approvers = append(a.Approvers, ap.By)
+	}
+	if r.Deadline != nil {
+		a.Deadline = *r.Deadline
+	}
+	m.Action = a
+	return m
+}
@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Paging services' default endpoints; Channel.URL overrides them, e.g. to
+// point at tools/fakeserver-go.
+const (
+	pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieURL  = "https://api.opsgenie.com"
+)
+
+// What a message does to the page for its alert.
+const (
+	pageTrigger     = "trigger"
+	pageAcknowledge = "acknowledge"
+	pageResolve     = "resolve"
+)
+
+func pageAction(event string) string {
+	switch event {
+	case EventAlertAcknowledged:
+		return pageAcknowledge
+	case EventAlertResolved:
+		return pageResolve
+	}
+	return pageTrigger
+}
+
+// DedupKey is the key a page for m is opened, acknowledged and resolved
+// under: the alert fingerprint, so repeats of an alert share one page.
+func (m Message) DedupKey() string {
+	switch {
+	case m.Fingerprint != "":
+		return m.Fingerprint
+	case m.Alert != nil && m.Alert.Fingerprint != "":
+		return m.Alert.Fingerprint
+	}
+	return m.AlertID
+}
+
+// summary is a one-line description of m for paging services.
+func (m Message) summary(limit int) string {
+	s := m.Title
+	if s == "" {
+		s, _, _ = strings.Cut(strings.TrimSpace(m.Text), "\n")
+	}
+	if s == "" {
+		s = m.Subject()
+	}
+	if len(s) > limit {
+		s = strings.ToValidUTF8(s[:limit-1], "") + "…"
+	}
+	return s
+}
+
+// PagerDuty sends Events API v2 events: messages trigger a page, and
+// alert_acknowledged / alert_resolved acknowledge and resolve it.
+type PagerDuty struct {
+	url func(context.Context) (string, error)
+	key func(context.Context) (string, error) // integration routing key
+}
+
+func (n PagerDuty) Notify(ctx context.Context, m Message) error {
+	key, err := n.key(ctx)
+	if err != nil {
+		return err
+	}
+	ev := map[string]any{
+		"routing_key":  key,
+		"event_action": pageAction(m.Event),
+		"dedup_key":    m.DedupKey(),
+	}
+	if ev["event_action"] == pageTrigger {
+		ev["client"] = "sentinelflow"
+		ev["payload"] = map[string]any{
+			"summary":        m.summary(1024),
+			"source":         "sentinelflow",
+			"severity":       pagerDutySeverity(m.Severity),
+			"class":          m.Event,
+			"component":      m.Fields["target"],
+			"group":          m.Team,
+			"custom_details": m.details(),
+		}
+	}
+	return postJSON(ctx, n.url, nil, ev)
+}
+
+func pagerDutySeverity(s string) string {
+	switch s {
+	case "high":
+		return "critical"
+	case "medium":
+		return "error"
+	case "low":
+		return "warning"
+	}
+	return "info"
+}
+
+// Opsgenie creates alerts through the Alert API with the dedup key as
+// alias, and acknowledges and closes them by alias.
+type Opsgenie struct {
+	url func(context.Context) (string, error) // API base
+	key func(context.Context) (string, error) // API integration key
+}
+
+func (n Opsgenie) Notify(ctx context.Context, m Message) error {
+	key, err := n.key(ctx)
+	if err != nil {
+		return err
+	}
+	base, err := n.url(ctx)
+	if err != nil {
+		return err
+	}
+	base = strings.TrimSuffix(base, "/") + "/v2/alerts"
+	headers := map[string]string{"Authorization": "GenieKey " + key}
+	alias := m.DedupKey()
+	var (
+		u    = base
+		body any
+	)
+	switch pageAction(m.Event) {
+	case pageAcknowledge, pageResolve:
+		verb := "acknowledge"
+		if m.Event == EventAlertResolved {
+			verb = "close"
+		}
+		u = fmt.Sprintf("%s/%s/%s?identifierType=alias", base, url.PathEscape(alias), verb)
+		body = map[string]any{"source": "sentinelflow", "note": m.summary(25000)}
+	default:
+		body = map[string]any{
+			"message":     m.summary(130),
+			"alias":       alias,
+			"description": m.Text,
+			"priority":    opsgeniePriority(m.Severity),
+			"source":      "sentinelflow",
+			"entity":      m.Fields["target"],
+			"details":     m.details(),
+			"tags":        []string{m.Event},
+		}
+	}
+	return postJSON(ctx, func(context.Context) (string, error) { return u, nil }, headers, body)
+}
+
+func opsgeniePriority(s string) string {
+	switch s {
+	case "high":
+		return "P1"
+	case "medium":
+		return "P3"
+	case "low":
+		return "P4"
+	}
+	return "P5"
+}
+
+// details are the message fields plus its ids, for a page's custom details.
+func (m Message) details() map[string]string {
+	d := map[string]string{}
+	for k, v := range m.Fields {
+		if v != "" {
+			d[k] = v
+		}
+	}
+	d["event"] = m.Event
+	if m.AlertID != "" {
+		d["alert_id"] = m.AlertID
+	}
+	if m.ActionID != "" {
+		d["action_id"] = m.ActionID
+	}
+	return d
+}
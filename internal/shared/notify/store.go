@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+)
+
+// UseStore records what the router sends in the Firestore collection col,
+// marked as coming from source. Messages that name an alert without
+// carrying it have it read from alertsCol when templates need it.
+func (r *Router) UseStore(fs *firestore.Client, col, alertsCol, source string) {
+	r.store, r.storeCol, r.alertsCol, r.source = fs, col, alertsCol, source
+}
+
+// Notify sends m like Send and records the deliveries. Failures are logged
+// only.
+func (r *Router) Notify(ctx context.Context, m Message) Record {
+	if m.Alert == nil && m.AlertID != "" && r.Templated() {
+		m.Alert = r.loadAlert(ctx, m.AlertID)
+	}
+	rec := r.Send(ctx, m)
+	r.Store(ctx, &rec)
+	return rec
+}
+
+// Store logs rec's failed deliveries and records it, giving it an ID. A
+// record routed nowhere is dropped.
+func (r *Router) Store(ctx context.Context, rec *Record) {
+	if len(rec.Deliveries) == 0 {
+		return
+	}
+	rec.ID, rec.Source = uuid.New().String(), r.source
+	for _, d := range rec.Deliveries {
+		if !d.OK {
+			log.Printf("notify %s via %s failed: %s; message: %s", rec.Event, d.Channel, d.Error, rec.Text)
+		}
+	}
+	if r.store == nil {
+		return
+	}
+	if _, err := r.store.Collection(r.storeCol).Doc(rec.ID).Set(ctx, rec); err != nil {
+		log.Printf("firestore notification %s write error: %v", rec.ID, err)
+	}
+}
+
+// loadAlert reads the alert templates see; nil if it cannot be read.
+func (r *Router) loadAlert(ctx context.Context, id string) *Alert {
+	if r.store == nil {
+		return nil
+	}
+	doc, err := r.store.Collection(r.alertsCol).Doc(id).Get(ctx)
+	if err != nil {
+		log.Printf("firestore alert %s read error: %v", id, err)
+		return nil
+	}
+	var a Alert
+	if err := doc.DataTo(&a); err != nil {
+		log.Printf("decode alert %s: %v", id, err)
+		return nil
+	}
+	return &a
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/baseline"
+	"github.com/jinishshah00/sentinelflow/internal/shared/detect"
+	"github.com/jinishshah00/sentinelflow/internal/shared/intel"
+)
+
+// defaultTemplate names the templates that apply to every event type.
+const defaultTemplate = "default"
+
+// Triage is the triage result stored with an alert.
+type Triage struct {
+	Severity     string           `json:"severity" firestore:"severity"`
+	Confidence   float64          `json:"confidence" firestore:"confidence"`
+	ReasonTokens []string         `json:"reason_tokens" firestore:"reason_tokens"`
+	IntelMatches []intel.Match    `json:"intel_matches,omitempty" firestore:"intel_matches"`
+	Anomaly      baseline.Anomaly `json:"anomaly" firestore:"anomaly"`
+	ChangeWindow string           `json:"change_window,omitempty" firestore:"change_window"`
+	ChangeFreeze string           `json:"change_freeze,omitempty" firestore:"change_freeze"`
+}
+
+// Alert is the stored alert a notification is about, as templates see it.
+// It decodes straight from an alert document.
+type Alert struct {
+	AlertID     string         `json:"alert_id" firestore:"alert_id"`
+	Event       shared.Event   `json:"event" firestore:"event"`
+	Triage      Triage         `json:"triage" firestore:"triage"`
+	Status      string         `json:"status" firestore:"status"`
+	Fingerprint string         `json:"fingerprint,omitempty" firestore:"fingerprint"`
+	Occurrences int            `json:"occurrences,omitempty" firestore:"occurrences"`
+	IncidentID  string         `json:"incident_id,omitempty" firestore:"incident_id"`
+	Detection   *detect.Firing `json:"detection,omitempty" firestore:"detection"`
+}
+
+// Action is the action a notification is about, as templates see it.
+type Action struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"` // proposed action
+	Status            string            `json:"status"`
+	Simulation        bool              `json:"simulation"`
+	Details           map[string]string `json:"details,omitempty"`
+	Approvers         []string          `json:"approvers,omitempty"`
+	ApprovalsRequired int               `json:"approvals_required,omitempty"`
+	Deadline          time.Time         `json:"deadline,omitempty"` // zero without one
+	Guardrail         string            `json:"guardrail,omitempty"`
+	LastError         string            `json:"last_error,omitempty"`
+	Summary           string            `json:"summary,omitempty"` // executor result
+	RollbackOf        string            `json:"rollback_of,omitempty"`
+}
+
+// Data is what a template is executed with. Event, Triage and Enrichment
+// are empty when the message is not about a stored alert, Action when it
+// is not about an action, Digest unless it is a digest.
+type Data struct {
+	Type       string // event type, e.g. approval_requested
+	Severity   string
+	Team       string
+	AlertID    string
+	ActionID   string
+	Text       string // the built-in message
+	Fields     map[string]string
+	Event      shared.Event
+	Triage     Triage
+	Enrichment map[string]string // status, occurrences, fingerprint, incident_id, detection, intel, anomaly_score
+	Action     Action
+	Digest     Digest
+}
+
+// DataFor is the template data of m.
+func DataFor(m Message) Data {
+	d := Data{
+		Type:       m.Event,
+		Severity:   m.Severity,
+		Team:       m.Team,
+		AlertID:    m.AlertID,
+		ActionID:   m.ActionID,
+		Text:       m.Text,
+		Fields:     m.Fields,
+		Enrichment: map[string]string{},
+	}
+	if m.Alert != nil {
+		d.Event, d.Triage, d.Enrichment = m.Alert.Event, m.Alert.Triage, m.Alert.enrichment()
+		if d.Severity == "" {
+			d.Severity = m.Alert.Triage.Severity
+		}
+	}
+	if m.Action != nil {
+		d.Action = *m.Action
+	}
+	if m.Digest != nil {
+		d.Digest = *m.Digest
+	}
+	return d
+}
+
+func (a Alert) enrichment() map[string]string {
+	e := map[string]string{
+		"status":      a.Status,
+		"occurrences": strconv.Itoa(max(a.Occurrences, 1)),
+		"fingerprint": a.Fingerprint,
+		"incident_id": a.IncidentID,
+	}
+	if a.Detection != nil {
+		e["detection"] = a.Detection.Rule
+	}
+	if len(a.Triage.IntelMatches) > 0 {
+		var ms []string
+		for _, m := range a.Triage.IntelMatches {
+			ms = append(ms, fmt.Sprintf("%s %s (%s)", m.Type, m.Value, m.Source))
+		}
+		e["intel"] = strings.Join(ms, ", ")
+	}
+	if a.Triage.Anomaly.Score > 0 {
+		e["anomaly_score"] = strconv.FormatFloat(a.Triage.Anomaly.Score, 'f', 2, 64)
+	}
+	return e
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  func(sep string, v []string) string { return strings.Join(v, sep) },
+	"default": func(def, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+	"truncate": func(n int, s string) string {
+		if len(s) <= n {
+			return s
+		}
+		return strings.ToValidUTF8(s[:n], "") + "…"
+	},
+	"time": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(layout)
+	},
+}
+
+// ParseTemplate parses one notification template. Its output is the message
+// text; an optional {{define "title"}} sets the email subject or card title.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// field names are only checked on execution
+	if _, _, err := Render(t, sampleData()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render executes t with d, returning the title (empty unless t defines
+// one) and the text.
+func Render(t *template.Template, d Data) (title, text string, err error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return "", "", err
+	}
+	text = strings.TrimSpace(b.String())
+	if tt := t.Lookup("title"); tt != nil {
+		b.Reset()
+		if err := tt.Execute(&b, d); err != nil {
+			return "", "", err
+		}
+		title = oneLine(strings.TrimSpace(b.String()))
+	}
+	return title, text, nil
+}
+
+// Templates are notification templates by event type and channel.
+type Templates struct {
+	set map[string]*template.Template // "<event>[.<channel name or type>]"
+}
+
+// LoadTemplates reads every *.tmpl file in dir (NOTIFY_TEMPLATES). A file is
+// named after an event type, or "default" for all of them, optionally
+// followed by a channel name or type: approval_requested.tmpl,
+// approval_requested.email.tmpl, default.teams.tmpl. Each template must
+// parse and render against sample data.
+func LoadTemplates(dir string, c Config) (*Templates, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{set: map[string]*template.Template{}}
+	for _, f := range files {
+		key := strings.TrimSuffix(filepath.Base(f), ".tmpl")
+		event, ch, _ := strings.Cut(key, ".")
+		if event != defaultTemplate && !slices.Contains(Events, event) {
+			return nil, fmt.Errorf("notify template %s: unknown event type %q", f, event)
+		}
+		if ch != "" && !c.hasChannel(ch) {
+			return nil, fmt.Errorf("notify template %s: unknown channel or channel type %q", f, ch)
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := ParseTemplate(key, string(b))
+		if err != nil {
+			return nil, fmt.Errorf("notify template %s: %w", f, err)
+		}
+		t.set[key] = tmpl
+	}
+	return t, nil
+}
+
+func (c Config) hasChannel(s string) bool {
+	switch s {
+	case TypeSlack, TypeEmail, TypeTeams, TypeWebhook, TypePagerDuty, TypeOpsgenie:
+		return true
+	}
+	return slices.ContainsFunc(c.Channels, func(ch Channel) bool { return ch.Name == s })
+}
+
+// For returns the template for event on ch, trying the channel name, then
+// its type, then any channel, first for the event and then for "default".
+func (t *Templates) For(event string, ch Channel) *template.Template {
+	if t == nil {
+		return nil
+	}
+	for _, e := range []string{event, defaultTemplate} {
+		for _, k := range []string{e + "." + ch.Name, e + "." + ch.Type, e} {
+			if tmpl, ok := t.set[k]; ok {
+				return tmpl
+			}
+		}
+	}
+	return nil
+}
+
+// sampleData fills every part of Data so templates referring to unknown
+// fields fail when they are loaded rather than when they are first used.
+func sampleData() Data {
+	now := time.Now().UTC()
+	a := Alert{
+		AlertID: "sample",
+		Event: shared.Event{ID: "sample", EventType: "iam.serviceAccountKeys.create", Principal: "user@example.com",
+			Target: "projects/sample/serviceAccounts/sa@sample.iam.gserviceaccount.com", Labels: []string{"sample"}, TS: now},
+		Triage:      Triage{Severity: "high", Confidence: 0.9, ReasonTokens: []string{"sample"}, Anomaly: baseline.Anomaly{Score: 0.5}},
+		Status:      "new",
+		Occurrences: 1,
+		Detection:   &detect.Firing{Rule: "sample"},
+	}
+	act := &Action{ID: "sample", Name: "revoke_sa_key", Status: "awaiting_approval", Details: map[string]string{"target": a.Event.Target},
+		Approvers: []string{"approver@example.com"}, ApprovalsRequired: 1, Deadline: now}
+	dg := &Digest{Channel: "sample", Since: now, Due: now, Count: 1, Events: map[string]int{EventAlertOpened: 1},
+		Severities: map[string]int{"high": 1}, Alerts: map[string]int{"sample": 1}}
+	return DataFor(Message{Event: EventApprovalRequested, AlertID: "sample", ActionID: "sample", Text: "sample",
+		Fields: map[string]string{"alert_id": "sample"}, Alert: &a, Action: act, Digest: dg})
+}
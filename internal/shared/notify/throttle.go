@@ -0,0 +1,420 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+// Bounds on what a throttle document keeps.
+const (
+	maxFingerprints = 1000 // tracked per channel; the least recent is forgotten
+	maxDigestAlerts = 100  // alerts broken out in a digest
+	digestTopAlerts = 10   // alerts linked in the digest message
+	maxPending      = 5000 // local decisions kept while the shared state is unreachable
+)
+
+// throttleSync is how often a Router merges the decisions it took locally
+// into a channel's shared throttle document and reloads what every other
+// sender counted.
+const throttleSync = 5 * time.Second
+
+// Limit throttles one channel. At most Max messages go out per Window, and
+// at most PerFingerprint about any one alert fingerprint; the rest are
+// counted into a digest sent every DigestEvery instead. Messages with
+// buttons and Exempt event types are always sent.
+type Limit struct {
+	Max            int             `json:"max,omitempty"`
+	PerFingerprint int             `json:"per_fingerprint,omitempty"`
+	Window         shared.Duration `json:"window"`
+	DigestEvery    shared.Duration `json:"digest_every,omitempty"` // default Window
+	Exempt         []string        `json:"exempt,omitempty"`
+}
+
+func (l Limit) validate() error {
+	if l.Window <= 0 {
+		return fmt.Errorf("window is required")
+	}
+	if l.Max < 0 || l.PerFingerprint < 0 || l.Max == 0 && l.PerFingerprint == 0 {
+		return fmt.Errorf("max or per_fingerprint must be positive")
+	}
+	if l.DigestEvery < 0 {
+		return fmt.Errorf("digest_every must not be negative")
+	}
+	for _, e := range l.Exempt {
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("exempt: unknown event type %q", e)
+		}
+	}
+	return nil
+}
+
+func (l Limit) applies(m Message) bool {
+	return m.Event != EventDigest && len(m.Buttons) == 0 && !slices.Contains(l.Exempt, m.Event)
+}
+
+// Throttle is the persisted rate and digest state of one channel, a
+// document named after the channel.
+type Throttle struct {
+	Channel      string                 `json:"channel" firestore:"channel"`
+	Hits         []time.Time            `json:"hits" firestore:"hits"`                 // messages sent in the window
+	Fingerprints map[string][]time.Time `json:"fingerprints" firestore:"fingerprints"` // the same per fingerprint
+	Digest       *Digest                `json:"digest,omitempty" firestore:"digest"`   // messages held since the last digest
+	Updated      time.Time              `json:"updated" firestore:"updated"`
+}
+
+// Digest summarises the messages a channel held back.
+type Digest struct {
+	Channel    string         `json:"channel" firestore:"channel"`
+	Since      time.Time      `json:"since" firestore:"since"` // first held message
+	Due        time.Time      `json:"due" firestore:"due"`
+	Count      int            `json:"count" firestore:"count"`
+	Events     map[string]int `json:"events" firestore:"events"`         // by event type
+	Severities map[string]int `json:"severities" firestore:"severities"` // by severity; "none" without one
+	Alerts     map[string]int `json:"alerts" firestore:"alerts"`         // by alert id, the first maxDigestAlerts
+}
+
+// Admit decides whether m goes out on a channel limited by l now, counting
+// it if so; otherwise it is added to the channel's digest.
+func (l Limit) Admit(t *Throttle, m Message, now time.Time) bool {
+	t.prune(l, now)
+	fp := m.DedupKey()
+	over := l.Max > 0 && len(t.Hits) >= l.Max ||
+		l.PerFingerprint > 0 && fp != "" && len(t.Fingerprints[fp]) >= l.PerFingerprint
+	if over {
+		t.hold(l, m, now)
+		return false
+	}
+	t.record(l, fp, now)
+	return true
+}
+
+// apply adds a decision taken by Admit on another copy of the state to t,
+// without taking it again.
+func (l Limit) apply(t *Throttle, d decision) {
+	if d.sent {
+		t.record(l, d.m.DedupKey(), d.at)
+	} else {
+		t.hold(l, d.m, d.at)
+	}
+	t.Updated = d.at
+}
+
+// prune forgets the hits that left the window.
+func (t *Throttle) prune(l Limit, now time.Time) {
+	cutoff := now.Add(-time.Duration(l.Window))
+	t.Hits = since(t.Hits, cutoff)
+	for fp, hits := range t.Fingerprints {
+		if hits = since(hits, cutoff); len(hits) == 0 {
+			delete(t.Fingerprints, fp)
+		} else {
+			t.Fingerprints[fp] = hits
+		}
+	}
+	t.Updated = now
+}
+
+// record counts a message sent at now about fingerprint fp.
+func (t *Throttle) record(l Limit, fp string, now time.Time) {
+	if l.Max > 0 {
+		t.Hits = append(t.Hits, now)
+	}
+	if l.PerFingerprint > 0 && fp != "" {
+		if t.Fingerprints == nil {
+			t.Fingerprints = map[string][]time.Time{}
+		}
+		t.Fingerprints[fp] = append(t.Fingerprints[fp], now)
+		t.forgetOldest()
+	}
+}
+
+func (t *Throttle) hold(l Limit, m Message, now time.Time) {
+	d := t.Digest
+	if d == nil {
+		every := time.Duration(l.DigestEvery)
+		if every <= 0 {
+			every = time.Duration(l.Window)
+		}
+		d = &Digest{Channel: t.Channel, Since: now, Due: now.Add(every),
+			Events: map[string]int{}, Severities: map[string]int{}, Alerts: map[string]int{}}
+		t.Digest = d
+	}
+	d.Count++
+	d.Events[m.Event]++
+	sev := m.Severity
+	if sev == "" {
+		sev = "none"
+	}
+	d.Severities[sev]++
+	if m.AlertID != "" {
+		if _, ok := d.Alerts[m.AlertID]; ok || len(d.Alerts) < maxDigestAlerts {
+			d.Alerts[m.AlertID]++
+		}
+	}
+}
+
+func (t *Throttle) forgetOldest() {
+	for len(t.Fingerprints) > maxFingerprints {
+		oldest, at := "", time.Time{}
+		for fp, hits := range t.Fingerprints {
+			if last := hits[len(hits)-1]; oldest == "" || last.Before(at) {
+				oldest, at = fp, last
+			}
+		}
+		delete(t.Fingerprints, oldest)
+	}
+}
+
+func since(ts []time.Time, cutoff time.Time) []time.Time {
+	kept := ts[:0]
+	for _, t := range ts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// Message is the digest as a message to its channel. consoleURL, when set,
+// links the alerts.
+func (d Digest) Message(consoleURL string, l Limit) Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, ":package: *%d notification(s)* held back on `%s` since %s UTC (%s)",
+		d.Count, d.Channel, d.Since.UTC().Format("15:04"), l.describe())
+	fmt.Fprintf(&b, "\nBy event: %s", counts(d.Events))
+	fmt.Fprintf(&b, "\nBy severity: %s", counts(d.Severities))
+	if len(d.Alerts) > 0 {
+		ids := make([]string, 0, len(d.Alerts))
+		for id := range d.Alerts {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if d.Alerts[ids[i]] != d.Alerts[ids[j]] {
+				return d.Alerts[ids[i]] > d.Alerts[ids[j]]
+			}
+			return ids[i] < ids[j]
+		})
+		var links []string
+		for _, id := range ids[:min(len(ids), digestTopAlerts)] {
+			link := "`" + id + "`"
+			if consoleURL != "" {
+				link = fmt.Sprintf("<%s/alerts/%s|%s>", strings.TrimSuffix(consoleURL, "/"), id, id)
+			}
+			links = append(links, fmt.Sprintf("%s ×%d", link, d.Alerts[id]))
+		}
+		more := ""
+		if len(ids) > digestTopAlerts {
+			more = fmt.Sprintf(" and %d more", len(ids)-digestTopAlerts)
+		}
+		fmt.Fprintf(&b, "\nAlerts: %s%s", strings.Join(links, ", "), more)
+	}
+	if consoleURL != "" {
+		fmt.Fprintf(&b, "\nConsole: %s/alerts", strings.TrimSuffix(consoleURL, "/"))
+	}
+	return Message{
+		Event:  EventDigest,
+		Title:  fmt.Sprintf("[sentinelflow] digest: %d notification(s) on %s", d.Count, d.Channel),
+		Text:   b.String(),
+		Digest: &d,
+	}
+}
+
+func (l Limit) describe() string {
+	var parts []string
+	if l.Max > 0 {
+		parts = append(parts, fmt.Sprintf("limit %d per %s", l.Max, time.Duration(l.Window)))
+	}
+	if l.PerFingerprint > 0 {
+		parts = append(parts, fmt.Sprintf("%d per alert per %s", l.PerFingerprint, time.Duration(l.Window)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// counts renders a count map largest first: "alert_opened 12, approval_requested 3".
+func counts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	var out []string
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s %d", k, m[k]))
+	}
+	return strings.Join(out, ", ")
+}
+
+// UseThrottle turns on channel limits, keeping their state in the Firestore
+// collection col. Without it limits are ignored.
+func (r *Router) UseThrottle(fs *firestore.Client, col string) {
+	r.fs, r.throttleCol = fs, col
+}
+
+// localThrottle is a Router's copy of a limited channel's throttle. Admit
+// runs on it in memory, so an event storm does not turn into one contended
+// transaction per message; the decisions are merged into the shared
+// document every throttleSync. Between syncs, each sender only sees the
+// others' messages as of its last sync.
+type localThrottle struct {
+	mu      sync.Mutex
+	state   Throttle   // the shared state as of the last sync, plus pending
+	pending []decision // taken since the last sync
+	synced  time.Time
+	timer   *time.Timer // the scheduled sync of pending, if any
+}
+
+// decision is one Admit outcome on a localThrottle that is not yet shared.
+type decision struct {
+	m    Message // only what counting and the digest use
+	at   time.Time
+	sent bool
+}
+
+// admit runs Limit.Admit on the Router's copy of ch's throttle, loading the
+// shared state first when it is older than throttleSync. The decision is
+// merged into the shared state within throttleSync. If the shared state
+// cannot be loaded the message is sent, and counted, with the error.
+func (r *Router) admit(ctx context.Context, ch channel, m Message) (bool, error) {
+	lt := ch.local
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	now := time.Now().UTC()
+	var err error
+	if now.Sub(lt.synced) >= throttleSync {
+		err = r.syncThrottle(ctx, ch, now)
+	}
+	var send bool
+	if err != nil {
+		lt.state.prune(*ch.Limit, now)
+		lt.state.record(*ch.Limit, m.DedupKey(), now)
+		send = true
+	} else {
+		send = ch.Limit.Admit(&lt.state, m, now)
+	}
+	lt.pending = append(lt.pending, decision{
+		m:    Message{Event: m.Event, Severity: m.Severity, AlertID: m.AlertID, Fingerprint: m.DedupKey()},
+		at:   now,
+		sent: send,
+	})
+	if n := len(lt.pending); n > maxPending {
+		lt.pending = slices.Delete(lt.pending, 0, n-maxPending)
+	}
+	if lt.timer == nil {
+		lt.timer = time.AfterFunc(throttleSync, func() { r.flushThrottle(ch) })
+	}
+	return send, err
+}
+
+// flushThrottle shares ch's pending decisions, retrying every throttleSync
+// until it succeeds.
+func (r *Router) flushThrottle(ch channel) {
+	lt := ch.local
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.timer = nil
+	if len(lt.pending) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := r.syncThrottle(ctx, ch, time.Now().UTC()); err != nil {
+		log.Printf("notify: throttle %s sync error: %v", ch.Name, err)
+		lt.timer = time.AfterFunc(throttleSync, func() { r.flushThrottle(ch) })
+	}
+}
+
+// syncThrottle merges ch's pending decisions into its throttle document in
+// a transaction and makes the result the Router's copy. On error the
+// pending decisions are kept for the next sync, and the next attempt waits
+// throttleSync all the same. The caller holds ch.local.mu.
+func (r *Router) syncThrottle(ctx context.Context, ch channel, now time.Time) error {
+	lt := ch.local
+	lt.synced = now
+	ref := r.fs.Collection(r.throttleCol).Doc(ch.Name)
+	var t Throttle
+	err := r.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		t = Throttle{Channel: ch.Name}
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if snaps[0].Exists() {
+			if err := snaps[0].DataTo(&t); err != nil {
+				return err
+			}
+		}
+		if len(lt.pending) == 0 {
+			return nil
+		}
+		for _, d := range lt.pending {
+			ch.Limit.apply(&t, d)
+		}
+		t.prune(*ch.Limit, now)
+		return tx.Set(ref, t)
+	})
+	if err != nil {
+		return err
+	}
+	lt.state, lt.pending = t, nil
+	return nil
+}
+
+// FlushDigests sends every digest that is due to its channel and returns
+// what was sent. A digest is taken before it is sent, so a failed delivery
+// is recorded rather than retried.
+func (r *Router) FlushDigests(ctx context.Context) ([]Record, error) {
+	if r.fs == nil {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	docs, err := r.fs.Collection(r.throttleCol).Where("digest.due", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, doc := range docs {
+		var d *Digest
+		err := r.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			d = nil
+			snap, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			var t Throttle
+			if err := snap.DataTo(&t); err != nil {
+				return err
+			}
+			if t.Digest == nil || t.Digest.Due.After(now) {
+				return nil // taken by another sweeper
+			}
+			d, t.Digest, t.Updated = t.Digest, nil, now
+			return tx.Set(doc.Ref, t)
+		})
+		if err != nil {
+			return out, fmt.Errorf("take digest %s: %w", doc.Ref.ID, err)
+		}
+		if d == nil {
+			continue
+		}
+		ch, ok := r.channels[d.Channel]
+		if !ok || ch.Limit == nil {
+			continue // channel removed or no longer limited since
+		}
+		out = append(out, r.deliver(ctx, d.Message(r.cfg.ConsoleURL, *ch.Limit), []string{d.Channel}))
+	}
+	return out, nil
+}
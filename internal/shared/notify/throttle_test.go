@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+)
+
+func TestAdmit(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg := func(fp string) Message {
+		return Message{Event: EventAlertOpened, Severity: "high", AlertID: "alert-" + fp, Fingerprint: fp}
+	}
+	type send struct {
+		m     Message
+		after time.Duration // since t0
+		want  bool
+	}
+	tests := []struct {
+		name  string
+		limit Limit
+		sends []send
+		held  int
+	}{
+		{
+			name:  "max per window",
+			limit: Limit{Max: 2, Window: shared.Duration(10 * time.Minute)},
+			sends: []send{{msg("a"), 0, true}, {msg("b"), time.Minute, true}, {msg("c"), 2 * time.Minute, false}},
+			held:  1,
+		},
+		{
+			name:  "window slides",
+			limit: Limit{Max: 2, Window: shared.Duration(10 * time.Minute)},
+			sends: []send{{msg("a"), 0, true}, {msg("b"), 5 * time.Minute, true}, {msg("c"), 9 * time.Minute, false},
+				{msg("d"), 10 * time.Minute, true}, {msg("e"), 11 * time.Minute, false}},
+			held: 2,
+		},
+		{
+			name:  "per fingerprint",
+			limit: Limit{PerFingerprint: 1, Window: shared.Duration(10 * time.Minute)},
+			sends: []send{{msg("a"), 0, true}, {msg("a"), time.Minute, false}, {msg("b"), time.Minute, true},
+				{msg("a"), 11 * time.Minute, true}},
+			held: 1,
+		},
+		{
+			name:  "per fingerprint falls back to the alert id",
+			limit: Limit{PerFingerprint: 1, Window: shared.Duration(10 * time.Minute)},
+			sends: []send{{Message{Event: EventActionFailed, AlertID: "x"}, 0, true},
+				{Message{Event: EventActionFailed, AlertID: "x"}, time.Minute, false},
+				{Message{Event: EventActionFailed}, time.Minute, true}, {Message{Event: EventActionFailed}, time.Minute, true}},
+			held: 1,
+		},
+		{
+			name:  "both limits",
+			limit: Limit{Max: 3, PerFingerprint: 2, Window: shared.Duration(10 * time.Minute)},
+			sends: []send{{msg("a"), 0, true}, {msg("a"), 0, true}, {msg("a"), 0, false}, {msg("b"), 0, true}, {msg("c"), 0, false}},
+			held:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := Throttle{Channel: "ops"}
+			for i, s := range tt.sends {
+				if got := tt.limit.Admit(&th, s.m, t0.Add(s.after)); got != s.want {
+					t.Errorf("send %d (%s at +%s) = %v, want %v", i, s.m.DedupKey(), s.after, got, s.want)
+				}
+			}
+			held := 0
+			if th.Digest != nil {
+				held = th.Digest.Count
+			}
+			if held != tt.held {
+				t.Errorf("held %d, want %d", held, tt.held)
+			}
+		})
+	}
+}
+
+func TestHoldBuildsDigest(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := Limit{Max: 1, Window: shared.Duration(10 * time.Minute)}
+	th := Throttle{Channel: "ops"}
+	l.Admit(&th, Message{Event: EventAlertOpened, AlertID: "a"}, t0)
+
+	l.Admit(&th, Message{Event: EventAlertOpened, Severity: "high", AlertID: "b"}, t0.Add(time.Minute))
+	l.Admit(&th, Message{Event: EventAlertOpened, Severity: "high", AlertID: "b"}, t0.Add(2*time.Minute))
+	l.Admit(&th, Message{Event: EventActionFailed, AlertID: "c"}, t0.Add(3*time.Minute))
+
+	d := th.Digest
+	if d == nil {
+		t.Fatal("no digest")
+	}
+	if d.Channel != "ops" || d.Count != 3 || !d.Since.Equal(t0.Add(time.Minute)) {
+		t.Errorf("digest = %+v", d)
+	}
+	if want := t0.Add(11 * time.Minute); !d.Due.Equal(want) {
+		t.Errorf("due %s, want %s (a window after the first held message)", d.Due, want)
+	}
+	if want := map[string]int{EventAlertOpened: 2, EventActionFailed: 1}; !maps.Equal(d.Events, want) {
+		t.Errorf("events = %v, want %v", d.Events, want)
+	}
+	if want := map[string]int{"high": 2, "none": 1}; !maps.Equal(d.Severities, want) {
+		t.Errorf("severities = %v, want %v", d.Severities, want)
+	}
+	if want := map[string]int{"b": 2, "c": 1}; !maps.Equal(d.Alerts, want) {
+		t.Errorf("alerts = %v, want %v", d.Alerts, want)
+	}
+
+	l.DigestEvery = shared.Duration(time.Hour)
+	th = Throttle{Channel: "ops", Hits: []time.Time{t0}}
+	l.Admit(&th, Message{Event: EventAlertOpened}, t0)
+	if want := t0.Add(time.Hour); th.Digest == nil || !th.Digest.Due.Equal(want) {
+		t.Errorf("digest_every: digest = %+v, want due %s", th.Digest, want)
+	}
+}
+
+func TestHoldCapsDigestAlerts(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := Limit{Max: 1, Window: shared.Duration(time.Hour)}
+	th := Throttle{Channel: "ops", Hits: []time.Time{t0}}
+	for i := range maxDigestAlerts + 5 {
+		l.Admit(&th, Message{Event: EventAlertOpened, AlertID: fmt.Sprint(i)}, t0)
+	}
+	l.Admit(&th, Message{Event: EventAlertOpened, AlertID: "0"}, t0)
+	d := th.Digest
+	if d.Count != maxDigestAlerts+6 || len(d.Alerts) != maxDigestAlerts || d.Alerts["0"] != 2 {
+		t.Errorf("count %d, %d alerts, alert 0 ×%d", d.Count, len(d.Alerts), d.Alerts["0"])
+	}
+}
+
+func TestApplyMergesDecisionsFromCopies(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := Limit{Max: 3, PerFingerprint: 1, Window: shared.Duration(10 * time.Minute)}
+	global := Throttle{Channel: "ops"}
+
+	// senders between syncs decide on their own copies of the state
+	var decided []decision
+	for i, fp := range []string{"a", "b", "a"} {
+		local := Throttle{Channel: "ops"}
+		m := Message{Event: EventAlertOpened, Severity: "high", AlertID: "alert-" + fp, Fingerprint: fp}
+		at := t0.Add(time.Duration(i) * time.Second)
+		decided = append(decided, decision{m: m, at: at, sent: l.Admit(&local, m, at)})
+	}
+	for _, d := range decided {
+		l.apply(&global, d)
+	}
+
+	// the merged state counts every send, including the overshoot
+	if len(global.Hits) != 3 || len(global.Fingerprints["a"]) != 2 || len(global.Fingerprints["b"]) != 1 {
+		t.Fatalf("merged hits %v, fingerprints %v", global.Hits, global.Fingerprints)
+	}
+	if global.Digest != nil {
+		t.Fatalf("nothing was held, digest = %+v", global.Digest)
+	}
+	if l.Admit(&global, Message{Event: EventAlertOpened, Fingerprint: "c"}, t0.Add(time.Minute)) {
+		t.Error("admitted over max after the merge")
+	}
+
+	l.apply(&global, decision{m: Message{Event: EventActionFailed, AlertID: "d"}, at: t0.Add(2 * time.Minute)})
+	if d := global.Digest; d == nil || d.Count != 2 || d.Events[EventActionFailed] != 1 || !d.Since.Equal(t0.Add(time.Minute)) {
+		t.Errorf("held decisions not merged into the digest: %+v", global.Digest)
+	}
+}
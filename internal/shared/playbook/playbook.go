@@ -0,0 +1,203 @@
+package playbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Step kinds.
+const (
+	KindEnrich          = "enrich"            // gather incident/intel context
+	KindNotify          = "notify"            // post text to a chat channel
+	KindContain         = "contain"           // run a remediation executor now
+	KindTicket          = "ticket"            // open a ticket via webhook
+	KindWaitForApproval = "wait_for_approval" // propose an action and wait for its approval and execution
+	KindVerify          = "verify"            // confirm a remediation is in effect
+)
+
+// When a step runs relative to its dependencies' outcome.
+const (
+	RunOnSuccess = "success" // every dependency succeeded or was skipped (default)
+	RunOnFailure = "failure" // some dependency failed
+	RunOnAlways  = "always"  // once every dependency has finished
+)
+
+// Step is one node of a playbook. Without After a step depends on the one
+// before it; "after": [] makes it a root.
+type Step struct {
+	ID      string       `json:"id" firestore:"id"`
+	Kind    string       `json:"kind" firestore:"kind"`
+	After   []string     `json:"after,omitempty" firestore:"after"`
+	When    []match.Cond `json:"when,omitempty" firestore:"when"` // on alert fields and steps.<id>.<output>
+	RunOn   string       `json:"run_on,omitempty" firestore:"run_on"`
+	Action  string       `json:"action,omitempty" firestore:"action"`   // contain, wait_for_approval, verify
+	Text    string       `json:"text,omitempty" firestore:"text"`       // notify, ticket; ${field} is expanded
+	Channel string       `json:"channel,omitempty" firestore:"channel"` // notify: "" (default) or "escalation"
+}
+
+// Playbook is a named response that applies to alerts matching When.
+type Playbook struct {
+	Name  string       `json:"name" firestore:"name"`
+	When  []match.Cond `json:"when" firestore:"when"`
+	Steps []Step       `json:"steps" firestore:"steps"`
+}
+
+// Config is the playbooks file (PLAYBOOKS_FILE). The first playbook whose
+// conditions match an alert runs.
+type Config struct {
+	Playbooks []Playbook `json:"playbooks"`
+}
+
+// DefaultConfig reproduces the built-in responses: approval-gated IAM
+// reverts, immediate key/bucket/VM containment followed by verification,
+// and a human look at strongly anomalous alerts (anomaly_score >= reviewScore).
+func DefaultConfig(reviewScore float64) Config {
+	sev := func(s ...string) match.Cond { return match.Cond{Field: "severity", Op: "in", Values: s} }
+	evt := func(t string) match.Cond { return match.Cond{Field: "event_type", Op: "eq", Value: t} }
+	contain := func(action string) []Step {
+		return []Step{
+			{ID: "contain", Kind: KindContain, Action: action},
+			{ID: "verify", Kind: KindVerify, Action: action},
+		}
+	}
+	return Config{Playbooks: []Playbook{
+		{Name: "iam_binding_add", When: []match.Cond{evt("iam.setIamPolicy.bindingAdd"), sev("high")},
+			Steps: []Step{{ID: "approve", Kind: KindWaitForApproval, Action: "revert_iam_binding"}}},
+		{Name: "sa_key_create", When: []match.Cond{evt("iam.serviceAccountKeys.create"), sev("high")},
+			Steps: contain("revoke_sa_key")},
+		{Name: "public_bucket", When: []match.Cond{evt("storage.setIamPolicy.public"), sev("high", "medium")},
+			Steps: contain("revert_bucket_policy")},
+		{Name: "firewall_ingress", When: []match.Cond{evt("compute.firewall.ingress"), sev("high", "medium")},
+			Steps: contain("isolate_vm_nic")},
+		{Name: "anomaly_review", When: []match.Cond{{Field: "severity", Op: "ne", Value: "low"},
+			{Field: "anomaly_score", Op: "gte", Value: strconv.FormatFloat(reviewScore, 'f', -1, 64)}},
+			Steps: []Step{{ID: "review", Kind: KindWaitForApproval, Action: "require_approval"}}},
+	}}
+}
+
+// LoadConfig reads and validates a playbooks file.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for i := range c.Playbooks {
+		if err := c.Playbooks[i].validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
+
+// Select returns the first playbook matching the alert fields.
+func (c Config) Select(f match.Fields) (Playbook, bool) {
+	for _, pb := range c.Playbooks {
+		if match.All(pb.When, f) {
+			return pb, true
+		}
+	}
+	return Playbook{}, false
+}
+
+func (pb Playbook) validate() error {
+	if pb.Name == "" {
+		return fmt.Errorf("playbook: name is required")
+	}
+	if len(pb.Steps) == 0 {
+		return fmt.Errorf("playbook %s: no steps", pb.Name)
+	}
+	if err := match.ValidateAll(pb.When); err != nil {
+		return fmt.Errorf("playbook %s: %w", pb.Name, err)
+	}
+	seen := map[string]bool{}
+	for i, s := range pb.Steps {
+		if s.ID == "" || seen[s.ID] {
+			return fmt.Errorf("playbook %s: step %d needs a unique id", pb.Name, i)
+		}
+		seen[s.ID] = true
+		switch s.Kind {
+		case KindContain, KindVerify:
+			if s.Action == "" {
+				return fmt.Errorf("playbook %s step %s: %s needs an action", pb.Name, s.ID, s.Kind)
+			}
+		case KindNotify:
+			if s.Text == "" {
+				return fmt.Errorf("playbook %s step %s: notify needs text", pb.Name, s.ID)
+			}
+		case KindEnrich, KindTicket, KindWaitForApproval:
+		default:
+			return fmt.Errorf("playbook %s step %s: unknown kind %q", pb.Name, s.ID, s.Kind)
+		}
+		switch s.RunOn {
+		case "", RunOnSuccess, RunOnFailure, RunOnAlways:
+		default:
+			return fmt.Errorf("playbook %s step %s: unknown run_on %q", pb.Name, s.ID, s.RunOn)
+		}
+		if err := match.ValidateAll(s.When); err != nil {
+			return fmt.Errorf("playbook %s step %s: %w", pb.Name, s.ID, err)
+		}
+	}
+	for _, s := range pb.Steps {
+		for _, d := range s.After {
+			if !seen[d] {
+				return fmt.Errorf("playbook %s step %s: unknown dependency %q", pb.Name, s.ID, d)
+			}
+		}
+	}
+	if cyclic(pb.Steps) {
+		return fmt.Errorf("playbook %s: steps form a cycle", pb.Name)
+	}
+	return nil
+}
+
+// deps returns the ids step i waits for.
+func deps(steps []Step, i int) []string {
+	if steps[i].After != nil || i == 0 {
+		return steps[i].After
+	}
+	return []string{steps[i-1].ID}
+}
+
+// cyclic reports whether the dependency graph has a cycle.
+func cyclic(steps []Step) bool {
+	idx := map[string]int{}
+	for i, s := range steps {
+		idx[s.ID] = i
+	}
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make([]int, len(steps)) // zero: not visited
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		switch state[i] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[i] = visiting
+		for _, d := range deps(steps, i) {
+			if visit(idx[d]) {
+				return true
+			}
+		}
+		state[i] = done
+		return false
+	}
+	for i := range steps {
+		if visit(i) {
+			return true
+		}
+	}
+	return false
+}
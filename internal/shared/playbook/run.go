@@ -0,0 +1,208 @@
+package playbook
+
+import (
+	"os"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Run statuses.
+const (
+	RunRunning   = "running"
+	RunWaiting   = "waiting" // blocked on an action: an approval or the queue worker
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// Step statuses.
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepWaiting   = "waiting"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"   // conditions or run_on not met
+	StepCancelled = "cancelled" // a dependency failed and the step only runs on success
+)
+
+// Run is one execution of a playbook for an alert. It is persisted after
+// every step so that any instance can resume it after a restart.
+type Run struct {
+	RunID      string            `json:"run_id" firestore:"run_id"`
+	AlertID    string            `json:"alert_id" firestore:"alert_id"`
+	Playbook   Playbook          `json:"playbook" firestore:"playbook"` // definition as of the start
+	Status     string            `json:"status" firestore:"status"`
+	Context    map[string]string `json:"context" firestore:"context"` // alert fields the conditions see
+	Steps      []StepState       `json:"steps" firestore:"steps"`
+	Created    time.Time         `json:"created" firestore:"created"`
+	Updated    time.Time         `json:"updated" firestore:"updated"`
+	Finished   *time.Time        `json:"finished,omitempty" firestore:"finished"`
+	LeaseUntil *time.Time        `json:"lease_until,omitempty" firestore:"lease_until"` // held by the instance driving the run
+}
+
+// StepState is the persisted progress of one step.
+type StepState struct {
+	ID       string            `json:"id" firestore:"id"`
+	Kind     string            `json:"kind" firestore:"kind"`
+	After    []string          `json:"after,omitempty" firestore:"after"` // resolved dependencies
+	Status   string            `json:"status" firestore:"status"`
+	Output   map[string]string `json:"output,omitempty" firestore:"output"`
+	Error    string            `json:"error,omitempty" firestore:"error"`
+	Reason   string            `json:"reason,omitempty" firestore:"reason"`       // why it was skipped or cancelled
+	ActionID string            `json:"action_id,omitempty" firestore:"action_id"` // action document it created
+	Started  *time.Time        `json:"started,omitempty" firestore:"started"`
+	Finished *time.Time        `json:"finished,omitempty" firestore:"finished"`
+}
+
+// NewRun starts pb for an alert with every step pending.
+func NewRun(id, alertID string, pb Playbook, f match.Fields, now time.Time) Run {
+	r := Run{
+		RunID:    id,
+		AlertID:  alertID,
+		Playbook: pb,
+		Status:   RunRunning,
+		Context:  f,
+		Created:  now,
+		Updated:  now,
+	}
+	for i, s := range pb.Steps {
+		r.Steps = append(r.Steps, StepState{ID: s.ID, Kind: s.Kind, After: deps(pb.Steps, i), Status: StepPending})
+	}
+	return r
+}
+
+// State returns the progress of step id.
+func (r *Run) State(id string) *StepState {
+	for i := range r.Steps {
+		if r.Steps[i].ID == id {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Fields is what step conditions and text see: the alert context plus
+// steps.<id>.status, steps.<id>.error and steps.<id>.<output key>.
+func (r *Run) Fields() match.Fields {
+	f := match.Fields{}
+	for k, v := range r.Context {
+		f[k] = v
+	}
+	for _, st := range r.Steps {
+		p := "steps." + st.ID + "."
+		f[p+"status"] = st.Status
+		if st.Error != "" {
+			f[p+"error"] = st.Error
+		}
+		for k, v := range st.Output {
+			f[p+k] = v
+		}
+	}
+	return f
+}
+
+// Resume returns steps interrupted mid-run (the instance driving them died)
+// to pending so they are retried.
+func (r *Run) Resume() {
+	for i := range r.Steps {
+		if r.Steps[i].Status == StepRunning {
+			r.Steps[i].Status, r.Steps[i].Started = StepPending, nil
+		}
+	}
+}
+
+// Plan settles pending steps whose dependencies have finished – skipping or
+// cancelling those that should not run – and returns the ones that can start
+// now, in definition order. It also brings r.Status up to date.
+func (r *Run) Plan(now time.Time) []Step {
+	for changed := true; changed; {
+		changed = false
+		for i := range r.Steps {
+			st := &r.Steps[i]
+			if st.Status != StepPending {
+				continue
+			}
+			finished, failed := r.depsDone(st)
+			if !finished {
+				continue
+			}
+			def := r.Playbook.Steps[i]
+			status, reason := "", ""
+			switch def.RunOn {
+			case RunOnFailure:
+				if !failed {
+					status, reason = StepSkipped, "no dependency failed"
+				}
+			case RunOnAlways:
+			default:
+				if failed {
+					status, reason = StepCancelled, "a dependency failed"
+				}
+			}
+			if status == "" && !match.All(def.When, r.Fields()) {
+				status, reason = StepSkipped, "conditions not met"
+			}
+			if status != "" {
+				st.Status, st.Reason, st.Finished = status, reason, &now
+				changed = true
+			}
+		}
+	}
+
+	var ready []Step
+	waiting, failed := false, false
+	for i, st := range r.Steps {
+		switch st.Status {
+		case StepPending:
+			if done, _ := r.depsDone(&r.Steps[i]); done {
+				ready = append(ready, r.Playbook.Steps[i])
+			}
+		case StepWaiting:
+			waiting = true
+		case StepFailed:
+			failed = true
+		}
+	}
+	r.Updated = now
+	switch {
+	case len(ready) > 0:
+		r.Status = RunRunning
+	case waiting:
+		r.Status = RunWaiting
+	case failed:
+		r.Status, r.Finished = RunFailed, &now
+	default:
+		r.Status, r.Finished = RunSucceeded, &now
+	}
+	return ready
+}
+
+// Done reports whether the run has finished.
+func (r *Run) Done() bool {
+	return r.Status == RunSucceeded || r.Status == RunFailed
+}
+
+// depsDone reports whether all of st's dependencies have finished and
+// whether any of them failed (or was cancelled by a failure).
+func (r *Run) depsDone(st *StepState) (finished, failed bool) {
+	for _, d := range st.After {
+		dep := r.State(d)
+		if dep == nil {
+			continue
+		}
+		switch dep.Status {
+		case StepSucceeded, StepSkipped:
+		case StepFailed, StepCancelled:
+			failed = true
+		default:
+			return false, false
+		}
+	}
+	return true, failed
+}
+
+// Expand replaces ${field} in text with values from f.
+func Expand(text string, f match.Fields) string {
+	return os.Expand(text, func(k string) string { return f[k] })
+}
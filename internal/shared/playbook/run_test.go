@@ -0,0 +1,147 @@
+package playbook
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+func TestPlan(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// enrich ─┬─ contain ─┬─ verify               (success)
+	//         │           ├─ page    run_on failure
+	//         │           └─ close   run_on always
+	//         └─ review   when severity=high
+	// notify: a root
+	pb := Playbook{Name: "p", Steps: []Step{
+		{ID: "enrich", Kind: KindEnrich},
+		{ID: "contain", Kind: KindContain, Action: "revoke_sa_key"},
+		{ID: "verify", Kind: KindVerify, Action: "revoke_sa_key"},
+		{ID: "page", Kind: KindNotify, After: []string{"contain"}, RunOn: RunOnFailure},
+		{ID: "close", Kind: KindNotify, After: []string{"contain"}, RunOn: RunOnAlways},
+		{ID: "review", Kind: KindWaitForApproval, After: []string{"enrich"},
+			When: []match.Cond{{Field: "severity", Op: "eq", Value: "high"}}},
+		{ID: "notify", Kind: KindNotify, After: []string{}},
+	}}
+
+	tests := []struct {
+		name     string
+		severity string
+		set      map[string]string // step id → status before planning
+		ready    []string
+		statuses map[string]string // expected step statuses after planning
+		run      string
+	}{
+		{
+			name:  "roots start together",
+			ready: []string{"enrich", "notify"},
+			run:   RunRunning,
+		},
+		{
+			name:     "unmet condition skips, implicit dependency follows",
+			severity: "low",
+			set:      map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded},
+			ready:    []string{"contain"},
+			statuses: map[string]string{"review": StepSkipped, "verify": StepPending},
+			run:      RunRunning,
+		},
+		{
+			name:     "met condition runs in parallel",
+			severity: "high",
+			set:      map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded},
+			ready:    []string{"contain", "review"},
+			run:      RunRunning,
+		},
+		{
+			name:     "waiting step blocks its dependents",
+			severity: "low",
+			set:      map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded, "contain": StepWaiting},
+			statuses: map[string]string{"verify": StepPending, "page": StepPending, "close": StepPending},
+			run:      RunWaiting,
+		},
+		{
+			name:     "success runs the success and always branches",
+			severity: "low",
+			set:      map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded, "contain": StepSucceeded},
+			ready:    []string{"verify", "close"},
+			statuses: map[string]string{"page": StepSkipped, "review": StepSkipped},
+			run:      RunRunning,
+		},
+		{
+			name:     "failure cancels the success branch",
+			severity: "low",
+			set:      map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded, "contain": StepFailed},
+			ready:    []string{"page", "close"},
+			statuses: map[string]string{"verify": StepCancelled},
+			run:      RunRunning,
+		},
+		{
+			name:     "cancellation cascades as a failure",
+			severity: "high",
+			set:      map[string]string{"enrich": StepFailed, "notify": StepSucceeded},
+			ready:    []string{"page", "close"},
+			statuses: map[string]string{"contain": StepCancelled, "verify": StepCancelled, "review": StepCancelled},
+			run:      RunRunning,
+		},
+		{
+			name:     "finished with a failure",
+			severity: "low",
+			set: map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded, "contain": StepFailed,
+				"page": StepSucceeded, "close": StepSucceeded},
+			run: RunFailed,
+		},
+		{
+			name:     "finished",
+			severity: "low",
+			set: map[string]string{"enrich": StepSucceeded, "notify": StepSucceeded, "contain": StepSucceeded,
+				"verify": StepSucceeded, "close": StepSucceeded},
+			statuses: map[string]string{"page": StepSkipped, "review": StepSkipped},
+			run:      RunSucceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRun("run", "alert", pb, match.Fields{"severity": tt.severity}, t0)
+			for id, status := range tt.set {
+				r.State(id).Status = status
+			}
+			var ready []string
+			for _, s := range r.Plan(t0) {
+				ready = append(ready, s.ID)
+			}
+			if !slices.Equal(ready, tt.ready) {
+				t.Errorf("ready = %v, want %v", ready, tt.ready)
+			}
+			for _, id := range slices.Sorted(maps.Keys(tt.statuses)) {
+				if got := r.State(id).Status; got != tt.statuses[id] {
+					t.Errorf("step %s = %s, want %s", id, got, tt.statuses[id])
+				}
+			}
+			if r.Status != tt.run {
+				t.Errorf("run = %s, want %s", r.Status, tt.run)
+			}
+			if r.Done() != (r.Finished != nil) {
+				t.Errorf("done = %v but finished = %v", r.Done(), r.Finished)
+			}
+		})
+	}
+}
+
+func TestResumeRetriesInterruptedSteps(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	pb := Playbook{Name: "p", Steps: []Step{{ID: "a", Kind: KindEnrich}, {ID: "b", Kind: KindContain}}}
+	r := NewRun("run", "alert", pb, nil, t0)
+	r.State("a").Status = StepSucceeded
+	r.State("b").Status, r.State("b").Started = StepRunning, &t0
+
+	r.Resume()
+	if st := r.State("b"); st.Status != StepPending || st.Started != nil {
+		t.Fatalf("interrupted step not reset: %+v", st)
+	}
+	if ready := r.Plan(t0); len(ready) != 1 || ready[0].ID != "b" {
+		t.Fatalf("ready = %v, want [b]", ready)
+	}
+}
@@ -0,0 +1,31 @@
+// Package secrets reads the services' credentials from Secret Manager.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	smpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+)
+
+// Store reads the secrets of one project. Client may be set after Access
+// has been handed out, as long as it is set before the first call.
+type Store struct {
+	Project string
+	Client  *secretmanager.Client
+}
+
+// Access returns the latest version of secret id.
+func (s *Store) Access(ctx context.Context, id string) (string, error) {
+	if s.Client == nil {
+		return "", errors.New("secret manager client not initialized")
+	}
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", s.Project, id)
+	resp, err := s.Client.AccessSecretVersion(ctx, &smpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Payload.Data), nil
+}
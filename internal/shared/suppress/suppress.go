@@ -0,0 +1,63 @@
+package suppress
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// Rule silences events matching all of its conditions until it expires.
+type Rule struct {
+	ID            string       `json:"id" firestore:"id"`
+	Name          string       `json:"name" firestore:"name"`
+	Conditions    []match.Cond `json:"conditions" firestore:"conditions"`
+	Owner         string       `json:"owner" firestore:"owner"`
+	Justification string       `json:"justification" firestore:"justification"`
+	Expires       time.Time    `json:"expires" firestore:"expires"`
+	Created       time.Time    `json:"created" firestore:"created"`
+	Updated       time.Time    `json:"updated" firestore:"updated"`
+}
+
+// Validate enforces the required metadata: at least one condition, an owner,
+// a justification and an expiry in the future no further than maxTTL out.
+func (r Rule) Validate(now time.Time, maxTTL time.Duration) error {
+	if len(r.Conditions) == 0 {
+		return fmt.Errorf("at least one condition is required")
+	}
+	if err := match.ValidateAll(r.Conditions); err != nil {
+		return err
+	}
+	if strings.TrimSpace(r.Owner) == "" {
+		return fmt.Errorf("owner is required")
+	}
+	if strings.TrimSpace(r.Justification) == "" {
+		return fmt.Errorf("justification is required")
+	}
+	if r.Expires.IsZero() {
+		return fmt.Errorf("expires is required")
+	}
+	if !r.Expires.After(now) {
+		return fmt.Errorf("expires must be in the future")
+	}
+	if maxTTL > 0 && r.Expires.After(now.Add(maxTTL)) {
+		return fmt.Errorf("expires may be at most %s out", maxTTL)
+	}
+	return nil
+}
+
+// Active reports whether the rule is still in force at now.
+func (r Rule) Active(now time.Time) bool {
+	return r.Expires.After(now)
+}
+
+// First returns the first active rule matching f, or nil.
+func First(rules []Rule, f match.Fields, now time.Time) *Rule {
+	for i := range rules {
+		if rules[i].Active(now) && match.All(rules[i].Conditions, f) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package shared
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 type Severity string
 
@@ -10,6 +14,47 @@ const (
 	SeverityHigh   Severity = "high"
 )
 
+// Rank orders severities for comparison; unknown values rank lowest.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// MaxSeverity returns the more severe of a and b.
+func MaxSeverity(a, b Severity) Severity {
+	if b.Rank() > a.Rank() {
+		return b
+	}
+	return a
+}
+
+// Duration is a time.Duration that reads "10m"-style strings from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
 type Event struct {
 	ID           string    `json:"id"`
 	EventType    string    `json:"event_type"`
@@ -22,6 +67,44 @@ type Event struct {
 	TS           time.Time `json:"ts"`
 }
 
+// Field returns an event attribute by its JSON name; labels are joined with
+// commas. Unknown names return "".
+func (e Event) Field(name string) string {
+	switch name {
+	case "id":
+		return e.ID
+	case "event_type":
+		return e.EventType
+	case "principal":
+		return e.Principal
+	case "target":
+		return e.Target
+	case "network":
+		return e.Network
+	case "severity_hint":
+		return e.SeverityHint
+	case "labels":
+		return strings.Join(e.Labels, ",")
+	case "description":
+		return e.Description
+	case "project":
+		return Project(e.Target)
+	}
+	return ""
+}
+
+// Project returns the project a resource name such as
+// projects/p/instances/i lives in, or "" if it names none.
+func Project(resource string) string {
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "projects" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
 // LabeledEvent is used only for training/evaluation datasets.
 type LabeledEvent struct {
 	Event
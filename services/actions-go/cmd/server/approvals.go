@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// sweep outcomes for one action
+const (
+	stepNone = iota
+	stepEscalate
+	stepExpire
+)
+
+// runApprovalSweeper checks pending approvals every interval. Cloud Scheduler
+// can drive /tasks/approvals instead when instances scale to zero.
+func runApprovalSweeper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, _, err := sweepApprovals(ctx); err != nil {
+				log.Printf("approval sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func handleApprovalsTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	escalated, expired, err := sweepApprovals(r.Context())
+	if err != nil {
+		log.Printf("approval sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"escalated": escalated, "expired": expired})
+}
+
+// sweepApprovals re-announces approval requests whose escalation is due and
+// applies the policy default to those past their deadline.
+func sweepApprovals(ctx context.Context) (escalated, expired int, err error) {
+	docs, err := fsClient.Collection(actionsCol).Where("status", "==", actionAwaitingApproval).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now().UTC()
+	for _, snap := range docs {
+		var ad actionDoc
+		if err := snap.DataTo(&ad); err != nil || due(ad, now) == stepNone {
+			continue
+		}
+		step, ad, err := claimDue(ctx, snap.Ref, now)
+		if err != nil {
+			log.Printf("approval sweep %s error: %v", snap.Ref.ID, err)
+			continue
+		}
+		switch step {
+		case stepEscalate:
+			escalateApproval(ctx, ad)
+			escalated++
+		case stepExpire:
+			expireApproval(ctx, ad)
+			expired++
+		}
+	}
+	return escalated, expired, nil
+}
+
+// due reports which timer, if any, has fired for a pending action.
+func due(ad actionDoc, now time.Time) int {
+	if ad.Status != actionAwaitingApproval {
+		return stepNone
+	}
+	if ad.ApprovalDeadline != nil && ad.ExpiredAt == nil && !now.Before(*ad.ApprovalDeadline) {
+		return stepExpire
+	}
+	if ad.NextEscalation != nil && !now.Before(*ad.NextEscalation) {
+		return stepEscalate
+	}
+	return stepNone
+}
+
+// claimDue advances the action's timers in a transaction so that only one
+// instance acts on each escalation or expiry.
+func claimDue(ctx context.Context, ref *firestore.DocumentRef, now time.Time) (int, actionDoc, error) {
+	var ad actionDoc
+	step := stepNone
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		ad = actionDoc{}
+		if err := snaps[0].DataTo(&ad); err != nil {
+			return err
+		}
+		step = due(ad, now)
+		switch step {
+		case stepEscalate:
+			p := approvalPolicies.For(ad.ProposedAction)
+			ad.Escalations++
+			ad.NextEscalation = p.NextEscalation(now, ad.ApprovalDeadline)
+			return tx.Update(ref, []firestore.Update{
+				{Path: "escalations", Value: ad.Escalations},
+				{Path: "next_escalation", Value: ad.NextEscalation},
+			})
+		case stepExpire:
+			ad.ExpiredAt, ad.NextEscalation = &now, nil
+			updates := []firestore.Update{
+				{Path: "expired_at", Value: now},
+				{Path: "next_escalation", Value: nil},
+			}
+			var status string
+			switch ad.OnExpiry {
+			case approval.OnExpiryAutoExecute:
+				status = actionApproved
+			case approval.OnExpiryAutoReject:
+				status = actionRejected
+			default:
+				return tx.Update(ref, updates)
+			}
+			reason := "approval deadline passed; " + ad.OnExpiry
+			ad.Status, ad.DecidedBy, ad.DecisionReason, ad.DecidedAt = status, "actions-go", reason, &now
+			return tx.Update(ref, append(updates,
+				firestore.Update{Path: "status", Value: status},
+				firestore.Update{Path: "decided_by", Value: "actions-go"},
+				firestore.Update{Path: "decision_reason", Value: reason},
+				firestore.Update{Path: "decided_at", Value: now}))
+		}
+		return nil
+	})
+	return step, ad, err
+}
+
+func escalateApproval(ctx context.Context, ad actionDoc) {
+	note := fmt.Sprintf("approval reminder #%d for %s", ad.Escalations, ad.ProposedAction)
+	noteAlert(ctx, ad.AlertID, note)
+	msg := fmt.Sprintf(":rotating_light: Still awaiting approval: *%s* on alert `%s` (%d/%d approvals%s)",
+		ad.ProposedAction, ad.AlertID, len(ad.Approvals), ad.ApprovalsRequired, deadlineNote(ad))
+	notifier.Notify(ctx, approvalMessage(ad, notify.EventApprovalEscalated, msg))
+	log.Printf("escalated approval for action=%s alert=%s (#%d)", ad.ActionID, ad.AlertID, ad.Escalations)
+}
+
+func expireApproval(ctx context.Context, ad actionDoc) {
+	reason := "approval deadline passed for " + ad.ProposedAction
+	switch ad.OnExpiry {
+	case approval.OnExpiryAutoExecute:
+		noteAlert(ctx, ad.AlertID, reason+"; auto-executing")
+		workAction(ctx, ad.ActionID)
+	case approval.OnExpiryAutoReject:
+		if ad.RollbackOf != "" {
+			// a rejected rollback leaves the alert where it is
+			noteAlert(ctx, ad.AlertID, reason+"; auto-rejected")
+		} else {
+			setStatus(ctx, ad.AlertID, lifecycle.StatusRejected, reason+"; auto-rejected")
+		}
+		notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalRejected,
+			fmt.Sprintf(":no_entry: Approval for *%s* on alert `%s` expired; auto-rejected.", ad.ProposedAction, ad.AlertID)))
+	default:
+		noteAlert(ctx, ad.AlertID, reason+"; left open")
+		msg := fmt.Sprintf(":hourglass: Approval deadline passed for *%s* on alert `%s`; still open.", ad.ProposedAction, ad.AlertID)
+		notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalExpired, msg))
+	}
+	log.Printf("approval expired for action=%s alert=%s (%s)", ad.ActionID, ad.AlertID, ad.OnExpiry)
+	if ad.OnExpiry == approval.OnExpiryAutoReject && ad.PlaybookRunID != "" {
+		driveRun(ctx, ad.PlaybookRunID) // the waiting step fails
+	}
+}
+
+// noteAlert records a step in the alert's history without changing status.
+func noteAlert(ctx context.Context, alertID, note string) {
+	ref := fsClient.Collection(alertsCol).Doc(alertID)
+	if err := lifecycle.Note(ctx, fsClient, ref, "actions-go", note); err != nil {
+		log.Printf("alert %s note: %v", alertID, err)
+	}
+}
+
+// deadlineNote annotates approval messages with the deadline, if any.
+func deadlineNote(ad actionDoc) string {
+	if ad.ApprovalDeadline == nil {
+		return ""
+	}
+	return fmt.Sprintf(", deadline %s, then %s", ad.ApprovalDeadline.Format(time.RFC3339), ad.OnExpiry)
+}
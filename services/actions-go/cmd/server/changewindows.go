@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/calendar"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// frozen returns the change freeze gating a at t, if a is disruptive and
+// its target's project is frozen, and when that freeze ends.
+func frozen(a actionDoc, t time.Time) (calendar.Entry, time.Time, bool) {
+	if !changeCalendar.IsDisruptive(a.ProposedAction) {
+		return calendar.Entry{}, time.Time{}, false
+	}
+	return changeCalendar.Active(calendar.KindFreeze, shared.Project(a.Details["target"]), t)
+}
+
+// gateFreeze applies freeze fr's policy to a new action: hold it for
+// approval or defer it to the end of the freeze.
+func gateFreeze(a *actionDoc, fr calendar.Entry, until time.Time) {
+	if changeCalendar.FreezePolicy(fr) == calendar.OnFreezeRequireApproval {
+		holdForApproval(a, "change freeze "+fr.Name, a.Created)
+		return
+	}
+	a.NextAttemptAt, a.DeferredUntil = &until, &until
+}
+
+// deferAction puts a claimed action back in the queue until the freeze
+// ends. The attempt it was claimed for is not counted.
+func deferAction(ctx context.Context, a actionDoc, freeze string, until time.Time) {
+	a.DeferredUntil = &until
+	if _, err := fsClient.Collection(actionsCol).Doc(a.ActionID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: actionQueued},
+		{Path: "attempts", Value: a.Attempts - 1},
+		{Path: "lease_until", Value: nil},
+		{Path: "next_attempt_at", Value: until},
+		{Path: "deferred_until", Value: until},
+	}); err != nil {
+		log.Printf("firestore action %s update error: %v", a.ActionID, err)
+		return
+	}
+	announceDeferred(ctx, a, freeze)
+}
+
+// announceDeferred notes on the alert that a waits for freeze to end; the
+// action sweeper queues it once it is due.
+func announceDeferred(ctx context.Context, a actionDoc, freeze string) {
+	until := a.DeferredUntil.Format(time.RFC3339)
+	noteAlert(ctx, a.AlertID, fmt.Sprintf("%s deferred until %s (change freeze %s)", a.ProposedAction, until, freeze))
+	notifier.Notify(ctx, actionMessage(a, notify.EventActionDeferred, fmt.Sprintf(":snowflake: Deferred *%s* on alert `%s` until %s: change freeze %s.",
+		a.ProposedAction, a.AlertID, until, freeze)))
+	log.Printf("deferred action=%s (%s) for alert=%s until %s (freeze %s)", a.ProposedAction, a.ActionID, a.AlertID, until, freeze)
+}
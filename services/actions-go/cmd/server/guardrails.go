@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/guardrail"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// automated reports whether the action would run without a human having
+// signed off, which is what the guardrails limit. An approval that expired
+// into auto_execute counts as automated.
+func automated(a actionDoc) bool {
+	return a.RollbackOf == "" && (a.DecidedBy == "" || a.DecidedBy == "actions-go")
+}
+
+// guard decides whether a contain step's action may run unattended. It
+// returns why the action must be approved instead, or "" to let it run and
+// count it against the rate limits. f are the run's alert fields. If the
+// guardrail state cannot be read the action is held: guardrails fail closed.
+func guard(ctx context.Context, a actionDoc, f match.Fields) string {
+	ks, err := killSwitch(ctx)
+	if err != nil {
+		log.Printf("guardrails: kill switch read error: %v", err)
+		return "guardrails unavailable"
+	}
+	if ks.Engaged {
+		return killSwitchReason(ks)
+	}
+
+	project := guardrail.Project(a.Details["target"])
+	pf := match.Fields{}
+	for k, v := range f {
+		pf[k] = v
+	}
+	pf["action"], pf["project"] = a.ProposedAction, project
+	if name, ok := guardrails.ProtectedBy(pf); ok {
+		return "protected resource (" + name + ")"
+	}
+
+	reason, tripped, err := admit(ctx, a.ProposedAction, project)
+	if err != nil {
+		log.Printf("guardrails: admit %s error: %v", a.ActionID, err)
+		return "guardrails unavailable"
+	}
+	if tripped {
+		notifier.Notify(ctx, actionMessage(a, notify.EventGuardrail, fmt.Sprintf(":rotating_light: Guardrail tripped: %s. Automated *%s* actions need approval for the next %s.",
+			reason, a.ProposedAction, time.Duration(guardrails.Breaker.Cooldown))))
+	}
+	return reason
+}
+
+// admit checks the breaker and every limit that applies to action in
+// project, in one transaction so concurrent steps cannot overrun a limit.
+// When all pass the action is counted. tripped reports a limit opening now.
+func admit(ctx context.Context, action, project string) (reason string, tripped bool, err error) {
+	col := fsClient.Collection(guardrailsCol)
+	refs := []*firestore.DocumentRef{col.Doc(guardrails.Breaker.Key(action))}
+	var limits []guardrail.Limit
+	for _, l := range guardrails.Limits {
+		if key, ok := l.Key(action, project); ok {
+			refs = append(refs, col.Doc(key))
+			limits = append(limits, l)
+		}
+	}
+
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		reason, tripped = "", false
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		states := make([]guardrail.State, len(snaps))
+		for i, snap := range snaps {
+			states[i] = guardrail.State{Key: refs[i].ID}
+			if snap.Exists() {
+				if err := snap.DataTo(&states[i]); err != nil {
+					return err
+				}
+			}
+		}
+		now := time.Now().UTC()
+		if states[0].IsOpen(now) {
+			reason = states[0].Reason
+			return nil
+		}
+		cooldown := time.Duration(guardrails.Breaker.Cooldown)
+		for i, l := range limits {
+			st := &states[i+1]
+			wasOpen := st.IsOpen(now)
+			if r := l.Check(st, now, cooldown); r != "" {
+				reason, tripped = r, !wasOpen
+				if tripped {
+					return tx.Set(refs[i+1], *st)
+				}
+				return nil
+			}
+		}
+		for i := range limits {
+			states[i+1].Record(now)
+			if err := tx.Set(refs[i+1], states[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return reason, tripped, err
+}
+
+// heldReason re-checks an automated action as a worker picks it up: the
+// kill switch or breaker may have flipped since it was queued. Rate limits
+// already counted it and are not consulted again.
+func heldReason(ctx context.Context, a actionDoc) string {
+	ks, err := killSwitch(ctx)
+	if err != nil {
+		log.Printf("guardrails: kill switch read error: %v", err)
+		return "guardrails unavailable"
+	}
+	if ks.Engaged {
+		return killSwitchReason(ks)
+	}
+	snap, err := fsClient.Collection(guardrailsCol).Doc(guardrails.Breaker.Key(a.ProposedAction)).Get(ctx)
+	if err != nil {
+		if snap != nil && !snap.Exists() {
+			return ""
+		}
+		log.Printf("guardrails: breaker read error: %v", err)
+		return "guardrails unavailable"
+	}
+	var st guardrail.State
+	if err := snap.DataTo(&st); err == nil && st.IsOpen(time.Now()) {
+		return st.Reason
+	}
+	return ""
+}
+
+// holdForApproval puts an automated action a guardrail or change freeze
+// stopped up for approval. Such a hold never auto-executes on expiry: the
+// worker does not re-check protected resources or rate limits, so it is
+// left open instead.
+func holdForApproval(a *actionDoc, reason string, now time.Time) {
+	awaitApproval(a, now)
+	a.Guardrail = reason
+	if a.OnExpiry == approval.OnExpiryAutoExecute {
+		a.OnExpiry = approval.OnExpiryLeaveOpen
+	}
+}
+
+// holdAction sends a claimed automated action back to approval instead of
+// running it, clearing any expiry decision. The attempt it was claimed for
+// is not counted.
+func holdAction(ctx context.Context, a actionDoc, reason string) {
+	now := time.Now().UTC()
+	holdForApproval(&a, reason, now)
+	if _, err := fsClient.Collection(actionsCol).Doc(a.ActionID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: a.Status},
+		{Path: "guardrail", Value: reason},
+		{Path: "attempts", Value: a.Attempts - 1},
+		{Path: "lease_until", Value: nil},
+		{Path: "approvals_required", Value: a.ApprovalsRequired},
+		{Path: "approval_deadline", Value: a.ApprovalDeadline},
+		{Path: "next_escalation", Value: a.NextEscalation},
+		{Path: "on_expiry", Value: a.OnExpiry},
+		{Path: "escalations", Value: 0},
+		{Path: "expired_at", Value: nil},
+		{Path: "decided_by", Value: ""},
+		{Path: "decision_reason", Value: ""},
+		{Path: "decided_at", Value: nil},
+	}); err != nil {
+		log.Printf("firestore action %s update error: %v", a.ActionID, err)
+		return
+	}
+	requestHeldApproval(ctx, a)
+}
+
+// requestHeldApproval moves the alert to awaiting_approval and asks for
+// sign-off on an action a guardrail stopped.
+func requestHeldApproval(ctx context.Context, a actionDoc) {
+	setStatus(ctx, a.AlertID, lifecycle.StatusAwaitingApproval, "guardrail held "+a.ProposedAction+": "+a.Guardrail)
+	notifier.Notify(ctx, approvalMessage(a, notify.EventActionHeld, fmt.Sprintf(":octagonal_sign: Guardrail held *%s* on alert `%s` for approval: %s%s",
+		a.ProposedAction, a.AlertID, a.Guardrail, deadlineNote(a))))
+	log.Printf("guardrail held action=%s (%s) for alert=%s: %s", a.ProposedAction, a.ActionID, a.AlertID, a.Guardrail)
+}
+
+// recordFailure counts a dead automated action towards its breaker.
+func recordFailure(ctx context.Context, a actionDoc) {
+	if guardrails.Breaker.Failures <= 0 {
+		return
+	}
+	ref := fsClient.Collection(guardrailsCol).Doc(guardrails.Breaker.Key(a.ProposedAction))
+	var st guardrail.State
+	opened := false
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		st = guardrail.State{Key: ref.ID}
+		if snaps[0].Exists() {
+			if err := snaps[0].DataTo(&st); err != nil {
+				return err
+			}
+		}
+		opened = guardrails.Breaker.Fail(&st, time.Now().UTC())
+		return tx.Set(ref, st)
+	})
+	if err != nil {
+		log.Printf("guardrails: breaker %s update error: %v", ref.ID, err)
+		return
+	}
+	if opened {
+		notifier.Notify(ctx, actionMessage(a, notify.EventGuardrail, fmt.Sprintf(":rotating_light: Guardrail tripped: %s. Automated *%s* actions need approval until %s.",
+			st.Reason, a.ProposedAction, st.OpenUntil.Format(time.RFC3339))))
+	}
+}
+
+func killSwitch(ctx context.Context) (guardrail.KillSwitch, error) {
+	var ks guardrail.KillSwitch
+	snap, err := fsClient.Collection(guardrailsCol).Doc(guardrail.KillSwitchDoc).Get(ctx)
+	if err != nil {
+		if snap != nil && !snap.Exists() {
+			return ks, nil
+		}
+		return ks, err
+	}
+	return ks, snap.DataTo(&ks)
+}
+
+func killSwitchReason(ks guardrail.KillSwitch) string {
+	reason := "kill switch engaged by " + ks.By
+	if ks.Reason != "" {
+		reason += ": " + ks.Reason
+	}
+	return reason
+}
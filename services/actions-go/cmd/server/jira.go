@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/jira"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// issueClaimTTL is how long a claim to file an alert's issue holds before
+// another worker may take it over.
+const issueClaimTTL = 5 * time.Minute
+
+// A failed issue is retried by the Jira sweep after attempts × issueClaimTTL,
+// at most issueRetryMax, and given up on after issueMaxAttempts.
+const (
+	issueMaxAttempts = 10
+	issueRetryMax    = time.Hour
+)
+
+// fileIssue opens a Jira issue for the alert when a JIRA_FILE policy
+// matches it, storing the issue key on the alert. An escalated repeat of an
+// alert that already has an issue comments on it instead. The alert is
+// claimed first (issue_pending), so concurrent deliveries file one issue,
+// and every issue carries the alert's label, so a worker taking over a
+// lapsed claim finds the issue its predecessor filed. When Jira fails, the
+// alert is left for the Jira sweep to retry (retryIssue).
+func fileIssue(ctx context.Context, alertID string, f match.Fields) {
+	if jiraClient == nil {
+		return
+	}
+	cfg := jiraClient.Config()
+	policy, ok := cfg.Wants(f)
+	if !ok {
+		return
+	}
+	ref := fsClient.Collection(alertsCol).Doc(alertID)
+	key, claimed, takeover, err := claimIssue(ctx, ref)
+	if err != nil {
+		log.Printf("jira: alert %s claim error: %v", alertID, err)
+		return
+	}
+	if key != "" {
+		if f["escalated"] != "true" {
+			return // redelivery: already filed
+		}
+		text := fmt.Sprintf("Alert %s escalated to %s after %s occurrences.", alertID, f["severity"], f["occurrences"])
+		if err := jiraClient.Comment(ctx, key, text); err != nil {
+			log.Printf("jira: comment on %s for alert %s: %v", key, alertID, err)
+		}
+		return
+	}
+	if !claimed {
+		return // another worker is filing it
+	}
+
+	if takeover {
+		if key, err = jiraClient.FindByLabel(ctx, jira.AlertLabel(alertID)); err != nil {
+			log.Printf("jira: search issue for alert %s: %v", alertID, err)
+			retryIssue(ctx, ref, f)
+			return
+		}
+	}
+	if key == "" {
+		m, ok := cfg.MappingFor(f["project"])
+		if !ok {
+			log.Printf("jira: no project mapping for alert %s (project %q)", alertID, f["project"])
+			releaseIssue(ctx, ref)
+			return
+		}
+		if key, err = jiraClient.Create(ctx, m, f); err != nil {
+			log.Printf("jira: create issue for alert %s: %v", alertID, err)
+			retryIssue(ctx, ref, f)
+			return
+		}
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "issue_key", Value: key},
+		{Path: "issue_url", Value: jiraClient.IssueURL(key)},
+		{Path: "issue_pending", Value: firestore.Delete},
+		{Path: "issue_retry_at", Value: firestore.Delete},
+		{Path: "issue_fields", Value: firestore.Delete},
+		{Path: "issue_attempts", Value: firestore.Delete},
+	}); err != nil {
+		log.Printf("jira: alert %s issue %s write error: %v", alertID, key, err)
+		return
+	}
+	log.Printf("jira: alert %s filed as %s (policy %s)", alertID, key, policy)
+}
+
+// claimIssue marks the alert as having its issue filed by this worker. It
+// returns the issue key if one is stored already; claimed is false while
+// another worker's claim holds, and takeover is true when a lapsed claim
+// was taken over or an earlier attempt failed, either of which may have
+// filed the issue already.
+func claimIssue(ctx context.Context, ref *firestore.DocumentRef) (key string, claimed, takeover bool, err error) {
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		key, claimed, takeover = "", false, false
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return fmt.Errorf("alert %s not found", ref.ID)
+		}
+		var a struct {
+			IssueKey      string     `firestore:"issue_key"`
+			IssuePending  *time.Time `firestore:"issue_pending"`
+			IssueAttempts int        `firestore:"issue_attempts"`
+		}
+		if err := snaps[0].DataTo(&a); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		switch {
+		case a.IssueKey != "":
+			key = a.IssueKey
+			return nil
+		case a.IssuePending != nil && now.Sub(*a.IssuePending) < issueClaimTTL:
+			return nil
+		}
+		claimed, takeover = true, a.IssuePending != nil || a.IssueAttempts > 0
+		return tx.Update(ref, []firestore.Update{{Path: "issue_pending", Value: now}})
+	})
+	return key, claimed, takeover, err
+}
+
+// releaseIssue drops this worker's claim, and any retry, without filing:
+// the alert has no project mapping, so trying again would not help.
+func releaseIssue(ctx context.Context, ref *firestore.DocumentRef) {
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "issue_pending", Value: firestore.Delete},
+		{Path: "issue_retry_at", Value: firestore.Delete},
+		{Path: "issue_fields", Value: firestore.Delete},
+	}); err != nil {
+		log.Printf("jira: alert %s release error: %v", ref.ID, err)
+	}
+}
+
+// retryIssue drops this worker's claim after Jira failed and schedules the
+// alert for the Jira sweep, storing the alert fields the retry needs. After
+// issueMaxAttempts it is given up on.
+func retryIssue(ctx context.Context, ref *firestore.DocumentRef, f match.Fields) {
+	n := 1
+	if snap, err := ref.Get(ctx); err == nil {
+		if v, ok := snap.Data()["issue_attempts"].(int64); ok {
+			n += int(v)
+		}
+	}
+	updates := []firestore.Update{
+		{Path: "issue_pending", Value: firestore.Delete},
+		{Path: "issue_attempts", Value: n},
+	}
+	if n >= issueMaxAttempts {
+		log.Printf("jira: giving up on the issue for alert %s after %d attempts", ref.ID, n)
+		updates = append(updates,
+			firestore.Update{Path: "issue_retry_at", Value: firestore.Delete},
+			firestore.Update{Path: "issue_fields", Value: firestore.Delete})
+	} else {
+		next := time.Now().UTC().Add(min(time.Duration(n)*issueClaimTTL, issueRetryMax))
+		updates = append(updates,
+			firestore.Update{Path: "issue_retry_at", Value: next},
+			firestore.Update{Path: "issue_fields", Value: f})
+	}
+	if _, err := ref.Update(ctx, updates); err != nil {
+		log.Printf("jira: alert %s retry error: %v", ref.ID, err)
+	}
+}
+
+func runJiraSweeper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := retryIssues(ctx); err != nil {
+				log.Printf("jira sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func handleJiraTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := retryIssues(r.Context())
+	if err != nil {
+		log.Printf("jira sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"retried": n})
+}
+
+// retryIssues files the issues of alerts whose last attempt failed and whose
+// retry is due. It returns how many it tried.
+func retryIssues(ctx context.Context) (int, error) {
+	if jiraClient == nil {
+		return 0, nil
+	}
+	docs, err := fsClient.Collection(alertsCol).Where("issue_retry_at", "<=", time.Now().UTC()).Limit(50).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, snap := range docs {
+		var a struct {
+			Fields map[string]string `firestore:"issue_fields"`
+		}
+		if err := snap.DataTo(&a); err != nil || a.Fields == nil {
+			log.Printf("jira: alert %s retry fields unreadable: %v", snap.Ref.ID, err)
+			releaseIssue(ctx, snap.Ref)
+			continue
+		}
+		f := match.Fields(a.Fields)
+		if _, ok := jiraClient.Config().Wants(f); !ok {
+			releaseIssue(ctx, snap.Ref) // the policy was removed since
+			continue
+		}
+		delete(f, "escalated") // only the filing is retried, not a repeat's comment
+		fileIssue(ctx, snap.Ref.ID, f)
+	}
+	return len(docs), nil
+}
@@ -1,58 +1,163 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	cloudpubsub "cloud.google.com/go/pubsub"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
-	smpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 
 	"github.com/google/uuid"
 
 	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/calendar"
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/guardrail"
+	"github.com/jinishshah00/sentinelflow/internal/shared/jira"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+	"github.com/jinishshah00/sentinelflow/internal/shared/playbook"
+	"github.com/jinishshah00/sentinelflow/internal/shared/secrets"
 )
 
 // ----------- types -----------
 type triageEnvelope struct {
-	Event  shared.Event `json:"event"`
-	Triage struct {
+	AlertID     string       `json:"alert_id"` // may differ from event.id for repeats
+	Fingerprint string       `json:"fingerprint"`
+	Occurrences int          `json:"occurrences"`
+	Escalated   bool         `json:"escalated"`
+	Event       shared.Event `json:"event"`
+	Triage      struct {
 		Severity     shared.Severity `json:"severity"`
 		Confidence   float64         `json:"confidence"`
 		ReasonTokens []string        `json:"reason_tokens"`
+		Anomaly      *struct {
+			Score   float64  `json:"score"`
+			Reasons []string `json:"reasons"`
+		} `json:"anomaly"`
+		ChangeWindow string `json:"change_window"`
+		ChangeFreeze string `json:"change_freeze"`
 	} `json:"triage"`
 }
 
 type actionDoc struct {
-	ActionID       string            `json:"action_id"`
-	AlertID        string            `json:"alert_id"`
-	ProposedAction string            `json:"proposed_action"`
-	Status         string            `json:"status"` // queued|awaiting_approval|executed
-	Simulation     bool              `json:"simulation"`
-	Details        map[string]string `json:"details,omitempty"`
-	Created        time.Time         `json:"created"`
-	ExecutedAt     *time.Time        `json:"executed_at,omitempty"`
+	ActionID       string            `json:"action_id" firestore:"action_id"`
+	AlertID        string            `json:"alert_id" firestore:"alert_id"`
+	ProposedAction string            `json:"proposed_action" firestore:"proposed_action"`
+	Status         string            `json:"status" firestore:"status"`         // see action statuses
+	Simulation     bool              `json:"simulation" firestore:"simulation"` // executor mode is dry_run
+	Details        map[string]string `json:"details,omitempty" firestore:"details"`
+	Created        time.Time         `json:"created" firestore:"created"`
+	ExecutedAt     *time.Time        `json:"executed_at,omitempty" firestore:"executed_at"`
+	RequestedBy    string            `json:"requested_by,omitempty" firestore:"requested_by"` // excluded from approving
+	Result         *executor.Result  `json:"result,omitempty" firestore:"result"`
+
+	// worker bookkeeping
+	Attempts      int        `json:"attempts,omitempty" firestore:"attempts"`
+	LastError     string     `json:"last_error,omitempty" firestore:"last_error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" firestore:"next_attempt_at"` // retry backoff
+	LeaseUntil    *time.Time `json:"lease_until,omitempty" firestore:"lease_until"`         // while running
+	Worker        string     `json:"worker,omitempty" firestore:"worker"`
+	EnqueuedAt    *time.Time `json:"enqueued_at,omitempty" firestore:"enqueued_at"`
+
+	// approval bookkeeping (approvals are added by api-go)
+	Approvals         []approval.Approval `json:"approvals,omitempty" firestore:"approvals"`
+	ApprovalsRequired int                 `json:"approvals_required,omitempty" firestore:"approvals_required"`
+	ApprovalDeadline  *time.Time          `json:"approval_deadline,omitempty" firestore:"approval_deadline"`
+	NextEscalation    *time.Time          `json:"next_escalation,omitempty" firestore:"next_escalation"`
+	Escalations       int                 `json:"escalations,omitempty" firestore:"escalations"`
+	OnExpiry          string              `json:"on_expiry,omitempty" firestore:"on_expiry"`
+	ExpiredAt         *time.Time          `json:"expired_at,omitempty" firestore:"expired_at"`
+	DecidedBy         string              `json:"decided_by,omitempty" firestore:"decided_by"`
+	DecisionReason    string              `json:"decision_reason,omitempty" firestore:"decision_reason"`
+	DecidedAt         *time.Time          `json:"decided_at,omitempty" firestore:"decided_at"`
+
+	// rollback links (rollbacks are proposed by api-go)
+	RollbackOf       string     `json:"rollback_of,omitempty" firestore:"rollback_of"`
+	RollbackActionID string     `json:"rollback_action_id,omitempty" firestore:"rollback_action_id"`
+	RolledBackAt     *time.Time `json:"rolled_back_at,omitempty" firestore:"rolled_back_at"`
+
+	// why a guardrail or change freeze sent an automated action to approval
+	Guardrail string `json:"guardrail,omitempty" firestore:"guardrail"`
+	// set while a change freeze defers the action
+	DeferredUntil *time.Time `json:"deferred_until,omitempty" firestore:"deferred_until"`
+
+	// playbook step that created the action, if any
+	PlaybookRunID string `json:"playbook_run_id,omitempty" firestore:"playbook_run_id"`
+	StepID        string `json:"step_id,omitempty" firestore:"step_id"`
 }
 
+// action statuses
+const (
+	actionQueued           = "queued"
+	actionAwaitingApproval = "awaiting_approval"
+	actionApproved         = "approved" // set by api-go; picked up from actions.queue
+	actionRunning          = "running"  // leased by a worker
+	actionSucceeded        = "succeeded"
+	actionFailed           = "failed" // last attempt failed; retry at next_attempt_at
+	actionDead             = "dead"   // retries exhausted or the error is permanent
+	actionRejected         = "rejected"
+	actionChangesRequested = "changes_requested" // set by api-go
+	actionRolledBack       = "rolled_back"       // undone by its rollback action
+)
+
 // ----------- globals -----------
 var (
 	projectID    string
 	fsClient     *firestore.Client
 	pubClient    *cloudpubsub.Client
-	smClient     *secretmanager.Client
+	secretStore  *secrets.Store
 	actionsCol   string
 	alertsCol    string
 	devPull      bool
 	subPull      string
-	slackSecret  string
+	subActions   string
 	topicActions string
+
+	anomalyReviewScore float64
+
+	executors          *executor.Registry
+	approvalPolicies   approval.Config
+	approvalSweepEvery time.Duration
+
+	playbooks          playbook.Config
+	runsCol            string
+	incidentsCol       string
+	ticketWebhook      string
+	playbookLease      time.Duration
+	playbookSweepEvery time.Duration
+
+	workerID          string
+	actionMaxAttempts int
+	actionRetryBase   time.Duration
+	actionRetryMax    time.Duration
+	actionLease       time.Duration
+	actionSweepEvery  time.Duration
+
+	guardrails    guardrail.Config
+	guardrailsCol string
+
+	changeCalendar calendar.Config
+
+	notifier         *notify.Router
+	notificationsCol string
+	throttleCol      string        // channel limits and pending digests
+	digestSweepEvery time.Duration // how often due digests are sent
+	approvalButtons  bool          // Approve/Reject buttons on Slack approval requests
+
+	jiraClient     *jira.Client  // nil unless JIRA_FILE is set
+	jiraSweepEvery time.Duration // how often failed issues are retried
 )
 
 // ----------- helpers -----------
@@ -79,12 +184,89 @@ func main() {
 	ctx := context.Background()
 
 	projectID = getenv("GOOGLE_CLOUD_PROJECT", "")
+	secretStore = &secrets.Store{Project: projectID}
 	actionsCol = getenv("FIRESTORE_COLLECTION_ACTIONS", "actions")
 	alertsCol = getenv("FIRESTORE_COLLECTION_ALERTS", "alerts")
 	devPull = getenv("DEV_PULL", "") == "1"
 	subPull = getenv("SUBSCRIPTION_PULL", "actions-dev")
-	slackSecret = getenv("SLACK_SECRET_ID", "SLACK_WEBHOOK")
+	subActions = getenv("SUBSCRIPTION_ACTIONS_PULL", "actions-queue-dev")
 	topicActions = getenv("TOPIC_ACTIONS_QUEUE", "actions.queue")
+	anomalyReviewScore = must(strconv.ParseFloat(getenv("ANOMALY_REVIEW_SCORE", "0.6"), 64))
+	approvalSweepEvery = must(time.ParseDuration(getenv("APPROVAL_SWEEP_INTERVAL", "1m")))
+	runsCol = getenv("FIRESTORE_COLLECTION_PLAYBOOK_RUNS", "playbook_runs")
+	incidentsCol = getenv("FIRESTORE_COLLECTION_INCIDENTS", "incidents")
+	ticketWebhook = getenv("TICKET_WEBHOOK_URL", "")
+	playbookLease = must(time.ParseDuration(getenv("PLAYBOOK_LEASE", "5m")))
+	playbookSweepEvery = must(time.ParseDuration(getenv("PLAYBOOK_SWEEP_INTERVAL", "1m")))
+	actionMaxAttempts = must(strconv.Atoi(getenv("ACTION_MAX_ATTEMPTS", "5")))
+	actionRetryBase = must(time.ParseDuration(getenv("ACTION_RETRY_BASE", "30s")))
+	actionRetryMax = must(time.ParseDuration(getenv("ACTION_RETRY_MAX", "15m")))
+	actionLease = must(time.ParseDuration(getenv("ACTION_LEASE", "5m")))
+	check(checkQueueSettings())
+	actionSweepEvery = must(time.ParseDuration(getenv("ACTION_SWEEP_INTERVAL", "1m")))
+	guardrailsCol = getenv("FIRESTORE_COLLECTION_GUARDRAILS", "guardrails")
+	notificationsCol = getenv("FIRESTORE_COLLECTION_NOTIFICATIONS", "notifications")
+	throttleCol = getenv("FIRESTORE_COLLECTION_NOTIFY_THROTTLE", "notify_throttle")
+	digestSweepEvery = must(time.ParseDuration(getenv("DIGEST_SWEEP_INTERVAL", "1m")))
+	workerID = getenv("K_REVISION", "actions-go") + "/" + uuid.New().String()[:8]
+
+	// remediation executors: dry_run everywhere unless EXECUTOR_MODE/EXECUTOR_MODES say otherwise
+	defMode := must(executor.ParseMode(getenv("EXECUTOR_MODE", string(executor.ModeDryRun))))
+	modes := must(executor.ParseModes(getenv("EXECUTOR_MODES", "")))
+	var gcp *executor.Clients
+	if defMode == executor.ModeLive || slices.Contains(slices.Collect(maps.Values(modes)), executor.ModeLive) {
+		gcp = must(executor.NewClients(ctx, executor.Endpoints{
+			IAM:     getenv("GCP_IAM_ENDPOINT", ""),
+			Storage: getenv("GCP_STORAGE_ENDPOINT", ""),
+			Compute: getenv("GCP_COMPUTE_ENDPOINT", ""),
+			NoAuth:  getenv("GCP_ENDPOINT_NOAUTH", "") == "1",
+		}))
+	}
+	executors = executor.Builtin(defMode, gcp)
+	for name, m := range modes {
+		executors.SetMode(name, m)
+	}
+
+	// approval deadlines/escalation come from the same policies api-go enforces
+	approvalPolicies = approval.DefaultConfig()
+	if path := getenv("APPROVAL_POLICIES", ""); path != "" {
+		approvalPolicies = must(approval.LoadConfig(path))
+	}
+
+	// response playbooks: built-in defaults unless PLAYBOOKS_FILE is set
+	playbooks = playbook.DefaultConfig(anomalyReviewScore)
+	if path := getenv("PLAYBOOKS_FILE", ""); path != "" {
+		playbooks = must(playbook.LoadConfig(path))
+	}
+
+	// blast-radius guardrails on automated actions: built-in defaults unless GUARDRAILS_FILE is set
+	guardrails = guardrail.DefaultConfig()
+	if path := getenv("GUARDRAILS_FILE", ""); path != "" {
+		guardrails = must(guardrail.LoadConfig(path))
+	}
+
+	// change freezes defer or hold disruptive automated actions
+	changeCalendar = calendar.DefaultConfig()
+	if path := getenv("CALENDAR_FILE", ""); path != "" {
+		changeCalendar = must(calendar.LoadConfig(path))
+	}
+
+	// notification channels and routing: Slack webhooks unless NOTIFY_FILE is set
+	notifyCfg := notify.DefaultConfig(getenv("SLACK_SECRET_ID", "SLACK_WEBHOOK"), getenv("SLACK_ESCALATION_SECRET_ID", ""))
+	if path := getenv("NOTIFY_FILE", ""); path != "" {
+		notifyCfg = must(notify.LoadConfig(path))
+	}
+	notifier = must(notify.NewRouter(notifyCfg, secretStore.Access))
+	if dir := getenv("NOTIFY_TEMPLATES", ""); dir != "" {
+		notifier.UseTemplates(must(notify.LoadTemplates(dir, notifyCfg)))
+	}
+	approvalButtons = getenv("SLACK_APPROVAL_BUTTONS", "1") == "1"
+
+	// Jira issues for alerts matching its policies
+	if path := getenv("JIRA_FILE", ""); path != "" {
+		jiraClient = jira.NewClient(must(jira.LoadConfig(path)), secretStore.Access)
+	}
+	jiraSweepEvery = must(time.ParseDuration(getenv("JIRA_SWEEP_INTERVAL", "1m")))
 
 	if projectID == "" {
 		log.Fatal("GOOGLE_CLOUD_PROJECT must be set")
@@ -93,7 +275,9 @@ func main() {
 	// clients
 	fsClient = must(firestore.NewClient(ctx, projectID))
 	pubClient = must(cloudpubsub.NewClient(ctx, projectID))
-	smClient = must(secretmanager.NewClient(ctx))
+	secretStore.Client = must(secretmanager.NewClient(ctx))
+	notifier.UseThrottle(fsClient, throttleCol)
+	notifier.UseStore(fsClient, notificationsCol, alertsCol, "actions-go")
 
 	// http server (health + future push endpoint)
 	mux := http.NewServeMux()
@@ -108,6 +292,12 @@ func main() {
 		})
 	})
 	mux.HandleFunc("/pubsub/push", handlePush)
+	mux.HandleFunc("/pubsub/actions", handleActionsPush)
+	mux.HandleFunc("/tasks/approvals", handleApprovalsTask)
+	mux.HandleFunc("/tasks/playbooks", handlePlaybooksTask)
+	mux.HandleFunc("/tasks/actions", handleActionsTask)
+	mux.HandleFunc("/tasks/digests", handleDigestsTask)
+	mux.HandleFunc("/tasks/jira", handleJiraTask)
 
 	addr := ":" + getenv("PORT", "8082")
 	go func() {
@@ -115,9 +305,25 @@ func main() {
 		check(http.ListenAndServe(addr, mux))
 	}()
 
-	// local dev: pull subscription on alerts.triaged
+	// local dev: pull subscriptions on alerts.triaged and actions.queue
 	if devPull {
 		go runPuller(ctx)
+		go runActionsPuller(ctx)
+	}
+	if approvalSweepEvery > 0 {
+		go runApprovalSweeper(ctx, approvalSweepEvery)
+	}
+	if actionSweepEvery > 0 {
+		go runActionSweeper(ctx, actionSweepEvery)
+	}
+	if playbookSweepEvery > 0 {
+		go runPlaybookSweeper(ctx, playbookSweepEvery)
+	}
+	if digestSweepEvery > 0 {
+		go runDigestSweeper(ctx, digestSweepEvery)
+	}
+	if jiraClient != nil && jiraSweepEvery > 0 {
+		go runJiraSweeper(ctx, jiraSweepEvery)
 	}
 
 	select {}
@@ -166,137 +372,43 @@ func handlePush(w http.ResponseWriter, r *http.Request) {
 
 // ----------- core -----------
 func process(ctx context.Context, env triageEnvelope) {
-	act, needsApproval := decide(env.Event, env.Triage.Severity)
-
-	if act == "" {
-		// nothing to do for low/noise; update alert status lightly
-		_, _ = fsClient.Collection(alertsCol).Doc(env.Event.ID).
-			Update(ctx, []firestore.Update{{Path: "status", Value: "reviewed"}})
-		return
-	}
-
-	now := time.Now().UTC()
-	a := actionDoc{
-		ActionID:       uuid.New().String(),
-		AlertID:        env.Event.ID,
-		ProposedAction: act,
-		Status:         "queued",
-		Simulation:     true, // ALWAYS simulated in prototype
-		Details:        map[string]string{"severity": string(env.Triage.Severity)},
-		Created:        now,
-	}
-
-	// record action
-	_, err := fsClient.Collection(actionsCol).Doc(a.ActionID).Set(ctx, a)
-	if err != nil {
-		log.Printf("firestore actions set error: %v", err)
+	alertID := env.AlertID
+	if alertID == "" {
+		alertID = env.Event.ID
 	}
-
-	// publish to actions.queue (for future workers)
-	payload, _ := json.Marshal(a)
-	_, err = pubClient.Topic(topicActions).Publish(ctx, &cloudpubsub.Message{
-		Data: payload,
-		Attributes: map[string]string{
-			"alert_id": env.Event.ID,
-			"action":   a.ProposedAction,
-		},
-	}).Get(ctx)
-	if err != nil {
-		log.Printf("pub actions.queue error: %v", err)
-	}
-
-	if needsApproval {
-		// set alert awaiting approval, ping Slack
-		_, _ = fsClient.Collection(alertsCol).Doc(env.Event.ID).
-			Update(ctx, []firestore.Update{{Path: "status", Value: "awaiting_approval"}})
-		notifySlack(ctx, fmt.Sprintf(":warning: Approval requested for *%s* on alert `%s` (severity=%s)",
-			act, env.Event.ID, env.Triage.Severity))
-		log.Printf("queued approval for %s action=%s", env.Event.ID, act)
+	// repeats of an open alert only matter when they raise its severity
+	if env.Occurrences > 1 && !env.Escalated {
+		log.Printf("alert %s repeat #%d (event %s); no new action", alertID, env.Occurrences, env.Event.ID)
 		return
 	}
 
-	// simulate immediate execution
-	res := simulate(act, env.Event)
-	a.Status = "executed"
-	a.Details["result"] = res
-	execTime := time.Now().UTC()
-	a.ExecutedAt = &execTime
-	_, _ = fsClient.Collection(actionsCol).Doc(a.ActionID).Set(ctx, a)
-	_, _ = fsClient.Collection(alertsCol).Doc(env.Event.ID).
-		Update(ctx, []firestore.Update{{Path: "status", Value: "action_executed"}})
-
-	notifySlack(ctx, fmt.Sprintf(":white_check_mark: Executed *%s* on alert `%s` (simulated) — result: %s",
-		act, env.Event.ID, res))
-	log.Printf("executed action=%s for alert=%s", act, env.Event.ID)
-}
-
-func decide(ev shared.Event, sev shared.Severity) (action string, needsApproval bool) {
-	switch ev.EventType {
-	case "iam.setIamPolicy.bindingAdd":
-		if sev == shared.SeverityHigh {
-			return "require_approval", true
-		}
-	case "iam.serviceAccountKeys.create":
-		if sev == shared.SeverityHigh {
-			return "revoke_sa_key", false
-		}
-	case "storage.setIamPolicy.public":
-		if sev == shared.SeverityHigh || sev == shared.SeverityMedium {
-			return "revert_bucket_policy", false
-		}
-	case "compute.firewall.ingress":
-		if sev == shared.SeverityHigh || sev == shared.SeverityMedium {
-			return "isolate_vm_nic", false
-		}
-	}
-	// default: nothing (let human review)
-	return "", false
-}
-
-func simulate(action string, ev shared.Event) string {
-	switch action {
-	case "revoke_sa_key":
-		return "would call iam.projects.serviceAccounts.keys.delete"
-	case "revert_bucket_policy":
-		return "would set bucket policy to private (remove allUsers/allAuthenticatedUsers)"
-	case "isolate_vm_nic":
-		return "would tag instance and apply deny-all ingress firewall"
-	default:
-		return "noop"
+	f := alertFields(env, alertID)
+	notifier.Notify(ctx, notify.ForAlert(notify.EventAlertOpened, f, fmt.Sprintf(":rotating_light: *%s* alert `%s`: %s by %s on %s%s",
+		strings.ToUpper(f["severity"]), alertID, env.Event.EventType, env.Event.Principal, env.Event.Target, escalationNote(f))))
+	// the playbook goes first; filing the issue never holds up the response
+	if pb, ok := playbooks.Select(f); ok {
+		startPlaybook(ctx, pb, alertID, f)
+	} else {
+		// nothing to do for low/noise; update alert status lightly
+		setStatus(ctx, alertID, lifecycle.StatusReviewed, "no automated action")
 	}
+	fileIssue(ctx, alertID, f)
 }
 
-// ----------- slack -----------
-func notifySlack(ctx context.Context, text string) {
-	webhook := getSlackWebhook(ctx)
-	if webhook == "" {
-		log.Printf("slack: webhook missing; message: %s", text)
-		return
-	}
-	body := map[string]any{"text": text}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("slack error: %v", err)
-		return
+// setStatus moves the alert through the lifecycle state machine, logging
+// (not failing) on disallowed transitions.
+func setStatus(ctx context.Context, alertID, to, reason string) {
+	ref := fsClient.Collection(alertsCol).Doc(alertID)
+	if _, err := lifecycle.Apply(ctx, fsClient, ref, to, "actions-go", reason); err != nil {
+		log.Printf("alert %s status -> %s: %v", alertID, to, err)
 	}
-	_ = resp.Body.Close()
 }
 
-var slackCache string
-
-func getSlackWebhook(ctx context.Context) string {
-	if slackCache != "" {
-		return slackCache
-	}
-	name := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, slackSecret)
-	resp, err := smClient.AccessSecretVersion(ctx, &smpb.AccessSecretVersionRequest{Name: name})
-	if err != nil {
-		log.Printf("secret manager access error: %v", err)
+// escalationNote annotates notifications sent because a repeat raised
+// severity; f are the alert fields a playbook run carries.
+func escalationNote(f map[string]string) string {
+	if f["escalated"] != "true" {
 		return ""
 	}
-	slackCache = string(resp.Payload.Data)
-	return slackCache
+	return fmt.Sprintf(", escalated after %s occurrences", f["occurrences"])
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// actionMessage is a notification about a.
+func actionMessage(a actionDoc, event, text string) notify.Message {
+	r := notify.ActionRecord{
+		AlertID:           a.AlertID,
+		ActionID:          a.ActionID,
+		Name:              a.ProposedAction,
+		Status:            a.Status,
+		Simulation:        a.Simulation,
+		Details:           a.Details,
+		Approvals:         a.Approvals,
+		ApprovalsRequired: a.ApprovalsRequired,
+		Deadline:          a.ApprovalDeadline,
+		Guardrail:         a.Guardrail,
+		LastError:         a.LastError,
+		RollbackOf:        a.RollbackOf,
+	}
+	if a.Result != nil {
+		r.Summary = a.Result.Summary
+	}
+	return notify.ActionMessage(r, event, text)
+}
+
+// approvalMessage is a request to approve a, with Approve and Reject
+// buttons for Slack unless SLACK_APPROVAL_BUTTONS is off.
+func approvalMessage(a actionDoc, event, text string) notify.Message {
+	m := actionMessage(a, event, text)
+	if approvalButtons {
+		m.Buttons = notify.ApprovalButtons(a.ActionID)
+	}
+	return m
+}
+
+func runDigestSweeper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := sendDigests(ctx); err != nil {
+				log.Printf("digest sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func handleDigestsTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sent, err := sendDigests(r.Context())
+	if err != nil {
+		log.Printf("digest sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"sent": sent})
+}
+
+// sendDigests sends the digests of limited channels that are due and
+// records them like any other notification.
+func sendDigests(ctx context.Context) (int, error) {
+	recs, err := notifier.FlushDigests(ctx)
+	for _, rec := range recs {
+		notifier.Store(ctx, &rec)
+	}
+	return len(recs), err
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+	"github.com/jinishshah00/sentinelflow/internal/shared/playbook"
+)
+
+// errRunBusy means another instance holds the run's lease or it has finished.
+var errRunBusy = errors.New("playbook run is leased or finished")
+
+// alertFields is what playbook conditions and step text see about an alert.
+func alertFields(env triageEnvelope, alertID string) match.Fields {
+	f := match.EventFields(env.Event)
+	f["alert_id"] = alertID
+	f["event_ts"] = env.Event.TS.Format(time.RFC3339Nano)
+	f["severity"] = string(env.Triage.Severity)
+	f["confidence"] = strconv.FormatFloat(env.Triage.Confidence, 'f', -1, 64)
+	f["reason_tokens"] = strings.Join(env.Triage.ReasonTokens, ",")
+	f["fingerprint"] = env.Fingerprint
+	f["occurrences"] = strconv.Itoa(env.Occurrences)
+	f["escalated"] = strconv.FormatBool(env.Escalated)
+	f["anomaly_score"] = "0"
+	if env.Triage.Anomaly != nil {
+		f["anomaly_score"] = strconv.FormatFloat(env.Triage.Anomaly.Score, 'f', -1, 64)
+	}
+	f["inside_change_window"] = strconv.FormatBool(env.Triage.ChangeWindow != "")
+	f["change_window"] = env.Triage.ChangeWindow
+	f["inside_change_freeze"] = strconv.FormatBool(env.Triage.ChangeFreeze != "")
+	f["change_freeze"] = env.Triage.ChangeFreeze
+	return f
+}
+
+// startPlaybook records a run of pb for the alert and drives it. The run id
+// is derived from the event, so a redelivered message finds the run already
+// there and leaves it alone.
+func startPlaybook(ctx context.Context, pb playbook.Playbook, alertID string, f match.Fields) {
+	sum := sha1.Sum([]byte(f["id"] + "|" + pb.Name))
+	id := hex.EncodeToString(sum[:])
+	ref := fsClient.Collection(runsCol).Doc(id)
+	r := playbook.NewRun(id, alertID, pb, f, time.Now().UTC())
+
+	created := false
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		created = false
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if snaps[0].Exists() {
+			return nil
+		}
+		created = true
+		return tx.Create(ref, r)
+	})
+	if err != nil {
+		log.Printf("playbook run %s create error: %v", id, err)
+		return
+	}
+	if !created {
+		log.Printf("playbook run %s for alert %s already exists; skipping", id, alertID)
+		return
+	}
+	log.Printf("started playbook %s (run %s) for alert %s", pb.Name, id, alertID)
+	driveRun(ctx, id)
+}
+
+// driveRun takes the run's lease and executes ready steps until the run
+// finishes or waits on an action, persisting it after every step. Steps
+// interrupted by a crash are retried, so step effects are at-least-once.
+func driveRun(ctx context.Context, runID string) {
+	ref := fsClient.Collection(runsCol).Doc(runID)
+	r, err := claimRun(ctx, ref)
+	if errors.Is(err, errRunBusy) {
+		return
+	}
+	if err != nil {
+		log.Printf("playbook run %s claim error: %v", runID, err)
+		return
+	}
+	r.Resume()
+
+	for {
+		refreshWaiting(ctx, &r)
+		ready := r.Plan(time.Now().UTC())
+		if len(ready) == 0 {
+			break
+		}
+		for _, s := range ready {
+			st := r.State(s.ID)
+			now := time.Now().UTC()
+			st.Status, st.Started = playbook.StepRunning, &now
+			saveRun(ctx, ref, &r, true)
+			runStep(ctx, &r, s, st)
+			saveRun(ctx, ref, &r, true)
+		}
+	}
+	saveRun(ctx, ref, &r, false)
+
+	if r.Done() {
+		noteAlert(ctx, r.AlertID, fmt.Sprintf("playbook %s %s", r.Playbook.Name, r.Status))
+		log.Printf("playbook %s (run %s) for alert %s %s", r.Playbook.Name, r.RunID, r.AlertID, r.Status)
+	}
+}
+
+// claimRun leases an unfinished run that no other instance is driving.
+func claimRun(ctx context.Context, ref *firestore.DocumentRef) (playbook.Run, error) {
+	var r playbook.Run
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return fmt.Errorf("playbook run %s not found", ref.ID)
+		}
+		r = playbook.Run{}
+		if err := snaps[0].DataTo(&r); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if r.Done() || (r.LeaseUntil != nil && now.Before(*r.LeaseUntil)) {
+			return errRunBusy
+		}
+		lease := now.Add(playbookLease)
+		r.LeaseUntil = &lease
+		return tx.Update(ref, []firestore.Update{{Path: "lease_until", Value: lease}})
+	})
+	return r, err
+}
+
+// saveRun persists the run, renewing the lease or (hold false) releasing it.
+func saveRun(ctx context.Context, ref *firestore.DocumentRef, r *playbook.Run, hold bool) {
+	r.LeaseUntil = nil
+	if hold {
+		lease := time.Now().UTC().Add(playbookLease)
+		r.LeaseUntil = &lease
+	}
+	if _, err := ref.Set(ctx, r); err != nil {
+		log.Printf("playbook run %s save error: %v", r.RunID, err)
+	}
+}
+
+// refreshWaiting settles contain and wait_for_approval steps whose action
+// has succeeded, been rejected or died.
+func refreshWaiting(ctx context.Context, r *playbook.Run) {
+	for i := range r.Steps {
+		st := &r.Steps[i]
+		if st.Status != playbook.StepWaiting || st.ActionID == "" {
+			continue
+		}
+		snap, err := fsClient.Collection(actionsCol).Doc(st.ActionID).Get(ctx)
+		if err != nil {
+			log.Printf("playbook run %s step %s: action %s: %v", r.RunID, st.ID, st.ActionID, err)
+			continue
+		}
+		var a actionDoc
+		if err := snap.DataTo(&a); err != nil {
+			continue
+		}
+		now := time.Now().UTC()
+		switch a.Status {
+		case actionSucceeded, actionRolledBack:
+			st.Status, st.Finished = playbook.StepSucceeded, &now
+			st.Output = actionOutput(a)
+		case actionDead, actionRejected, actionChangesRequested:
+			st.Status, st.Finished = playbook.StepFailed, &now
+			st.Output = actionOutput(a)
+			st.Error = "action " + a.Status
+			if reason := a.LastError + a.DecisionReason; reason != "" {
+				st.Error += ": " + reason
+			}
+		}
+	}
+}
+
+// actionOutput is what later steps can test about an action step.
+func actionOutput(a actionDoc) map[string]string {
+	out := map[string]string{"action_id": a.ActionID, "action": a.ProposedAction, "action_status": a.Status, "attempts": strconv.Itoa(a.Attempts)}
+	if a.Result != nil {
+		out["mode"], out["summary"] = string(a.Result.Mode), a.Result.Summary
+	}
+	if a.DecidedBy != "" {
+		out["decided_by"] = a.DecidedBy
+	}
+	if a.Guardrail != "" {
+		out["guardrail"] = a.Guardrail
+	}
+	return out
+}
+
+// runStep performs one step and records its outcome on st.
+func runStep(ctx context.Context, r *playbook.Run, s playbook.Step, st *playbook.StepState) {
+	var (
+		status = playbook.StepSucceeded
+		out    map[string]string
+		err    error
+	)
+	switch s.Kind {
+	case playbook.KindEnrich:
+		out, err = enrichStep(ctx, r)
+	case playbook.KindNotify:
+		event := notify.EventPlaybook
+		if s.Channel == "escalation" {
+			event = notify.EventEscalation
+		}
+		notifier.Notify(ctx, notify.ForAlert(event, r.Context, playbook.Expand(s.Text, r.Fields())))
+	case playbook.KindContain:
+		// the queue worker runs it, unless a guardrail wants a human to
+		// approve it first or a change freeze defers it; either way the
+		// step waits for the outcome
+		a := newRunAction(r, s, actionQueued)
+		if prev, ok := resumedAction(ctx, a.ActionID); ok {
+			st.ActionID, status = prev.ActionID, playbook.StepWaiting
+			out = map[string]string{"action_id": prev.ActionID, "action": prev.ProposedAction}
+			break
+		}
+		fr, until, isFrozen := frozen(a, a.Created)
+		if reason := guard(ctx, a, r.Fields()); reason != "" {
+			holdForApproval(&a, reason, a.Created)
+		} else if isFrozen {
+			gateFreeze(&a, fr, until)
+		}
+		if _, err = fsClient.Collection(actionsCol).Doc(a.ActionID).Create(ctx, a); err == nil {
+			st.ActionID, status = a.ActionID, playbook.StepWaiting
+			out = map[string]string{"action_id": a.ActionID, "action": a.ProposedAction}
+			switch {
+			case a.Guardrail != "":
+				out["guardrail"] = a.Guardrail
+				requestHeldApproval(ctx, a)
+			case a.DeferredUntil != nil:
+				out["deferred_until"] = a.DeferredUntil.Format(time.RFC3339)
+				announceDeferred(ctx, a, fr.Name)
+			default:
+				if perr := enqueueAction(ctx, a); perr != nil {
+					log.Printf("enqueue action %s error: %v (the sweeper will retry)", a.ActionID, perr)
+				}
+			}
+		}
+	case playbook.KindWaitForApproval:
+		a := newRunAction(r, s, actionAwaitingApproval)
+		if prev, ok := resumedAction(ctx, a.ActionID); ok {
+			st.ActionID, status = prev.ActionID, playbook.StepWaiting
+			out = map[string]string{"action_id": prev.ActionID, "action": prev.ProposedAction}
+			if prev.Status == actionAwaitingApproval {
+				setStatus(ctx, r.AlertID, lifecycle.StatusAwaitingApproval, "approval requested for "+prev.ProposedAction)
+			}
+			break
+		}
+		if _, err = fsClient.Collection(actionsCol).Doc(a.ActionID).Create(ctx, a); err == nil {
+			st.ActionID, status = a.ActionID, playbook.StepWaiting
+			out = map[string]string{"action_id": a.ActionID, "action": a.ProposedAction}
+			setStatus(ctx, r.AlertID, lifecycle.StatusAwaitingApproval, "approval requested for "+a.ProposedAction)
+			notifier.Notify(ctx, approvalMessage(a, notify.EventApprovalRequested, fmt.Sprintf(":warning: Approval requested for *%s* on alert `%s` (severity=%s%s%s)",
+				a.ProposedAction, r.AlertID, r.Context["severity"], escalationNote(r.Context), deadlineNote(a))))
+		}
+	case playbook.KindVerify:
+		var res executor.Result
+		res, err = executors.Verify(ctx, executor.Request{AlertID: r.AlertID, Action: s.Action, Details: runDetails(r)})
+		out = map[string]string{"mode": string(res.Mode), "summary": res.Summary}
+	case playbook.KindTicket:
+		out, err = ticketStep(ctx, r, s)
+		if err == nil && out == nil {
+			status, st.Reason = playbook.StepSkipped, "TICKET_WEBHOOK_URL not set"
+		}
+	default:
+		err = fmt.Errorf("unknown step kind %q", s.Kind)
+	}
+
+	now := time.Now().UTC()
+	st.Output = out
+	if err != nil {
+		st.Status, st.Error, st.Finished = playbook.StepFailed, err.Error(), &now
+		log.Printf("playbook run %s step %s (%s) failed: %v", r.RunID, s.ID, s.Kind, err)
+		return
+	}
+	st.Status = status
+	if status != playbook.StepWaiting {
+		st.Finished = &now
+	}
+}
+
+// runDetails are the event attributes copied onto actions and executor
+// requests.
+func runDetails(r *playbook.Run) map[string]string {
+	f := r.Context
+	return map[string]string{
+		"severity":   f["severity"],
+		"event_id":   f["id"],
+		"event_type": f["event_type"],
+		"principal":  f["principal"],
+		"target":     f["target"],
+		"event_ts":   f["event_ts"],
+	}
+}
+
+// newRunAction builds the action document for a contain or
+// wait_for_approval step. Its ID is derived from the run and the step, so a
+// step retried after a crash finds the action it already created.
+func newRunAction(r *playbook.Run, s playbook.Step, status string) actionDoc {
+	act := s.Action
+	if act == "" {
+		act = "require_approval"
+	}
+	now := time.Now().UTC()
+	sum := sha1.Sum([]byte(r.RunID + "|" + s.ID))
+	a := actionDoc{
+		ActionID:       hex.EncodeToString(sum[:]),
+		AlertID:        r.AlertID,
+		ProposedAction: act,
+		Status:         status,
+		Simulation:     executors.Mode(act) != executor.ModeLive,
+		Details:        runDetails(r),
+		Created:        now,
+		RequestedBy:    "actions-go",
+		PlaybookRunID:  r.RunID,
+		StepID:         s.ID,
+	}
+	if status == actionAwaitingApproval {
+		awaitApproval(&a, now)
+	}
+	return a
+}
+
+// resumedAction returns the action with id if a step created it before its
+// run was interrupted. The step then waits on it as it is: it is already
+// queued, held or awaiting approval, and the sweepers re-send any message
+// lost in the crash.
+func resumedAction(ctx context.Context, id string) (actionDoc, bool) {
+	snap, err := fsClient.Collection(actionsCol).Doc(id).Get(ctx)
+	if err != nil {
+		return actionDoc{}, false
+	}
+	var a actionDoc
+	if err := snap.DataTo(&a); err != nil {
+		return actionDoc{}, false
+	}
+	return a, true
+}
+
+// awaitApproval puts the action up for approval under its policy, with
+// deadlines measured from now.
+func awaitApproval(a *actionDoc, now time.Time) {
+	p := approvalPolicies.For(a.ProposedAction)
+	a.Status = actionAwaitingApproval
+	a.ApprovalsRequired = p.Required
+	a.ApprovalDeadline = p.DeadlineFrom(now)
+	a.NextEscalation = p.NextEscalation(now, a.ApprovalDeadline)
+	a.OnExpiry = p.Expiry()
+}
+
+// enrichStep gathers context triage stored with the alert and its incident.
+func enrichStep(ctx context.Context, r *playbook.Run) (map[string]string, error) {
+	snap, err := fsClient.Collection(alertsCol).Doc(r.AlertID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load alert: %w", err)
+	}
+	var al struct {
+		IncidentID  string `firestore:"incident_id"`
+		Occurrences int    `firestore:"occurrences"`
+		Status      string `firestore:"status"`
+		Triage      struct {
+			IntelMatches []map[string]any `firestore:"intel_matches"`
+		} `firestore:"triage"`
+		Detection *struct {
+			Rule string `firestore:"rule"`
+		} `firestore:"detection"`
+	}
+	if err := snap.DataTo(&al); err != nil {
+		return nil, fmt.Errorf("decode alert: %w", err)
+	}
+	out := map[string]string{
+		"status":        lifecycle.Normalize(al.Status),
+		"occurrences":   strconv.Itoa(al.Occurrences),
+		"intel_matches": strconv.Itoa(len(al.Triage.IntelMatches)),
+		"incident_id":   al.IncidentID,
+	}
+	if al.Detection != nil {
+		out["detection"] = al.Detection.Rule
+	}
+	if al.IncidentID != "" {
+		inc, err := fsClient.Collection(incidentsCol).Doc(al.IncidentID).Get(ctx)
+		if err == nil {
+			var in struct {
+				AlertIDs []string `firestore:"alert_ids"`
+				Severity string   `firestore:"severity"`
+			}
+			if inc.DataTo(&in) == nil {
+				out["incident_alerts"] = strconv.Itoa(len(in.AlertIDs))
+				out["incident_severity"] = in.Severity
+			}
+		}
+	}
+	return out, nil
+}
+
+// ticketStep posts the alert to TICKET_WEBHOOK_URL. It returns nil output
+// when no webhook is configured.
+func ticketStep(ctx context.Context, r *playbook.Run, s playbook.Step) (map[string]string, error) {
+	if ticketWebhook == "" {
+		return nil, nil
+	}
+	summary := playbook.Expand(s.Text, r.Fields())
+	if summary == "" {
+		summary = fmt.Sprintf("[%s] %s on %s", r.Context["severity"], r.Context["event_type"], r.Context["target"])
+	}
+	b, _ := json.Marshal(map[string]any{
+		"alert_id": r.AlertID,
+		"playbook": r.Playbook.Name,
+		"summary":  summary,
+		"details":  runDetails(r),
+	})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, ticketWebhook, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ticket webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("ticket webhook: %s", resp.Status)
+	}
+	var t struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&t)
+	id := t.Key
+	if id == "" {
+		id = t.ID
+	}
+	return map[string]string{"ticket_id": id}, nil
+}
+
+// runPlaybookSweeper resumes unfinished runs at startup and then every
+// interval: runs whose instance died, and runs waiting on approvals that were
+// rejected (api-go does not call back).
+func runPlaybookSweeper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := sweepPlaybooks(ctx); err != nil {
+			log.Printf("playbook sweep error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func handlePlaybooksTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resumed, err := sweepPlaybooks(r.Context())
+	if err != nil {
+		log.Printf("playbook sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"resumed": resumed})
+}
+
+// sweepPlaybooks drives every unfinished run that is not leased.
+func sweepPlaybooks(ctx context.Context) (resumed int, err error) {
+	docs, err := fsClient.Collection(runsCol).
+		Where("status", "in", []string{playbook.RunRunning, playbook.RunWaiting}).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	for _, snap := range docs {
+		var r playbook.Run
+		if err := snap.DataTo(&r); err != nil || (r.LeaseUntil != nil && now.Before(*r.LeaseUntil)) {
+			continue
+		}
+		driveRun(ctx, r.RunID)
+		resumed++
+	}
+	return resumed, nil
+}
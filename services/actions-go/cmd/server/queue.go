@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	cloudpubsub "cloud.google.com/go/pubsub"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/calendar"
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// queueMessage is what goes on actions.queue: a pointer to an action that is
+// ready to run. The action document stays the source of truth, so duplicate
+// or stale messages are harmless.
+type queueMessage struct {
+	ActionID string `json:"action_id"`
+	AlertID  string `json:"alert_id"`
+}
+
+var (
+	errNotClaimable = errors.New("action not ready to run")
+	errLeaseLost    = errors.New("action lease lost to another worker")
+	// a lapsed lease on an action with no attempts left; claimAction has
+	// marked it dead
+	errAttemptsExhausted = errors.New("lease lapsed with no attempts left")
+)
+
+// enqueueAction publishes the action to actions.queue and stamps enqueued_at
+// so the sweeper can tell a lost message from a fresh one.
+func enqueueAction(ctx context.Context, a actionDoc) error {
+	b, _ := json.Marshal(queueMessage{ActionID: a.ActionID, AlertID: a.AlertID})
+	_, err := pubClient.Topic(topicActions).Publish(ctx, &cloudpubsub.Message{
+		Data: b,
+		Attributes: map[string]string{
+			"alert_id":  a.AlertID,
+			"action_id": a.ActionID,
+			"action":    a.ProposedAction,
+		},
+	}).Get(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = fsClient.Collection(actionsCol).Doc(a.ActionID).Update(ctx, []firestore.Update{
+		{Path: "enqueued_at", Value: time.Now().UTC()},
+	})
+	return err
+}
+
+func runActionsPuller(ctx context.Context) {
+	sub := pubClient.Subscription(subActions)
+	sub.ReceiveSettings.Synchronous = true
+	sub.ReceiveSettings.MaxOutstandingMessages = 10
+
+	log.Printf("actions-go: starting pull on subscription %q", subActions)
+	err := sub.Receive(ctx, func(ctx context.Context, msg *cloudpubsub.Message) {
+		defer msg.Ack()
+		var m queueMessage
+		if err := json.Unmarshal(msg.Data, &m); err != nil || m.ActionID == "" {
+			log.Printf("bad actions.queue message: %v", err)
+			return
+		}
+		workAction(ctx, m.ActionID)
+	})
+	if err != nil {
+		log.Fatalf("actions-go actions pull error: %v", err)
+	}
+}
+
+func handleActionsPush(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var envelope struct {
+		Message struct {
+			Data []byte `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var m queueMessage
+	if err := json.Unmarshal(envelope.Message.Data, &m); err != nil || m.ActionID == "" {
+		http.Error(w, "bad data", http.StatusBadRequest)
+		return
+	}
+	// retries are scheduled on the action itself, so always ack
+	workAction(ctx, m.ActionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimable reports whether a worker may take the action now: it is queued
+// or approved, its retry is due, or the worker running it let the lease lapse.
+func claimable(a actionDoc, now time.Time) bool {
+	switch a.Status {
+	case actionQueued, actionApproved, actionFailed:
+		return a.NextAttemptAt == nil || !now.Before(*a.NextAttemptAt)
+	case actionRunning:
+		return a.LeaseUntil == nil || !now.Before(*a.LeaseUntil)
+	}
+	return false
+}
+
+// workAction claims the action, runs one attempt and settles the outcome.
+func workAction(ctx context.Context, actionID string) {
+	a, err := claimAction(ctx, fsClient.Collection(actionsCol).Doc(actionID))
+	if errors.Is(err, errNotClaimable) {
+		log.Printf("action %s is %s; skipping", actionID, a.Status)
+		return
+	}
+	if errors.Is(err, errAttemptsExhausted) {
+		died(ctx, a, err)
+		return
+	}
+	if err != nil {
+		log.Printf("claim action %s error: %v", actionID, err)
+		return
+	}
+
+	if automated(a) {
+		if reason := heldReason(ctx, a); reason != "" {
+			holdAction(ctx, a, reason)
+			return
+		}
+		// a freeze may have begun since the action was queued
+		if fr, until, ok := frozen(a, time.Now()); ok {
+			if changeCalendar.FreezePolicy(fr) == calendar.OnFreezeRequireApproval {
+				holdAction(ctx, a, "change freeze "+fr.Name)
+			} else {
+				deferAction(ctx, a, fr.Name, until)
+			}
+			return
+		}
+	}
+
+	stop := keepLease(ctx, a)
+	var res executor.Result
+	if a.RollbackOf != "" {
+		res, err = performRollback(ctx, a)
+	} else {
+		res, err = executors.Run(ctx, executor.Request{
+			ActionID: a.ActionID,
+			AlertID:  a.AlertID,
+			Action:   a.ProposedAction,
+			Details:  a.Details,
+		})
+	}
+	stop()
+	settleAction(ctx, a, res, err)
+}
+
+// claimAction leases the action to this worker and counts the attempt.
+func claimAction(ctx context.Context, ref *firestore.DocumentRef) (actionDoc, error) {
+	var a actionDoc
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return fmt.Errorf("action %s not found", ref.ID)
+		}
+		a = actionDoc{}
+		if err := snaps[0].DataTo(&a); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if !claimable(a, now) {
+			return errNotClaimable
+		}
+		if a.Status == actionRunning && a.Attempts >= actionMaxAttempts {
+			// its last worker died mid-run; do not start another attempt
+			a.Status = actionDead
+			return tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: actionDead},
+				{Path: "last_error", Value: errAttemptsExhausted.Error()},
+				{Path: "executed_at", Value: now},
+				{Path: "lease_until", Value: nil},
+			})
+		}
+		lease := now.Add(actionLease)
+		a.Status, a.Attempts, a.LeaseUntil, a.Worker = actionRunning, a.Attempts+1, &lease, workerID
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: actionRunning},
+			{Path: "attempts", Value: a.Attempts},
+			{Path: "lease_until", Value: lease},
+			{Path: "worker", Value: workerID},
+			{Path: "next_attempt_at", Value: nil},
+		})
+	})
+	if err == nil && a.Status == actionDead {
+		err = errAttemptsExhausted
+	}
+	return a, err
+}
+
+// keepLease extends the action's lease while its executor runs, so a slow
+// attempt is not reclaimed by another worker. The returned func stops it.
+func keepLease(ctx context.Context, a actionDoc) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(actionLease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				lease := time.Now().UTC().Add(actionLease)
+				err := updateLeased(ctx, a, []firestore.Update{{Path: "lease_until", Value: lease}})
+				if errors.Is(err, errLeaseLost) {
+					log.Printf("action %s: %v; stopping renewal", a.ActionID, err)
+					return
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Printf("action %s lease renewal error: %v", a.ActionID, err)
+				}
+			}
+		}
+	}()
+	return func() { cancel(); <-done }
+}
+
+// updateLeased applies updates to the action only while this worker still
+// holds the attempt it claimed; otherwise it returns errLeaseLost.
+func updateLeased(ctx context.Context, a actionDoc, updates []firestore.Update) error {
+	ref := fsClient.Collection(actionsCol).Doc(a.ActionID)
+	return fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		var cur actionDoc
+		if !snaps[0].Exists() {
+			return errLeaseLost
+		}
+		if err := snaps[0].DataTo(&cur); err != nil {
+			return err
+		}
+		if cur.Status != actionRunning || cur.Worker != workerID || cur.Attempts != a.Attempts {
+			return errLeaseLost
+		}
+		return tx.Update(ref, updates)
+	})
+}
+
+// permanent errors are not worth retrying.
+func permanent(err error) bool {
+	return errors.Is(err, executor.ErrInvalid) ||
+		errors.Is(err, executor.ErrUnknownAction) ||
+		errors.Is(err, executor.ErrLiveUnsupported) ||
+		errors.Is(err, executor.ErrRollbackUnsupported)
+}
+
+// backoff is the delay before retry number attempt (1-based): exponential
+// from ACTION_RETRY_BASE, capped at ACTION_RETRY_MAX, with full jitter over
+// its upper half. The cap is checked before shifting, so the delay never
+// overflows.
+func backoff(attempt int) time.Duration {
+	d := actionRetryMax
+	if n := max(attempt-1, 0); n < 63 && actionRetryBase <= actionRetryMax>>n {
+		d = actionRetryBase << n
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// checkQueueSettings rejects ACTION_* settings the worker cannot run with.
+func checkQueueSettings() error {
+	switch {
+	case actionMaxAttempts < 1:
+		return fmt.Errorf("ACTION_MAX_ATTEMPTS must be at least 1, got %d", actionMaxAttempts)
+	case actionRetryBase <= 0:
+		return fmt.Errorf("ACTION_RETRY_BASE must be positive, got %s", actionRetryBase)
+	case actionRetryMax < actionRetryBase:
+		return fmt.Errorf("ACTION_RETRY_MAX (%s) must be at least ACTION_RETRY_BASE (%s)", actionRetryMax, actionRetryBase)
+	case actionLease < time.Second:
+		return fmt.Errorf("ACTION_LEASE must be at least 1s, got %s", actionLease)
+	}
+	return nil
+}
+
+// settleAction records the attempt's outcome: succeeded, failed with a
+// retry scheduled, or dead once retries are exhausted or the error is
+// permanent. Final outcomes move the alert on, post to Slack and resume the
+// action's playbook run. If another worker has since reclaimed the action
+// the outcome is dropped; that worker settles it.
+func settleAction(ctx context.Context, a actionDoc, res executor.Result, err error) {
+	now := time.Now().UTC()
+	settle := func(updates []firestore.Update) bool {
+		uerr := updateLeased(ctx, a, updates)
+		if errors.Is(uerr, errLeaseLost) {
+			log.Printf("action=%s (%s) attempt %d outcome dropped: %v", a.ProposedAction, a.ActionID, a.Attempts, uerr)
+			return false
+		}
+		if uerr != nil {
+			log.Printf("firestore action %s update error: %v", a.ActionID, uerr)
+		}
+		return true
+	}
+
+	if err == nil {
+		if !settle([]firestore.Update{
+			{Path: "status", Value: actionSucceeded},
+			{Path: "simulation", Value: res.Mode != executor.ModeLive},
+			{Path: "result", Value: res},
+			{Path: "details.result", Value: res.Summary},
+			{Path: "executed_at", Value: now},
+			{Path: "lease_until", Value: nil},
+		}) {
+			return
+		}
+		if a.RollbackOf != "" {
+			rolledBack(ctx, a, res)
+		} else {
+			executed(ctx, a, res)
+		}
+		resumePlaybook(ctx, a)
+		return
+	}
+
+	if !permanent(err) && a.Attempts < actionMaxAttempts {
+		delay := backoff(a.Attempts)
+		next := now.Add(delay)
+		if !settle([]firestore.Update{
+			{Path: "status", Value: actionFailed},
+			{Path: "last_error", Value: err.Error()},
+			{Path: "next_attempt_at", Value: next},
+			{Path: "lease_until", Value: nil},
+		}) {
+			return
+		}
+		log.Printf("action=%s (%s) attempt %d/%d failed, retrying in %s: %v",
+			a.ProposedAction, a.ActionID, a.Attempts, actionMaxAttempts, delay.Round(time.Second), err)
+		// the sweeper re-enqueues it too, should this instance go away
+		time.AfterFunc(delay, func() {
+			if err := enqueueAction(context.Background(), a); err != nil {
+				log.Printf("re-enqueue action %s error: %v", a.ActionID, err)
+			}
+		})
+		return
+	}
+
+	if !settle([]firestore.Update{
+		{Path: "status", Value: actionDead},
+		{Path: "last_error", Value: err.Error()},
+		{Path: "executed_at", Value: now},
+		{Path: "lease_until", Value: nil},
+	}) {
+		return
+	}
+	died(ctx, a, err)
+}
+
+// died records the failure of an action that is now dead, notes it on the
+// alert, announces it and resumes its playbook run.
+func died(ctx context.Context, a actionDoc, err error) {
+	if automated(a) {
+		recordFailure(ctx, a)
+	}
+	what := a.ProposedAction
+	if a.RollbackOf != "" {
+		what = "rollback of " + a.Details["action"]
+	}
+	noteAlert(ctx, a.AlertID, fmt.Sprintf("%s failed after %d attempt(s): %v", what, a.Attempts, err))
+	notifier.Notify(ctx, actionMessage(a, notify.EventActionFailed, fmt.Sprintf(":x: *%s* failed on alert `%s` (%s, %d attempt(s)): %v",
+		what, a.AlertID, executors.Mode(a.ProposedAction), a.Attempts, err)))
+	log.Printf("action=%s (%s) for alert=%s dead after %d attempt(s): %v", a.ProposedAction, a.ActionID, a.AlertID, a.Attempts, err)
+	resumePlaybook(ctx, a)
+}
+
+// executed moves the alert on and announces a successful remediation.
+func executed(ctx context.Context, a actionDoc, res executor.Result) {
+	note := ""
+	if a.DecidedBy != "" {
+		note = ", approved"
+	}
+	setStatus(ctx, a.AlertID, lifecycle.StatusActionExecuted, "executed "+a.ProposedAction)
+	notifier.Notify(ctx, actionMessage(a, notify.EventActionExecuted, fmt.Sprintf(":white_check_mark: Executed *%s* on alert `%s` (%s%s) — result: %s",
+		a.ProposedAction, a.AlertID, res.Mode, note, res.Summary)))
+	log.Printf("executed action=%s (%s, %s, attempt %d) for alert=%s", a.ProposedAction, a.ActionID, res.Mode, a.Attempts, a.AlertID)
+}
+
+// resumePlaybook lets the run that created a finished action move on.
+func resumePlaybook(ctx context.Context, a actionDoc) {
+	if a.PlaybookRunID != "" {
+		driveRun(ctx, a.PlaybookRunID)
+	}
+}
+
+// runActionSweeper re-enqueues actions whose retry is due, whose worker let
+// the lease lapse, or whose queue message was lost. Cloud Scheduler can
+// drive /tasks/actions instead.
+func runActionSweeper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := sweepActions(ctx); err != nil {
+				log.Printf("action sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func handleActionsTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	requeued, err := sweepActions(r.Context())
+	if err != nil {
+		log.Printf("action sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"requeued": requeued})
+}
+
+func sweepActions(ctx context.Context) (requeued int, err error) {
+	docs, err := fsClient.Collection(actionsCol).
+		Where("status", "in", []string{actionQueued, actionApproved, actionFailed, actionRunning}).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	for _, snap := range docs {
+		var a actionDoc
+		if err := snap.DataTo(&a); err != nil || !claimable(a, now) {
+			continue
+		}
+		// a queued action only counts as stuck once its message has had a
+		// lease's worth of time to arrive
+		if a.Status == actionQueued || a.Status == actionApproved {
+			since := a.Created
+			if a.DecidedAt != nil {
+				since = *a.DecidedAt
+			}
+			if a.EnqueuedAt != nil {
+				since = *a.EnqueuedAt
+			}
+			if now.Sub(since) < actionLease {
+				continue
+			}
+		}
+		if err := enqueueAction(ctx, a); err != nil {
+			log.Printf("re-enqueue action %s error: %v", a.ActionID, err)
+			continue
+		}
+		requeued++
+	}
+	return requeued, nil
+}
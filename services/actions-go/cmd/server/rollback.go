@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// performRollback undoes the action rb.RollbackOf from the snapshot its
+// executor captured, in the mode it ran in.
+func performRollback(ctx context.Context, rb actionDoc) (executor.Result, error) {
+	snap, err := fsClient.Collection(actionsCol).Doc(rb.RollbackOf).Get(ctx)
+	if err != nil {
+		return executor.Result{}, fmt.Errorf("load action %s: %w", rb.RollbackOf, err)
+	}
+	var orig actionDoc
+	if err := snap.DataTo(&orig); err != nil {
+		return executor.Result{}, fmt.Errorf("%w: decode action %s: %v", executor.ErrInvalid, rb.RollbackOf, err)
+	}
+	if orig.Result == nil {
+		return executor.Result{}, fmt.Errorf("%w: action %s has no result to undo", executor.ErrInvalid, rb.RollbackOf)
+	}
+	return executors.Rollback(ctx, executor.Request{
+		ActionID: orig.ActionID,
+		AlertID:  orig.AlertID,
+		Action:   orig.ProposedAction,
+		Details:  orig.Details,
+	}, orig.Result.Mode, orig.Result.Snapshot)
+}
+
+// rolledBack marks the original action rolled_back once its rollback has
+// succeeded. The alert's status is left alone; the undo is noted in its
+// history.
+func rolledBack(ctx context.Context, rb actionDoc, res executor.Result) {
+	now := time.Now().UTC()
+	if _, err := fsClient.Collection(actionsCol).Doc(rb.RollbackOf).Update(ctx, []firestore.Update{
+		{Path: "status", Value: actionRolledBack},
+		{Path: "rolled_back_at", Value: now},
+	}); err != nil {
+		log.Printf("firestore action %s update error: %v", rb.RollbackOf, err)
+	}
+	orig := rb.Details["action"]
+	noteAlert(ctx, rb.AlertID, fmt.Sprintf("rolled back %s: %s", orig, res.Summary))
+	notifier.Notify(ctx, actionMessage(rb, notify.EventRolledBack, fmt.Sprintf(":rewind: Rolled back *%s* on alert `%s` (%s) — result: %s",
+		orig, rb.AlertID, res.Mode, res.Summary)))
+	log.Printf("rolled back action=%s (%s, %s) for alert=%s", orig, rb.RollbackOf, res.Mode, rb.AlertID)
+}
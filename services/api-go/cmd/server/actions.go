@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// more action statuses (see actions-go)
+const (
+	actionSucceeded  = "succeeded"
+	actionDead       = "dead"
+	actionRolledBack = "rolled_back"
+)
+
+// actionRollback is the proposed_action of a rollback; its rollback_of names
+// the executed action it undoes.
+const actionRollback = "rollback"
+
+// errNotRollbackable is returned when an action cannot be rolled back.
+var errNotRollbackable = errors.New("action cannot be rolled back")
+
+// errActionNotPending is returned when an action has no approval pending.
+var errActionNotPending = errors.New("action not awaiting approval")
+
+func handleActionByID(w http.ResponseWriter, r *http.Request) {
+	// paths: /actions/{id} [GET], /actions/{id}/approve [POST], /actions/{id}/reject [POST],
+	// /actions/{id}/rollback [POST]
+	path := strings.TrimPrefix(r.URL.Path, "/actions/")
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	id := parts[0]
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		doc, err := fsClient.Collection(actionsCol).Doc(id).Get(r.Context())
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var ad actionDoc
+		if err := doc.DataTo(&ad); err != nil {
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, ad)
+	case len(parts) == 2 && parts[1] == "approve" && r.Method == http.MethodPost:
+		handleApproveAction(w, r, id)
+	case len(parts) == 2 && parts[1] == "reject" && r.Method == http.MethodPost:
+		handleRejectAction(w, r, id)
+	case len(parts) == 2 && parts[1] == "rollback" && r.Method == http.MethodPost:
+		handleRollback(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleApproveAction serves /actions/{id}/approve: the same policy-checked
+// approval as /alerts/{id}/approve, for a single action. It is how rollback
+// actions, which do not hold the alert in awaiting_approval, get approved.
+func handleApproveAction(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body) // body is optional
+	by, ok := approver(w, r)
+	if !ok {
+		return
+	}
+
+	ref := fsClient.Collection(actionsCol).Doc(id)
+	if _, err := ref.Get(ctx); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	ad, changed, err := approveAction(ctx, ref, by, body.Comment)
+	if code, ok := approvalError(err); ok {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err != nil {
+		log.Printf("approve action %s error: %v", id, err)
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	if !changed {
+		http.Error(w, "action not awaiting approval", http.StatusConflict)
+		return
+	}
+
+	if err := releaseApproval(ctx, ad, by); err != nil {
+		log.Printf("publish action %s error: %v", ad.ActionID, err)
+		http.Error(w, "publish error", http.StatusBadGateway)
+		return
+	}
+	status := http.StatusOK
+	if ad.Status == actionApproved {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, map[string]any{
+		"ok":        true,
+		"action_id": ad.ActionID,
+		"action":    ad.ProposedAction,
+		"status":    ad.Status,
+		"approvals": len(ad.Approvals),
+		"required":  ad.ApprovalsRequired,
+	})
+}
+
+// releaseApproval hands ad to actions-go once by's approval has met its
+// quorum, and announces the approval either way.
+func releaseApproval(ctx context.Context, ad actionDoc, by string) error {
+	if ad.Status != actionApproved {
+		notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalRecorded, fmt.Sprintf(":ballot_box_with_check: %s approved *%s* on alert `%s` (%d/%d approvals).",
+			by, ad.ProposedAction, ad.AlertID, len(ad.Approvals), ad.ApprovalsRequired)))
+		return nil
+	}
+	if err := publishApproved(ctx, ad); err != nil {
+		return err
+	}
+	notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalGranted, fmt.Sprintf(":white_check_mark: Approval granted for *%s* on alert `%s` by %s; executing.",
+		ad.ProposedAction, ad.AlertID, by)))
+	return nil
+}
+
+// handleRejectAction serves /actions/{id}/reject: it rejects one action
+// awaiting approval, with a reason. A rejected rollback leaves the alert as
+// it is; for any other action the alert is rejected once none of its actions
+// is awaiting approval any more.
+func handleRejectAction(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "bad request: reason is required", http.StatusBadRequest)
+		return
+	}
+	by, ok := approver(w, r)
+	if !ok {
+		return
+	}
+
+	ref := fsClient.Collection(actionsCol).Doc(id)
+	if _, err := ref.Get(ctx); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	ad, alertRejected, err := rejectAction(ctx, ref, by, body.Reason)
+	switch {
+	case errors.Is(err, errActionNotPending), errors.Is(err, lifecycle.ErrNotAllowed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":             true,
+		"action_id":      ad.ActionID,
+		"action":         ad.ProposedAction,
+		"status":         ad.Status,
+		"alert_rejected": alertRejected,
+	})
+}
+
+// rejectAction rejects the action at ref if it is awaiting approval. Unless
+// it is a rollback, the alert moves to rejected in the same transaction when
+// it was awaiting approval and no other action of it still is. It then
+// announces the rejection and reports whether the alert was rejected.
+func rejectAction(ctx context.Context, ref *firestore.DocumentRef, by, reason string) (actionDoc, bool, error) {
+	var ad actionDoc
+	snap, err := ref.Get(ctx)
+	if err != nil {
+		return ad, false, err
+	}
+	if err := snap.DataTo(&ad); err != nil {
+		return ad, false, err
+	}
+	alertRef := fsClient.Collection(alertsCol).Doc(ad.AlertID)
+	siblings, err := fsClient.Collection(actionsCol).Where("alert_id", "==", ad.AlertID).Documents(ctx).GetAll()
+	if err != nil {
+		return ad, false, err
+	}
+	refs := []*firestore.DocumentRef{ref, alertRef}
+	for _, s := range siblings {
+		if s.Ref.ID != ref.ID {
+			refs = append(refs, s.Ref)
+		}
+	}
+
+	alertRejected := false
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		alertRejected = false
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		ad = actionDoc{}
+		if err := snaps[0].DataTo(&ad); err != nil {
+			return err
+		}
+		if ad.Status != actionAwaitingApproval {
+			return errActionNotPending
+		}
+		now := time.Now().UTC()
+		ad.Status, ad.DecidedBy, ad.DecisionReason, ad.DecidedAt = actionRejected, by, reason, &now
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: actionRejected},
+			{Path: "decided_by", Value: by},
+			{Path: "decision_reason", Value: reason},
+			{Path: "decided_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		// a rollback does not hold the alert in awaiting_approval
+		if ad.RollbackOf != "" || !snaps[1].Exists() {
+			return nil
+		}
+		var a alertDoc
+		if err := snaps[1].DataTo(&a); err != nil {
+			return err
+		}
+		if lifecycle.Normalize(a.Status) != lifecycle.StatusAwaitingApproval {
+			return nil
+		}
+		for _, s := range snaps[2:] {
+			if st, _ := s.Data()["status"].(string); s.Exists() && st == actionAwaitingApproval {
+				return nil
+			}
+		}
+		updates, err := lifecycle.Updates(a.Status, lifecycle.StatusRejected, by, reason)
+		if err != nil {
+			return err
+		}
+		alertRejected = true
+		return tx.Update(alertRef, updates)
+	})
+	if err != nil {
+		if !errors.Is(err, errActionNotPending) {
+			log.Printf("reject action %s error: %v", ref.ID, err)
+		}
+		return ad, false, err
+	}
+
+	what := ad.ProposedAction
+	if ad.RollbackOf != "" {
+		what = "rollback of " + ad.Details["action"]
+	}
+	notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalRejected, fmt.Sprintf(":no_entry: *%s* on alert `%s` rejected by %s: %s", what, ad.AlertID, by, reason)))
+	log.Printf("action %s (%s) rejected by %s", ad.ActionID, ad.ProposedAction, by)
+	if alertRejected {
+		notifyTransition(ctx, ad.AlertID, lifecycle.StatusRejected, by, reason)
+		syncIssue(ctx, ad.AlertID, lifecycle.StatusRejected, by, reason)
+	} else if err := lifecycle.Note(ctx, fsClient, alertRef, by, what+" rejected: "+reason); err != nil {
+		log.Printf("alert %s note: %v", ad.AlertID, err)
+	}
+	return ad, alertRejected, nil
+}
+
+// handleRollback serves /actions/{id}/rollback. It proposes a rollback
+// action linked to the executed action; once approved under the "rollback"
+// approval policy, actions-go restores the snapshot the executor captured.
+func handleRollback(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "bad request: reason is required", http.StatusBadRequest)
+		return
+	}
+	by, ok := approver(w, r)
+	if !ok {
+		return
+	}
+
+	ref := fsClient.Collection(actionsCol).Doc(id)
+	if _, err := ref.Get(ctx); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	rb, err := proposeRollback(ctx, ref, by, body.Reason)
+	if errors.Is(err, errNotRollbackable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("rollback of action %s error: %v", id, err)
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+
+	alertRef := fsClient.Collection(alertsCol).Doc(rb.AlertID)
+	note := fmt.Sprintf("rollback of %s requested: %s", rb.Details["action"], body.Reason)
+	if err := lifecycle.Note(ctx, fsClient, alertRef, by, note); err != nil {
+		log.Printf("alert %s note: %v", rb.AlertID, err)
+	}
+	notifier.Notify(ctx, actionMessage(rb, notify.EventRollbackRequested, fmt.Sprintf(":rewind: %s requested rollback of *%s* on alert `%s`: %s (needs %d approval(s)).",
+		by, rb.Details["action"], rb.AlertID, body.Reason, rb.ApprovalsRequired)))
+	writeJSON(w, http.StatusCreated, rb)
+}
+
+// proposeRollback creates the rollback action for the executed action at ref
+// and links the two, in one transaction so that an action has at most one
+// rollback in flight. A linked rollback that was rejected, sent back or died
+// is replaced.
+func proposeRollback(ctx context.Context, ref *firestore.DocumentRef, by, reason string) (actionDoc, error) {
+	var rb actionDoc
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		var orig actionDoc
+		if err := snaps[0].DataTo(&orig); err != nil {
+			return err
+		}
+		switch {
+		case orig.ProposedAction == actionRollback:
+			return fmt.Errorf("%w: it is itself a rollback", errNotRollbackable)
+		case orig.Status != actionSucceeded:
+			return fmt.Errorf("%w: status is %s", errNotRollbackable, orig.Status)
+		case orig.Result != nil && orig.Result.Mode == executor.ModeLive && orig.Result.Snapshot == "":
+			return fmt.Errorf("%w: no snapshot was captured", errNotRollbackable)
+		}
+		if orig.RollbackActionID != "" {
+			prev, err := tx.GetAll([]*firestore.DocumentRef{fsClient.Collection(actionsCol).Doc(orig.RollbackActionID)})
+			if err != nil {
+				return err
+			}
+			st, _ := prev[0].Data()["status"].(string)
+			switch {
+			case !prev[0].Exists(), st == actionRejected, st == actionChangesRequested, st == actionDead:
+			default:
+				return fmt.Errorf("%w: rollback %s already requested", errNotRollbackable, orig.RollbackActionID)
+			}
+		}
+
+		now := time.Now().UTC()
+		p := approvalPolicies.For(actionRollback)
+		details := make(map[string]string, len(orig.Details)+2)
+		for k, v := range orig.Details {
+			details[k] = v
+		}
+		delete(details, "result")
+		details["action"] = orig.ProposedAction
+		details["reason"] = reason
+		rb = actionDoc{
+			ActionID:          uuid.New().String(),
+			AlertID:           orig.AlertID,
+			ProposedAction:    actionRollback,
+			Status:            actionAwaitingApproval,
+			Simulation:        orig.Simulation,
+			Details:           details,
+			Created:           now,
+			RequestedBy:       by,
+			ApprovalsRequired: p.Required,
+			RollbackOf:        orig.ActionID,
+		}
+		rb.ApprovalDeadline = p.DeadlineFrom(now)
+		rb.NextEscalation = p.NextEscalation(now, rb.ApprovalDeadline)
+		rb.OnExpiry = p.Expiry()
+
+		if err := tx.Create(fsClient.Collection(actionsCol).Doc(rb.ActionID), rb); err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "rollback_action_id", Value: rb.ActionID}})
+	})
+	return rb, err
+}
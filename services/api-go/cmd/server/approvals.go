@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	cloudpubsub "cloud.google.com/go/pubsub"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// action statuses (see actions-go)
+const (
+	actionQueued           = "queued"
+	actionAwaitingApproval = "awaiting_approval"
+	actionApproved         = "approved"
+	actionRejected         = "rejected"
+	actionChangesRequested = "changes_requested"
+)
+
+// handleApprove serves /alerts/{id}/approve. The caller's approval is added
+// to each pending action subject to its approval policy; actions whose quorum
+// is met are marked approved and handed to actions-go over actions.queue,
+// which executes them and moves the alert on.
+func handleApprove(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body) // body is optional
+	by, ok := approver(w, r)
+	if !ok {
+		return
+	}
+
+	docRef := fsClient.Collection(alertsCol).Doc(id)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var a alertDoc
+	if err := doc.DataTo(&a); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+	if lifecycle.Normalize(a.Status) != lifecycle.StatusAwaitingApproval {
+		http.Error(w, "alert not awaiting approval", http.StatusConflict)
+		return
+	}
+
+	results, err := approvePending(ctx, id, by, body.Comment)
+	if code, ok := approvalError(err); ok {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err != nil {
+		log.Printf("approve actions for %s error: %v", id, err)
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	if len(results) == 0 {
+		http.Error(w, "no action awaiting approval", http.StatusConflict)
+		return
+	}
+
+	// the approvals are stored; an action whose publish fails is still
+	// approved and the actions-go sweeper queues it, so report it and go on
+	out := make([]map[string]any, 0, len(results))
+	released := []string{}
+	for _, ad := range results {
+		res := map[string]any{
+			"action_id": ad.ActionID,
+			"action":    ad.ProposedAction,
+			"status":    ad.Status,
+			"approvals": len(ad.Approvals),
+			"required":  ad.ApprovalsRequired,
+		}
+		out = append(out, res)
+		if ad.Status != actionApproved {
+			notifier.Notify(ctx, actionMessage(ad, notify.EventApprovalRecorded, fmt.Sprintf(":ballot_box_with_check: %s approved *%s* on alert `%s` (%d/%d approvals).",
+				by, ad.ProposedAction, id, len(ad.Approvals), ad.ApprovalsRequired)))
+			continue
+		}
+		if err := publishApproved(ctx, ad); err != nil {
+			log.Printf("publish action %s error: %v", ad.ActionID, err)
+			res["publish_error"] = err.Error()
+		}
+		released = append(released, ad.ProposedAction)
+	}
+
+	status := http.StatusOK
+	if len(released) > 0 {
+		status = http.StatusAccepted
+		notifier.Notify(ctx, alertMessage(a, notify.EventApprovalGranted, fmt.Sprintf(":white_check_mark: Approval granted for alert `%s` by %s; executing %s.",
+			id, by, strings.Join(released, ", "))))
+	}
+	writeJSON(w, status, map[string]any{"ok": true, "alert_id": id, "actions": out})
+}
+
+// approvePending adds by's approval to each of the alert's actions awaiting
+// approval, releasing (status approved) those whose policy quorum is met. It
+// runs in one transaction that checks every action's policy before writing,
+// so a policy violation on any of them leaves all of them as they were.
+func approvePending(ctx context.Context, alertID, by, comment string) ([]actionDoc, error) {
+	docs, err := fsClient.Collection(actionsCol).Where("alert_id", "==", alertID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*firestore.DocumentRef, len(docs))
+	for i, snap := range docs {
+		refs[i] = snap.Ref
+	}
+	var out []actionDoc
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		out = nil
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		var changed []*firestore.DocumentRef
+		var updates [][]firestore.Update
+		for _, snap := range snaps {
+			if !snap.Exists() {
+				continue
+			}
+			var ad actionDoc
+			if err := snap.DataTo(&ad); err != nil {
+				return err
+			}
+			if ad.Status != actionAwaitingApproval {
+				continue
+			}
+			u, err := addApproval(&ad, by, comment)
+			if err != nil {
+				return fmt.Errorf("%s: %w", ad.ProposedAction, err)
+			}
+			changed, updates = append(changed, snap.Ref), append(updates, u)
+			out = append(out, ad)
+		}
+		for i, ref := range changed {
+			if err := tx.Update(ref, updates[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// approveAction records by's approval on one action if it is awaiting
+// approval, marking it approved once its policy quorum is met. changed is
+// false when the action was not pending.
+func approveAction(ctx context.Context, ref *firestore.DocumentRef, by, comment string) (ad actionDoc, changed bool, err error) {
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		ad = actionDoc{}
+		if err := snaps[0].DataTo(&ad); err != nil {
+			return err
+		}
+		if ad.Status != actionAwaitingApproval {
+			return nil
+		}
+		updates, err := addApproval(&ad, by, comment)
+		if err != nil {
+			return err
+		}
+		changed = true
+		return tx.Update(ref, updates)
+	})
+	return ad, changed, err
+}
+
+// addApproval checks by's approval of ad against its policy and adds it,
+// marking ad approved once the quorum is met. It returns the updates that
+// store the change.
+func addApproval(ad *actionDoc, by, comment string) ([]firestore.Update, error) {
+	p := approvalPolicies.For(ad.ProposedAction)
+	if err := approvalPolicies.Check(p, by, ad.RequestedBy, ad.Details["principal"], ad.Approvals); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ad.Approvals = append(ad.Approvals, approval.Approval{By: by, Comment: comment, At: now})
+	ad.ApprovalsRequired = p.Required
+	updates := []firestore.Update{
+		{Path: "approvals", Value: ad.Approvals},
+		{Path: "approvals_required", Value: p.Required},
+	}
+	if p.Met(ad.Approvals) {
+		reason := fmt.Sprintf("quorum met (%d/%d)", len(ad.Approvals), p.Required)
+		ad.Status, ad.DecidedBy, ad.DecisionReason, ad.DecidedAt = actionApproved, by, reason, &now
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: actionApproved},
+			firestore.Update{Path: "decided_by", Value: by},
+			firestore.Update{Path: "decision_reason", Value: reason},
+			firestore.Update{Path: "decided_at", Value: now})
+	}
+	return updates, nil
+}
+
+// publishApproved hands an approved action to actions-go.
+func publishApproved(ctx context.Context, ad actionDoc) error {
+	b, _ := json.Marshal(map[string]string{"action_id": ad.ActionID, "alert_id": ad.AlertID})
+	_, err := pubClient.Topic(topicActions).Publish(ctx, &cloudpubsub.Message{
+		Data: b,
+		Attributes: map[string]string{
+			"alert_id":  ad.AlertID,
+			"action_id": ad.ActionID,
+			"action":    ad.ProposedAction,
+		},
+	}).Get(ctx)
+	return err
+}
+
+// approvalError maps approval policy errors onto HTTP statuses; ok is false
+// for other errors.
+func approvalError(err error) (int, bool) {
+	switch {
+	case errors.Is(err, approval.ErrSelfApproval), errors.Is(err, approval.ErrNotApprover):
+		return http.StatusForbidden, true
+	case errors.Is(err, approval.ErrAlreadyApproved):
+		return http.StatusConflict, true
+	}
+	return 0, false
+}
+
+// errNotAwaitingApproval is returned when an alert has no approval pending.
+var errNotAwaitingApproval = errors.New("alert not awaiting approval")
+
+// handleDecline serves /alerts/{id}/reject and /alerts/{id}/request-changes.
+// Both need a reason, close out the alert's pending actions with actionStatus
+// and move the alert to alertStatus.
+func handleDecline(w http.ResponseWriter, r *http.Request, id, actionStatus, alertStatus string) {
+	ctx := r.Context()
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "bad request: reason is required", http.StatusBadRequest)
+		return
+	}
+	by, ok := approver(w, r)
+	if !ok {
+		return
+	}
+
+	docRef := fsClient.Collection(alertsCol).Doc(id)
+	if _, err := docRef.Get(ctx); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	n, err := declineAlert(ctx, id, actionStatus, alertStatus, by, body.Reason)
+	switch {
+	case errors.Is(err, errNotAwaitingApproval), errors.Is(err, lifecycle.ErrNotAllowed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "alert_id": id, "status": alertStatus, "actions_closed": n})
+}
+
+// declineAlert closes out the pending actions of an alert awaiting approval
+// with actionStatus and moves the alert to alertStatus in one transaction,
+// so neither can change without the other, then announces it. It returns
+// how many actions it closed.
+func declineAlert(ctx context.Context, id, actionStatus, alertStatus, by, reason string) (int, error) {
+	docRef := fsClient.Collection(alertsCol).Doc(id)
+	actions, err := fsClient.Collection(actionsCol).Where("alert_id", "==", id).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	refs := []*firestore.DocumentRef{docRef}
+	for _, snap := range actions {
+		refs = append(refs, snap.Ref)
+	}
+	// approved actions are already on actions.queue and belong to the
+	// workers; only those still waiting are closed
+	pending := []string{actionAwaitingApproval, actionQueued}
+
+	var a alertDoc
+	n := 0
+	err = fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		n = 0
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		if !snaps[0].Exists() {
+			return lifecycle.ErrNotFound
+		}
+		if err := snaps[0].DataTo(&a); err != nil {
+			return err
+		}
+		if lifecycle.Normalize(a.Status) != lifecycle.StatusAwaitingApproval {
+			return errNotAwaitingApproval
+		}
+		updates, err := lifecycle.Updates(a.Status, alertStatus, by, reason)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		for _, snap := range snaps[1:] {
+			st, _ := snap.Data()["status"].(string)
+			if !snap.Exists() || !slices.Contains(pending, st) {
+				continue
+			}
+			if err := tx.Update(snap.Ref, []firestore.Update{
+				{Path: "status", Value: actionStatus},
+				{Path: "decided_by", Value: by},
+				{Path: "decision_reason", Value: reason},
+				{Path: "decided_at", Value: now},
+			}); err != nil {
+				return err
+			}
+			n++
+		}
+		return tx.Update(docRef, updates)
+	})
+	if err != nil {
+		log.Printf("decline alert %s error: %v", id, err)
+		return 0, err
+	}
+
+	verb := "rejected"
+	if actionStatus == actionChangesRequested {
+		verb = "sent back for changes"
+	}
+	notifier.Notify(ctx, alertMessage(a, notify.EventApprovalRejected, fmt.Sprintf(":no_entry: Approval for alert `%s` %s by %s: %s", id, verb, by, reason)))
+	log.Printf("alert %s %s by %s (%d actions closed)", id, verb, by, n)
+	notifyTransition(ctx, id, alertStatus, by, reason)
+	syncIssue(ctx, id, alertStatus, by, reason)
+	return n, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/guardrail"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+func handleGuardrails(w http.ResponseWriter, r *http.Request) {
+	// paths: /guardrails [GET]
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	docs, err := fsClient.Collection(guardrailsCol).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("firestore list guardrails error: %v", err)
+		http.Error(w, "firestore error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	all := r.URL.Query().Get("all") == "1"
+	var ks guardrail.KillSwitch
+	circuits := []guardrail.State{}
+	for _, doc := range docs {
+		if doc.Ref.ID == guardrail.KillSwitchDoc {
+			_ = doc.DataTo(&ks)
+			continue
+		}
+		var st guardrail.State
+		if err := doc.DataTo(&st); err != nil {
+			log.Printf("decode error: %v", err)
+			continue
+		}
+		if all || st.IsOpen(now) {
+			circuits = append(circuits, st)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"kill_switch": ks, "circuits": circuits})
+}
+
+func handleGuardrailByPath(w http.ResponseWriter, r *http.Request) {
+	// paths: /guardrails/kill-switch [PUT], /guardrails/circuits/{key} [DELETE]
+	path := strings.TrimPrefix(r.URL.Path, "/guardrails/")
+	switch {
+	case path == "kill-switch" && r.Method == http.MethodPut:
+		handleKillSwitch(w, r)
+	case strings.HasPrefix(path, "circuits/") && r.Method == http.MethodDelete:
+		handleResetCircuit(w, r, strings.TrimPrefix(path, "circuits/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleKillSwitch engages or releases the global kill switch. While it is
+// engaged actions-go sends every automated action to approval. Releasing it
+// does not run the actions it held; they still need approving.
+func handleKillSwitch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var body struct {
+		Engaged *bool  `json:"engaged"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Engaged == nil {
+		http.Error(w, "bad request: engaged is required", http.StatusBadRequest)
+		return
+	}
+	if *body.Engaged && strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "bad request: reason is required to engage", http.StatusBadRequest)
+		return
+	}
+	by := actor(r)
+	ks := guardrail.KillSwitch{Engaged: *body.Engaged, By: by, Reason: body.Reason, Updated: time.Now().UTC()}
+	if _, err := fsClient.Collection(guardrailsCol).Doc(guardrail.KillSwitchDoc).Set(ctx, ks); err != nil {
+		log.Printf("kill switch write error: %v", err)
+		http.Error(w, "firestore write error", http.StatusInternalServerError)
+		return
+	}
+	if ks.Engaged {
+		notifier.Notify(ctx, notify.Message{Event: notify.EventGuardrail,
+			Text: fmt.Sprintf(":octagonal_sign: Kill switch engaged by %s: %s. Automated actions now need approval.", by, ks.Reason)})
+	} else {
+		notifier.Notify(ctx, notify.Message{Event: notify.EventGuardrail,
+			Text: fmt.Sprintf(":large_green_circle: Kill switch released by %s. Automated actions run again; held ones still need approval.", by)})
+	}
+	log.Printf("kill switch engaged=%t by %s: %s", ks.Engaged, by, ks.Reason)
+	writeJSON(w, http.StatusOK, ks)
+}
+
+// handleResetCircuit closes a tripped rate limit or breaker before its
+// cooldown ends and clears its count.
+func handleResetCircuit(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+	if key == "" || key == guardrail.KillSwitchDoc || strings.Contains(key, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	ref := fsClient.Collection(guardrailsCol).Doc(key)
+	if _, err := ref.Get(ctx); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "open_until", Value: nil},
+		{Path: "reason", Value: ""},
+		{Path: "hits", Value: []time.Time{}},
+		{Path: "updated", Value: time.Now().UTC()},
+	}); err != nil {
+		log.Printf("reset circuit %s error: %v", key, err)
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	by := actor(r)
+	notifier.Notify(ctx, notify.Message{Event: notify.EventGuardrail, Text: fmt.Sprintf(":large_green_circle: Guardrail `%s` reset by %s.", key, by)})
+	log.Printf("guardrail %s reset by %s", key, by)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/api/iterator"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/jira"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+)
+
+// handleJiraWebhook serves /jira/webhook, the URL of a Jira webhook on
+// issue updates. It is authenticated by the webhook secret's
+// X-Hub-Signature rather than the API key. When an alert's issue reaches a
+// done status the alert is resolved as the Jira user who closed it; the
+// change is not synced back to Jira.
+func handleJiraWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if jiraClient == nil || jiraWebhookSecret == "" {
+		http.Error(w, "jira webhook not configured", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !jira.VerifySignature(jiraWebhookSecret, body, r.Header.Get("X-Hub-Signature")) {
+		log.Printf("jira webhook rejected: signature mismatch")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var ev jira.WebhookEvent
+	if err := json.Unmarshal(body, &ev); err != nil || ev.Issue.Key == "" {
+		http.Error(w, "bad request: issue", http.StatusBadRequest)
+		return
+	}
+	if !ev.Closed() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := r.Context()
+	it := fsClient.Collection(alertsCol).Where("issue_key", "==", ev.Issue.Key).Limit(1).Documents(ctx)
+	defer it.Stop()
+	doc, err := it.Next()
+	if errors.Is(err, iterator.Done) {
+		w.WriteHeader(http.StatusNoContent) // not one of ours
+		return
+	}
+	if err != nil {
+		log.Printf("jira webhook: find alert for %s: %v", ev.Issue.Key, err)
+		http.Error(w, "firestore query error", http.StatusInternalServerError)
+		return
+	}
+	var a alertDoc
+	if err := doc.DataTo(&a); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+	if lifecycle.IsTerminal(lifecycle.Normalize(a.Status)) {
+		w.WriteHeader(http.StatusNoContent) // closed here first
+		return
+	}
+
+	by := ev.Actor()
+	reason := fmt.Sprintf("Jira issue %s moved to %s", ev.Issue.Key, ev.Issue.Fields.Status.Name)
+	if res := ev.Issue.Fields.Resolution; res != nil && res.Name != "" {
+		reason += " (" + res.Name + ")"
+	}
+	_, err = lifecycle.Apply(ctx, fsClient, doc.Ref, lifecycle.StatusResolved, by, reason)
+	switch {
+	case errors.Is(err, lifecycle.ErrNotAllowed):
+		log.Printf("jira webhook: alert %s (%s) not resolved: %v", doc.Ref.ID, ev.Issue.Key, err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		log.Printf("jira webhook: resolve alert %s: %v", doc.Ref.ID, err)
+		http.Error(w, "firestore update error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("alert %s resolved from Jira %s by %s", doc.Ref.ID, ev.Issue.Key, by)
+	notifyTransition(ctx, doc.Ref.ID, lifecycle.StatusResolved, by, reason)
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "alert_id": doc.Ref.ID, "issue_key": ev.Issue.Key})
+}
+
+// syncIssue comments on and closes the alert's Jira issue when the alert is
+// closed in sentinelflow. Failures are logged only.
+func syncIssue(ctx context.Context, id, to, by, reason string) {
+	if jiraClient == nil || !lifecycle.IsTerminal(to) {
+		return
+	}
+	doc, err := fsClient.Collection(alertsCol).Doc(id).Get(ctx)
+	if err != nil {
+		log.Printf("firestore alert %s read error: %v", id, err)
+		return
+	}
+	key, _ := doc.Data()["issue_key"].(string)
+	if key == "" {
+		return
+	}
+	text := fmt.Sprintf("Alert %s closed as %s by %s in sentinelflow.", id, to, by)
+	if reason != "" {
+		text += "\nReason: " + reason
+	}
+	if err := jiraClient.Comment(ctx, key, text); err != nil {
+		log.Printf("jira: comment on %s for alert %s: %v", key, id, err)
+	}
+	name := jiraClient.Config().ResolveTransition
+	if err := jiraClient.Transition(ctx, key, name); err != nil {
+		if errors.Is(err, jira.ErrNoTransition) {
+			log.Printf("jira: %s left as is: %v", key, err) // usually already closed
+			return
+		}
+		log.Printf("jira: transition %s for alert %s: %v", key, id, err)
+	}
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -15,51 +14,117 @@ import (
 	"cloud.google.com/go/firestore"
 	cloudpubsub "cloud.google.com/go/pubsub"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
-	smpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"google.golang.org/api/iterator"
 
-	"github.com/google/uuid"
 	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/baseline"
+	"github.com/jinishshah00/sentinelflow/internal/shared/correlate"
+	"github.com/jinishshah00/sentinelflow/internal/shared/detect"
+	"github.com/jinishshah00/sentinelflow/internal/shared/executor"
+	"github.com/jinishshah00/sentinelflow/internal/shared/intel"
+	"github.com/jinishshah00/sentinelflow/internal/shared/jira"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+	"github.com/jinishshah00/sentinelflow/internal/shared/secrets"
 )
 
 // -------- shared local types (match what triage writes) --------
 type triageResult struct {
-	Severity     shared.Severity `json:"severity" firestore:"severity"`
-	Confidence   float64         `json:"confidence" firestore:"confidence"`
-	ReasonTokens []string        `json:"reason_tokens" firestore:"reason_tokens"`
+	Severity     shared.Severity   `json:"severity" firestore:"severity"`
+	Confidence   float64           `json:"confidence" firestore:"confidence"`
+	ReasonTokens []string          `json:"reason_tokens" firestore:"reason_tokens"`
+	IntelMatches []intel.Match     `json:"intel_matches,omitempty" firestore:"intel_matches"`
+	Anomaly      *baseline.Anomaly `json:"anomaly,omitempty" firestore:"anomaly"`
+	ChangeWindow string            `json:"change_window,omitempty" firestore:"change_window"`
+	ChangeFreeze string            `json:"change_freeze,omitempty" firestore:"change_freeze"`
 }
 
 type alertDoc struct {
-	AlertID string       `json:"alert_id" firestore:"alert_id"`
-	Event   shared.Event `json:"event" firestore:"event"`
-	Triage  triageResult `json:"triage" firestore:"triage"`
-	Status  string       `json:"status" firestore:"status"`
-	Created time.Time    `json:"created" firestore:"created"`
+	AlertID      string                 `json:"alert_id" firestore:"alert_id"`
+	Event        shared.Event           `json:"event" firestore:"event"`
+	Triage       triageResult           `json:"triage" firestore:"triage"`
+	Status       string                 `json:"status" firestore:"status"`
+	IncidentID   string                 `json:"incident_id,omitempty" firestore:"incident_id"`
+	SuppressedBy string                 `json:"suppressed_by,omitempty" firestore:"suppressed_by"`
+	Detection    *detect.Firing         `json:"detection,omitempty" firestore:"detection"`
+	History      []lifecycle.Transition `json:"history,omitempty" firestore:"history"`
+	Updated      *time.Time             `json:"updated,omitempty" firestore:"updated"`
+	Fingerprint  string                 `json:"fingerprint,omitempty" firestore:"fingerprint"`
+	Occurrences  int                    `json:"occurrences,omitempty" firestore:"occurrences"`
+	FirstSeen    *time.Time             `json:"first_seen,omitempty" firestore:"first_seen"`
+	LastSeen     *time.Time             `json:"last_seen,omitempty" firestore:"last_seen"`
+	IssueKey     string                 `json:"issue_key,omitempty" firestore:"issue_key"` // Jira issue, see JIRA_FILE
+	IssueURL     string                 `json:"issue_url,omitempty" firestore:"issue_url"`
+	Created      time.Time              `json:"created" firestore:"created"`
 }
 
 type actionDoc struct {
 	ActionID       string            `json:"action_id" firestore:"action_id"`
 	AlertID        string            `json:"alert_id" firestore:"alert_id"`
 	ProposedAction string            `json:"proposed_action" firestore:"proposed_action"`
-	Status         string            `json:"status" firestore:"status"` // queued|executed
+	Status         string            `json:"status" firestore:"status"` // see action statuses
 	Simulation     bool              `json:"simulation" firestore:"simulation"`
 	Details        map[string]string `json:"details,omitempty" firestore:"details"`
 	Created        time.Time         `json:"created" firestore:"created"`
 	ExecutedAt     *time.Time        `json:"executed_at,omitempty" firestore:"executed_at"`
+	Result         *executor.Result  `json:"result,omitempty" firestore:"result"`
+	Attempts       int               `json:"attempts,omitempty" firestore:"attempts"`
+	LastError      string            `json:"last_error,omitempty" firestore:"last_error"`
+	NextAttemptAt  *time.Time        `json:"next_attempt_at,omitempty" firestore:"next_attempt_at"`
+	DecidedBy      string            `json:"decided_by,omitempty" firestore:"decided_by"`
+	DecisionReason string            `json:"decision_reason,omitempty" firestore:"decision_reason"`
+	DecidedAt      *time.Time        `json:"decided_at,omitempty" firestore:"decided_at"`
+
+	RequestedBy       string              `json:"requested_by,omitempty" firestore:"requested_by"`
+	Approvals         []approval.Approval `json:"approvals,omitempty" firestore:"approvals"`
+	ApprovalsRequired int                 `json:"approvals_required,omitempty" firestore:"approvals_required"`
+	ApprovalDeadline  *time.Time          `json:"approval_deadline,omitempty" firestore:"approval_deadline"`
+	NextEscalation    *time.Time          `json:"next_escalation,omitempty" firestore:"next_escalation"`
+	Escalations       int                 `json:"escalations,omitempty" firestore:"escalations"`
+	OnExpiry          string              `json:"on_expiry,omitempty" firestore:"on_expiry"`
+	ExpiredAt         *time.Time          `json:"expired_at,omitempty" firestore:"expired_at"`
+
+	PlaybookRunID string     `json:"playbook_run_id,omitempty" firestore:"playbook_run_id"`
+	StepID        string     `json:"step_id,omitempty" firestore:"step_id"`
+	Guardrail     string     `json:"guardrail,omitempty" firestore:"guardrail"`           // why automation was held for approval
+	DeferredUntil *time.Time `json:"deferred_until,omitempty" firestore:"deferred_until"` // change freeze deferral
+
+	// rollback links: a rollback action points at the action it undoes and
+	// the undone action points back at it.
+	RollbackOf       string     `json:"rollback_of,omitempty" firestore:"rollback_of"`
+	RollbackActionID string     `json:"rollback_action_id,omitempty" firestore:"rollback_action_id"`
+	RolledBackAt     *time.Time `json:"rolled_back_at,omitempty" firestore:"rolled_back_at"`
 }
 
 // ----------------- globals -----------------
 var (
-	projectID    string
-	apiKey       string // loaded from Secret Manager
-	apiSecret    string // secret id, default: API_KEY
-	fsClient     *firestore.Client
-	pubClient    *cloudpubsub.Client
-	smClient     *secretmanager.Client
-	alertsCol    string
-	actionsCol   string
-	topicActions string
-	slackSecret  string
+	projectID     string
+	apiKey        string // loaded from Secret Manager
+	apiSecret     string // secret id, default: API_KEY
+	fsClient      *firestore.Client
+	pubClient     *cloudpubsub.Client
+	secretStore   *secrets.Store
+	alertsCol     string
+	actionsCol    string
+	incidentsCol  string
+	runsCol       string
+	guardrailsCol string
+	topicActions  string
+
+	notifier           *notify.Router
+	notificationsCol   string
+	throttleCol        string // channel limits and pending digests, shared with actions-go
+	slackSigningSecret string // verifies /slack/interactivity; empty disables it
+
+	suppressionsCol   string
+	suppressionMaxTTL time.Duration
+
+	approvalPolicies approval.Config
+	identityHeader   string // authenticated identity header (e.g. from IAP); empty: X-Actor
+
+	jiraClient        *jira.Client // nil unless JIRA_FILE is set
+	jiraWebhookSecret string       // verifies /jira/webhook; empty disables it
 )
 
 // ----------------- helpers -----------------
@@ -85,19 +150,45 @@ func main() {
 	ctx := context.Background()
 
 	projectID = getenv("GOOGLE_CLOUD_PROJECT", "")
+	secretStore = &secrets.Store{Project: projectID}
 	if projectID == "" {
 		log.Fatal("GOOGLE_CLOUD_PROJECT must be set")
 	}
 	apiSecret = getenv("API_SECRET_ID", "API_KEY")
-	slackSecret = getenv("SLACK_SECRET_ID", "SLACK_WEBHOOK")
 	alertsCol = getenv("FIRESTORE_COLLECTION_ALERTS", "alerts")
 	actionsCol = getenv("FIRESTORE_COLLECTION_ACTIONS", "actions")
+	incidentsCol = getenv("FIRESTORE_COLLECTION_INCIDENTS", "incidents")
+	runsCol = getenv("FIRESTORE_COLLECTION_PLAYBOOK_RUNS", "playbook_runs")
+	guardrailsCol = getenv("FIRESTORE_COLLECTION_GUARDRAILS", "guardrails")
+	notificationsCol = getenv("FIRESTORE_COLLECTION_NOTIFICATIONS", "notifications")
+	throttleCol = getenv("FIRESTORE_COLLECTION_NOTIFY_THROTTLE", "notify_throttle")
+	suppressionsCol = getenv("FIRESTORE_COLLECTION_SUPPRESSIONS", "suppressions")
+	suppressionMaxTTL = must(time.ParseDuration(getenv("SUPPRESSION_MAX_TTL", "2160h")))
 	topicActions = getenv("TOPIC_ACTIONS_QUEUE", "actions.queue")
 
+	// who may approve what: built-in defaults unless APPROVAL_POLICIES is set
+	approvalPolicies = approval.DefaultConfig()
+	if path := getenv("APPROVAL_POLICIES", ""); path != "" {
+		approvalPolicies = must(approval.LoadConfig(path))
+	}
+	identityHeader = getenv("IDENTITY_HEADER", "")
+
+	// notification channels and routing: Slack webhooks unless NOTIFY_FILE is set
+	notifyCfg := notify.DefaultConfig(getenv("SLACK_SECRET_ID", "SLACK_WEBHOOK"), getenv("SLACK_ESCALATION_SECRET_ID", ""))
+	if path := getenv("NOTIFY_FILE", ""); path != "" {
+		notifyCfg = must(notify.LoadConfig(path))
+	}
+	notifier = must(notify.NewRouter(notifyCfg, secretStore.Access))
+	if dir := getenv("NOTIFY_TEMPLATES", ""); dir != "" {
+		notifier.UseTemplates(must(notify.LoadTemplates(dir, notifyCfg)))
+	}
+
 	// clients
 	fsClient = must(firestore.NewClient(ctx, projectID))
 	pubClient = must(cloudpubsub.NewClient(ctx, projectID))
-	smClient = must(secretmanager.NewClient(ctx))
+	secretStore.Client = must(secretmanager.NewClient(ctx))
+	notifier.UseThrottle(fsClient, throttleCol) // actions-go sends the digests
+	notifier.UseStore(fsClient, notificationsCol, alertsCol, "api-go")
 
 	// load API key once
 	apiKey = loadSecret(ctx, apiSecret)
@@ -105,11 +196,44 @@ func main() {
 		log.Fatal("API key missing in Secret Manager")
 	}
 
+	// Slack interactivity (approval buttons) is off unless a signing secret is configured
+	if id := getenv("SLACK_SIGNING_SECRET_ID", ""); id != "" {
+		slackSigningSecret = strings.TrimSpace(loadSecret(ctx, id))
+		if slackSigningSecret == "" {
+			log.Fatal("Slack signing secret missing in Secret Manager")
+		}
+	}
+
+	// Jira: close alerts' issues when they are closed here, and the reverse
+	if path := getenv("JIRA_FILE", ""); path != "" {
+		jiraCfg := must(jira.LoadConfig(path))
+		jiraClient = jira.NewClient(jiraCfg, secretStore.Access)
+		if jiraCfg.WebhookSecret != "" {
+			jiraWebhookSecret = strings.TrimSpace(loadSecret(ctx, jiraCfg.WebhookSecret))
+			if jiraWebhookSecret == "" {
+				log.Fatal("Jira webhook secret missing in Secret Manager")
+			}
+		}
+	}
+
 	// http mux
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", handleHealth)
 	mux.HandleFunc("/alerts", withAuth(handleListAlerts))
 	mux.HandleFunc("/alerts/", withAuth(handleAlertByID)) // /alerts/{id}
+	mux.HandleFunc("/incidents", withAuth(handleListIncidents))
+	mux.HandleFunc("/incidents/", withAuth(handleIncidentByID)) // /incidents/{id}
+	mux.HandleFunc("/suppressions", withAuth(handleSuppressions))
+	mux.HandleFunc("/suppressions/", withAuth(handleSuppressionByID)) // /suppressions/{id}
+	mux.HandleFunc("/playbook-runs", withAuth(handleListPlaybookRuns))
+	mux.HandleFunc("/playbook-runs/", withAuth(handlePlaybookRunByID)) // /playbook-runs/{id}
+	mux.HandleFunc("/actions/", withAuth(handleActionByID))            // /actions/{id}
+	mux.HandleFunc("/guardrails", withAuth(handleGuardrails))
+	mux.HandleFunc("/guardrails/", withAuth(handleGuardrailByPath)) // kill-switch, circuits/{key}
+	mux.HandleFunc("/notifications", withAuth(handleListNotifications))
+	mux.HandleFunc("/notifications/preview", withAuth(handleNotificationPreview))
+	mux.HandleFunc("/slack/interactivity", handleSlackInteractivity) // signed by Slack, no API key
+	mux.HandleFunc("/jira/webhook", handleJiraWebhook)               // signed by Jira, no API key
 	mux.HandleFunc("/metrics", withAuth(handleMetrics))
 
 	addr := ":" + getenv("PORT", "8083")
@@ -129,6 +253,37 @@ func withAuth(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// actor identifies who is acting on a request, for history. With
+// IDENTITY_HEADER set (a header an authenticating proxy such as IAP sets
+// and clients cannot), only that header counts. Otherwise the caller's
+// X-Actor claim is taken as is: advisory, since any holder of the API key
+// can name anyone. Decisions use approver instead.
+func actor(r *http.Request) string {
+	if identityHeader != "" {
+		if a := approval.Identity(r.Header.Get(identityHeader)); a != "" {
+			return a
+		}
+		return "api"
+	}
+	if a := strings.TrimSpace(r.Header.Get("X-Actor")); a != "" {
+		return a
+	}
+	return "api"
+}
+
+// approver is the caller's authenticated identity, for approving,
+// rejecting and rolling back: only IDENTITY_HEADER counts, and the shared
+// "api" fallback never does. Without one it answers 403 and ok is false.
+func approver(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if identityHeader != "" {
+		if a := approval.Identity(r.Header.Get(identityHeader)); a != "" {
+			return a, true
+		}
+	}
+	http.Error(w, "forbidden: approvals need an authenticated identity (IDENTITY_HEADER)", http.StatusForbidden)
+	return "", false
+}
+
 // ------------- handlers -------------
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
@@ -165,6 +320,7 @@ func handleListAlerts(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "decode error", http.StatusInternalServerError)
 			return
 		}
+		a.Status = lifecycle.Normalize(a.Status)
 		out = append(out, a)
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"alerts": out})
@@ -172,7 +328,8 @@ func handleListAlerts(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleAlertByID(w http.ResponseWriter, r *http.Request) {
-	// paths: /alerts/{id} [GET], /alerts/{id}/approve [POST]
+	// paths: /alerts/{id} [GET], /alerts/{id}/approve [POST], /alerts/{id}/reject [POST],
+	// /alerts/{id}/request-changes [POST], /alerts/{id}/transition [POST]
 	ctx := r.Context()
 	path := strings.TrimPrefix(r.URL.Path, "/alerts/")
 	parts := strings.Split(path, "/")
@@ -193,81 +350,145 @@ func handleAlertByID(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "decode error", http.StatusInternalServerError)
 			return
 		}
+		a.Status = lifecycle.Normalize(a.Status)
 		writeJSON(w, http.StatusOK, a)
 		return
 	}
 
 	if len(parts) == 2 && parts[1] == "approve" && r.Method == http.MethodPost {
-		// fetch alert
-		docRef := fsClient.Collection(alertsCol).Doc(id)
-		doc, err := docRef.Get(ctx)
-		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
+		handleApprove(w, r, id)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "reject" && r.Method == http.MethodPost {
+		handleDecline(w, r, id, actionRejected, lifecycle.StatusRejected)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "request-changes" && r.Method == http.MethodPost {
+		handleDecline(w, r, id, actionChangesRequested, lifecycle.StatusInProgress)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "transition" && r.Method == http.MethodPost {
+		var body struct {
+			To     string `json:"to"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !lifecycle.Known(body.To) {
+			http.Error(w, "bad request: unknown target status", http.StatusBadRequest)
 			return
 		}
-		var a alertDoc
-		if err := doc.DataTo(&a); err != nil {
-			http.Error(w, "decode error", http.StatusInternalServerError)
+		if !lifecycle.Manual(body.To) {
+			http.Error(w, "bad request: "+body.To+" is set by the response workflow", http.StatusBadRequest)
 			return
 		}
-		if a.Status != "awaiting_approval" {
-			http.Error(w, "alert not awaiting approval", http.StatusConflict)
+		docRef := fsClient.Collection(alertsCol).Doc(id)
+		from, err := lifecycle.Apply(ctx, fsClient, docRef, body.To, actor(r), body.Reason)
+		switch {
+		case errors.Is(err, lifecycle.ErrNotFound):
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		case errors.Is(err, lifecycle.ErrNotAllowed):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("transition %s error: %v", id, err)
+			http.Error(w, "firestore update error", http.StatusInternalServerError)
 			return
 		}
+		notifyTransition(ctx, id, body.To, actor(r), body.Reason)
+		syncIssue(ctx, id, body.To, actor(r), body.Reason)
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "alert_id": id, "from": from, "to": body.To})
+		return
+	}
 
-		// record an executed simulated remediation (post-approval)
-		now := time.Now().UTC()
-		ad := actionDoc{
-			ActionID:       uuid.New().String(),
-			AlertID:        id,
-			ProposedAction: "remediate_require_approval",
-			Status:         "executed",
-			Simulation:     true,
-			Details:        map[string]string{"note": "approved via API"},
-			Created:        now,
-			ExecutedAt:     &now,
+	http.NotFound(w, r)
+}
+
+func handleListIncidents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if n, err := strconv.Atoi(q); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	iter := fsClient.Collection(incidentsCol).OrderBy("last_seen", firestore.Desc).Limit(limit).Documents(ctx)
+	var out []correlate.Incident
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
 		}
-		_, err = fsClient.Collection(actionsCol).Doc(ad.ActionID).Set(ctx, ad)
 		if err != nil {
-			http.Error(w, "firestore write error", http.StatusInternalServerError)
+			log.Printf("firestore list incidents error: %v", err)
+			http.Error(w, "firestore error", http.StatusInternalServerError)
 			return
 		}
-
-		// update alert status
-		_, err = docRef.Update(ctx, []firestore.Update{{Path: "status", Value: "action_executed"}})
-		if err != nil {
-			http.Error(w, "firestore update error", http.StatusInternalServerError)
+		var inc correlate.Incident
+		if err := doc.DataTo(&inc); err != nil {
+			log.Printf("decode error: %v", err)
+			http.Error(w, "decode error", http.StatusInternalServerError)
 			return
 		}
+		out = append(out, inc)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"incidents": out})
+}
 
-		// publish to actions.queue for visibility
-		b, _ := json.Marshal(ad)
-		_, _ = pubClient.Topic(getenv("TOPIC_ACTIONS_QUEUE", "actions.queue")).Publish(ctx, &cloudpubsub.Message{
-			Data: b,
-			Attributes: map[string]string{
-				"alert_id": id,
-				"action":   ad.ProposedAction,
-			},
-		}).Get(ctx)
-
-		// Slack notify
-		webhook := loadSecret(ctx, slackSecret)
-		if webhook != "" {
-			msg := fmt.Sprintf(":white_check_mark: Approval granted for alert `%s`; simulated remediation recorded.", id)
-			_ = postSlack(ctx, webhook, msg)
-		}
+func handleIncidentByID(w http.ResponseWriter, r *http.Request) {
+	// paths: /incidents/{id} [GET]
+	ctx := r.Context()
+	id := strings.TrimPrefix(r.URL.Path, "/incidents/")
+	if id == "" || strings.Contains(id, "/") || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
 
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "alert_id": id})
+	doc, err := fsClient.Collection(incidentsCol).Doc(id).Get(ctx)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var inc correlate.Incident
+	if err := doc.DataTo(&inc); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
 		return
 	}
 
-	http.NotFound(w, r)
+	// expand member alerts
+	refs := make([]*firestore.DocumentRef, 0, len(inc.AlertIDs))
+	for _, aid := range inc.AlertIDs {
+		refs = append(refs, fsClient.Collection(alertsCol).Doc(aid))
+	}
+	alerts := []alertDoc{}
+	if len(refs) > 0 {
+		snaps, err := fsClient.GetAll(ctx, refs)
+		if err != nil {
+			log.Printf("firestore get incident alerts error: %v", err)
+			http.Error(w, "firestore error", http.StatusInternalServerError)
+			return
+		}
+		for _, s := range snaps {
+			if !s.Exists() {
+				continue
+			}
+			var a alertDoc
+			if err := s.DataTo(&a); err != nil {
+				continue
+			}
+			alerts = append(alerts, a)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"incident": inc, "alerts": alerts})
 }
 
 func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	iter := fsClient.Collection(alertsCol).OrderBy("created", firestore.Desc).Limit(200).Documents(ctx)
-	type C struct{ Low, Med, High, Awaiting, Executed, Pending int }
+	type C struct{ Low, Med, High, Awaiting, Executed, Pending, Suppressed int }
 	var c C
 	for {
 		doc, err := iter.Next()
@@ -291,13 +512,15 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 		case shared.SeverityHigh:
 			c.High++
 		}
-		switch a.Status {
-		case "awaiting_approval":
+		switch lifecycle.Normalize(a.Status) {
+		case lifecycle.StatusAwaitingApproval:
 			c.Awaiting++
-		case "action_executed":
+		case lifecycle.StatusActionExecuted:
 			c.Executed++
-		case "pending":
+		case lifecycle.StatusTriaged:
 			c.Pending++
+		case lifecycle.StatusSuppressed:
+			c.Suppressed++
 		}
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"sample_window": 200, "counts": c})
@@ -312,24 +535,9 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 }
 
 func loadSecret(ctx context.Context, secretID string) string {
-	name := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, secretID)
-	resp, err := smClient.AccessSecretVersion(ctx, &smpb.AccessSecretVersionRequest{Name: name})
+	v, err := secretStore.Access(ctx, secretID)
 	if err != nil {
 		log.Printf("secret %s error: %v", secretID, err)
-		return ""
 	}
-	return string(resp.Payload.Data)
-}
-
-func postSlack(ctx context.Context, webhook, text string) error {
-	body := map[string]any{"text": text}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	_ = resp.Body.Close()
-	return nil
+	return v
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+func handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	// paths: /notifications?alert_id=&limit= [GET]
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if n, err := strconv.Atoi(q); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	q := fsClient.Collection(notificationsCol).OrderBy("created", firestore.Desc).Limit(limit)
+	if alertID := r.URL.Query().Get("alert_id"); alertID != "" {
+		// filter without needing a composite index
+		q = fsClient.Collection(notificationsCol).Where("alert_id", "==", alertID).Limit(limit)
+	}
+	iter := q.Documents(ctx)
+	out := []notify.Record{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("firestore list notifications error: %v", err)
+			http.Error(w, "firestore error", http.StatusInternalServerError)
+			return
+		}
+		var rec notify.Record
+		if err := doc.DataTo(&rec); err != nil {
+			log.Printf("decode error: %v", err)
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, rec)
+	}
+	slices.SortFunc(out, func(a, b notify.Record) int { return b.Created.Compare(a.Created) })
+	writeJSON(w, http.StatusOK, map[string]any{"notifications": out})
+}
+
+// handleNotificationPreview serves /notifications/preview: it renders the
+// template a notification of the given event type would use on a channel,
+// or an inline template, against a stored alert and optionally one of its
+// actions. Nothing is sent.
+func handleNotificationPreview(w http.ResponseWriter, r *http.Request) {
+	// paths: /notifications/preview [POST]
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	var body struct {
+		AlertID  string `json:"alert_id"`
+		ActionID string `json:"action_id"`
+		Event    string `json:"event"`
+		Channel  string `json:"channel"`
+		Template string `json:"template"` // inline, instead of the configured one
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AlertID == "" || body.Event == "" {
+		http.Error(w, "bad request: alert_id and event are required", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(notify.Events, body.Event) {
+		http.Error(w, fmt.Sprintf("bad request: unknown event %q", body.Event), http.StatusBadRequest)
+		return
+	}
+
+	doc, err := fsClient.Collection(alertsCol).Doc(body.AlertID).Get(ctx)
+	if err != nil {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	var a alertDoc
+	if err := doc.DataTo(&a); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+	a.AlertID = body.AlertID
+	m := alertMessage(a, body.Event, "(built-in message)")
+	if body.ActionID != "" {
+		doc, err := fsClient.Collection(actionsCol).Doc(body.ActionID).Get(ctx)
+		if err != nil {
+			http.Error(w, "action not found", http.StatusNotFound)
+			return
+		}
+		var ad actionDoc
+		if err := doc.DataTo(&ad); err != nil {
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		alert := m.Alert
+		m = actionMessage(ad, body.Event, m.Text)
+		m.Alert = alert
+	}
+
+	var tmpl, title, text string
+	if body.Template != "" {
+		t, perr := notify.ParseTemplate("inline", body.Template)
+		if perr != nil {
+			http.Error(w, "bad request: "+perr.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl = "inline"
+		title, text, err = notify.Render(t, notify.DataFor(m))
+		if title == "" {
+			title = m.Subject()
+		}
+	} else {
+		if body.Channel == "" {
+			http.Error(w, "bad request: channel or template is required", http.StatusBadRequest)
+			return
+		}
+		tmpl, title, text, err = notifier.Render(m, body.Channel)
+	}
+	if err != nil {
+		http.Error(w, "render error: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"template": tmpl, "title": title, "text": text})
+}
+
+// actionMessage is a notification about ad.
+func actionMessage(ad actionDoc, event, text string) notify.Message {
+	r := notify.ActionRecord{
+		AlertID:           ad.AlertID,
+		ActionID:          ad.ActionID,
+		Name:              ad.ProposedAction,
+		Status:            ad.Status,
+		Simulation:        ad.Simulation,
+		Details:           ad.Details,
+		Approvals:         ad.Approvals,
+		ApprovalsRequired: ad.ApprovalsRequired,
+		Deadline:          ad.ApprovalDeadline,
+		Guardrail:         ad.Guardrail,
+		LastError:         ad.LastError,
+		RollbackOf:        ad.RollbackOf,
+	}
+	if ad.Result != nil {
+		r.Summary = ad.Result.Summary
+	}
+	return notify.ActionMessage(r, event, text)
+}
+
+// alertMessage is a notification about a, routed on its event and triage
+// fields.
+func alertMessage(a alertDoc, event, text string) notify.Message {
+	f := match.EventFields(a.Event)
+	f["alert_id"], f["severity"], f["fingerprint"] = a.AlertID, string(a.Triage.Severity), a.Fingerprint
+	m := notify.ForAlert(event, f, text)
+	m.Alert = alertInfo(a)
+	return m
+}
+
+// alertInfo is a as notification templates see it.
+func alertInfo(a alertDoc) *notify.Alert {
+	t := a.Triage
+	out := &notify.Alert{
+		AlertID: a.AlertID,
+		Event:   a.Event,
+		Triage: notify.Triage{
+			Severity:     string(t.Severity),
+			Confidence:   t.Confidence,
+			ReasonTokens: t.ReasonTokens,
+			IntelMatches: t.IntelMatches,
+			ChangeWindow: t.ChangeWindow,
+			ChangeFreeze: t.ChangeFreeze,
+		},
+		Status:      a.Status,
+		Fingerprint: a.Fingerprint,
+		Occurrences: a.Occurrences,
+		IncidentID:  a.IncidentID,
+		Detection:   a.Detection,
+	}
+	if t.Anomaly != nil {
+		out.Triage.Anomaly = *t.Anomaly
+	}
+	return out
+}
+
+// notifyTransition tells paging channels an alert moved to status to by
+// hand: it was acknowledged, closed or reopened. Other statuses send
+// nothing.
+func notifyTransition(ctx context.Context, id, to, by, reason string) {
+	var event, verb string
+	switch to {
+	case lifecycle.StatusAcknowledged, lifecycle.StatusInProgress:
+		event, verb = notify.EventAlertAcknowledged, "acknowledged"
+	case lifecycle.StatusResolved, lifecycle.StatusFalsePositive, lifecycle.StatusSuppressed, lifecycle.StatusRejected:
+		event, verb = notify.EventAlertResolved, "closed as "+to
+	case lifecycle.StatusTriaged:
+		event, verb = notify.EventAlertOpened, "reopened"
+	default:
+		return
+	}
+	doc, err := fsClient.Collection(alertsCol).Doc(id).Get(ctx)
+	if err != nil {
+		log.Printf("firestore alert %s read error: %v", id, err)
+		return
+	}
+	var a alertDoc
+	if err := doc.DataTo(&a); err != nil {
+		log.Printf("decode alert %s: %v", id, err)
+		return
+	}
+	a.AlertID = id
+	text := fmt.Sprintf("Alert `%s` %s by %s", id, verb, by)
+	if reason != "" {
+		text += ": " + reason
+	}
+	notifier.Notify(ctx, alertMessage(a, event, text))
+}
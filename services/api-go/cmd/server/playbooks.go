@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/playbook"
+)
+
+// handleListPlaybookRuns serves GET /playbook-runs[?alert_id=ID&limit=N],
+// newest first.
+func handleListPlaybookRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if n, err := strconv.Atoi(q); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	q := fsClient.Collection(runsCol).OrderBy("created", firestore.Desc).Limit(limit)
+	if alertID := r.URL.Query().Get("alert_id"); alertID != "" {
+		// an alert has few runs; filter without needing a composite index
+		q = fsClient.Collection(runsCol).Where("alert_id", "==", alertID).Limit(limit)
+	}
+	iter := q.Documents(ctx)
+	out := []playbook.Run{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("firestore list playbook runs error: %v", err)
+			http.Error(w, "firestore error", http.StatusInternalServerError)
+			return
+		}
+		var run playbook.Run
+		if err := doc.DataTo(&run); err != nil {
+			log.Printf("decode error: %v", err)
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, run)
+	}
+	slices.SortFunc(out, func(a, b playbook.Run) int { return b.Created.Compare(a.Created) })
+	writeJSON(w, http.StatusOK, map[string]any{"runs": out})
+}
+
+func handlePlaybookRunByID(w http.ResponseWriter, r *http.Request) {
+	// paths: /playbook-runs/{id} [GET]
+	id := strings.TrimPrefix(r.URL.Path, "/playbook-runs/")
+	if id == "" || strings.Contains(id, "/") || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	doc, err := fsClient.Collection(runsCol).Doc(id).Get(r.Context())
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var run playbook.Run
+	if err := doc.DataTo(&run); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
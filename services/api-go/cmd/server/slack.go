@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/approval"
+	"github.com/jinishshah00/sentinelflow/internal/shared/notify"
+)
+
+// slackMaxSkew is how old a signed Slack request may be before it is
+// treated as a replay.
+const slackMaxSkew = 5 * time.Minute
+
+// slackInteraction is the part of a Block Kit interaction payload we use.
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+	Message     struct {
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// handleSlackInteractivity serves /slack/interactivity, the request URL of
+// the Slack app's interactivity settings. It is authenticated by Slack's
+// request signature rather than the API key. Slack gives up on a request
+// after three seconds, so a verified interaction is acknowledged at once and
+// handled in the background by slackInteract.
+func handleSlackInteractivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if slackSigningSecret == "" {
+		http.Error(w, "slack interactivity not configured", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := verifySlack(r.Header, body, time.Now()); err != nil {
+		log.Printf("slack interactivity rejected: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var p slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &p); err != nil {
+		http.Error(w, "bad request: payload", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if p.Type != "block_actions" || len(p.Actions) == 0 {
+		return
+	}
+	go slackInteract(context.WithoutCancel(r.Context()), p)
+}
+
+// slackInteract runs an Approve or Reject button: the same flow as
+// /actions/{id}/approve or /actions/{id}/reject as the approver the clicking
+// Slack user is mapped to. It then rewrites the original message with the
+// outcome, or tells only the clicker why nothing happened.
+func slackInteract(ctx context.Context, p slackInteraction) {
+	by, ok := approvalPolicies.SlackIdentity(p.User.ID)
+	if !ok {
+		log.Printf("slack user %s (%s) is not mapped to an approver", p.User.ID, p.User.Username)
+		respondSlack(ctx, p.ResponseURL, map[string]any{
+			"response_type":    "ephemeral",
+			"replace_original": false,
+			"text":             fmt.Sprintf(":no_entry_sign: Your Slack user (%s) is not mapped to an approver; ask an admin to add it to `slack_users`.", p.User.ID),
+		})
+		return
+	}
+
+	act := p.Actions[0]
+	var (
+		note    string
+		buttons []notify.Button // kept while more approvals are needed
+		err     error
+	)
+	switch act.ActionID {
+	case notify.ButtonApprove:
+		note, buttons, err = slackApprove(ctx, act.Value, by)
+	case notify.ButtonReject:
+		note, err = slackReject(ctx, act.Value, by)
+	default:
+		return
+	}
+	if err != nil {
+		// leave the buttons for someone else; tell only the clicker
+		respondSlack(ctx, p.ResponseURL, map[string]any{
+			"response_type":    "ephemeral",
+			"replace_original": false,
+			"text":             ":warning: " + err.Error(),
+		})
+		return
+	}
+	respondSlack(ctx, p.ResponseURL, map[string]any{
+		"replace_original": true,
+		"text":             p.Message.Text + "\n" + note,
+		"blocks":           notify.SlackBlocks(p.Message.Text, note, buttons),
+	})
+}
+
+// slackApprove adds by's approval to the action, releasing it when the
+// quorum is met. Policy violations and stale buttons come back as errors
+// for the clicker.
+func slackApprove(ctx context.Context, actionID, by string) (string, []notify.Button, error) {
+	ref := fsClient.Collection(actionsCol).Doc(actionID)
+	if _, err := ref.Get(ctx); err != nil {
+		return "", nil, fmt.Errorf("action %s not found", actionID)
+	}
+	ad, changed, err := approveAction(ctx, ref, by, "approved in Slack")
+	if errors.Is(err, approval.ErrSelfApproval) || errors.Is(err, approval.ErrNotApprover) || errors.Is(err, approval.ErrAlreadyApproved) {
+		return "", nil, err
+	}
+	if err != nil {
+		log.Printf("slack approve action %s error: %v", actionID, err)
+		return "", nil, fmt.Errorf("could not record the approval; try again")
+	}
+	if !changed {
+		return "", nil, fmt.Errorf("*%s* is no longer awaiting approval (%s)", ad.ProposedAction, ad.Status)
+	}
+	log.Printf("action %s approved in Slack by %s", ad.ActionID, by)
+	if err := releaseApproval(ctx, ad, by); err != nil {
+		// the approval stands; the actions-go sweeper enqueues it
+		log.Printf("publish action %s error: %v", ad.ActionID, err)
+		return fmt.Sprintf(":white_check_mark: Approved by %s; queued for execution", by), nil, nil
+	}
+	if ad.Status != actionApproved {
+		note := fmt.Sprintf(":ballot_box_with_check: Approved by %s (%d/%d approvals)", by, len(ad.Approvals), ad.ApprovalsRequired)
+		return note, notify.ApprovalButtons(ad.ActionID), nil
+	}
+	return fmt.Sprintf(":white_check_mark: Approved by %s; executing", by), nil, nil
+}
+
+// slackReject rejects the action the button belongs to, as
+// /actions/{id}/reject does.
+func slackReject(ctx context.Context, actionID, by string) (string, error) {
+	ref := fsClient.Collection(actionsCol).Doc(actionID)
+	if _, err := ref.Get(ctx); err != nil {
+		return "", fmt.Errorf("action %s not found", actionID)
+	}
+	ad, _, err := rejectAction(ctx, ref, by, "rejected in Slack")
+	switch {
+	case errors.Is(err, errActionNotPending):
+		return "", fmt.Errorf("*%s* is no longer awaiting approval (%s)", ad.ProposedAction, ad.Status)
+	case err != nil:
+		return "", fmt.Errorf("could not record the rejection; try again")
+	}
+	return fmt.Sprintf(":no_entry: Rejected by %s", by), nil
+}
+
+// verifySlack checks Slack's v0 request signature and that the request is
+// recent: X-Slack-Signature is "v0=" + hex(HMAC-SHA256(signing secret,
+// "v0:" + X-Slack-Request-Timestamp + ":" + body)).
+func verifySlack(h http.Header, body []byte, now time.Time) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp %q", ts)
+	}
+	if skew := now.Sub(time.Unix(sec, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return fmt.Errorf("timestamp %s outside %s", ts, slackMaxSkew)
+	}
+	mac := hmac.New(sha256.New, []byte(slackSigningSecret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(h.Get("X-Slack-Signature"))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// respondSlack posts to an interaction's response_url. Failures are logged
+// only.
+func respondSlack(ctx context.Context, responseURL string, body any) {
+	if !strings.HasPrefix(responseURL, "https://hooks.slack.com/") {
+		log.Printf("slack response_url %q ignored", responseURL)
+		return
+	}
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("slack response error: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("slack response: %s", resp.Status)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySlack(t *testing.T) {
+	slackSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+	t.Cleanup(func() { slackSigningSecret = "" })
+	now := time.Unix(1_760_000_000, 0)
+	body := []byte("payload=%7B%22type%22%3A%22block_actions%22%7D")
+
+	sign := func(secret string, ts time.Time, body []byte) http.Header {
+		s := strconv.FormatInt(ts.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + s + ":"))
+		mac.Write(body)
+		h := http.Header{}
+		h.Set("X-Slack-Request-Timestamp", s)
+		h.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return h
+	}
+
+	tests := []struct {
+		name string
+		h    http.Header
+		body []byte
+		ok   bool
+	}{
+		{"good signature", sign(slackSigningSecret, now, body), body, true},
+		{"good signature, slight skew", sign(slackSigningSecret, now.Add(-4*time.Minute), body), body, true},
+		{"wrong secret", sign("another-secret", now, body), body, false},
+		{"tampered body", sign(slackSigningSecret, now, body), []byte("payload=%7B%7D"), false},
+		{"stale timestamp", sign(slackSigningSecret, now.Add(-slackMaxSkew-time.Second), body), body, false},
+		{"future timestamp", sign(slackSigningSecret, now.Add(slackMaxSkew+time.Second), body), body, false},
+		{"no headers", http.Header{}, body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySlack(tt.h, tt.body, now)
+			if (err == nil) != tt.ok {
+				t.Fatalf("verifySlack() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/suppress"
+)
+
+func handleSuppressions(w http.ResponseWriter, r *http.Request) {
+	// paths: /suppressions [GET, POST]
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now().UTC()
+		all := r.URL.Query().Get("include_expired") == "1"
+		iter := fsClient.Collection(suppressionsCol).OrderBy("created", firestore.Desc).Documents(ctx)
+		out := []suppress.Rule{}
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("firestore list suppressions error: %v", err)
+				http.Error(w, "firestore error", http.StatusInternalServerError)
+				return
+			}
+			var s suppress.Rule
+			if err := doc.DataTo(&s); err != nil {
+				log.Printf("decode error: %v", err)
+				continue
+			}
+			if all || s.Active(now) {
+				out = append(out, s)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"suppressions": out})
+
+	case http.MethodPost:
+		var s suppress.Rule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		now := time.Now().UTC()
+		if err := s.Validate(now, suppressionMaxTTL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.ID = uuid.New().String()
+		s.Created, s.Updated = now, now
+		if _, err := fsClient.Collection(suppressionsCol).Doc(s.ID).Set(ctx, s); err != nil {
+			http.Error(w, "firestore write error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("suppression %s created by %s until %s", s.ID, s.Owner, s.Expires.Format(time.RFC3339))
+		writeJSON(w, http.StatusCreated, s)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleSuppressionByID(w http.ResponseWriter, r *http.Request) {
+	// paths: /suppressions/{id} [GET, PUT, DELETE]
+	ctx := r.Context()
+	id := strings.TrimPrefix(r.URL.Path, "/suppressions/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	ref := fsClient.Collection(suppressionsCol).Doc(id)
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var cur suppress.Rule
+	if err := doc.DataTo(&cur); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, cur)
+
+	case http.MethodPut:
+		var s suppress.Rule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		now := time.Now().UTC()
+		if err := s.Validate(now, suppressionMaxTTL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.ID, s.Created, s.Updated = cur.ID, cur.Created, now
+		if _, err := ref.Set(ctx, s); err != nil {
+			http.Error(w, "firestore write error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+
+	case http.MethodDelete:
+		if _, err := ref.Delete(ctx); err != nil {
+			http.Error(w, "firestore delete error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("suppression %s deleted", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
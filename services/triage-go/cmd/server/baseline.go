@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/baseline"
+)
+
+// scoreAndLearn scores the event against the principal and target profiles
+// as they stood before it, then folds the event into both. A redelivered
+// event leaves the profiles as they are.
+func scoreAndLearn(ctx context.Context, ev shared.Event) (baseline.Anomaly, error) {
+	ts := eventTime(ev)
+	var keys []string
+	for _, k := range []string{baseline.PrincipalKey(ev), baseline.TargetKey(ev)} {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return baseline.Anomaly{}, nil
+	}
+
+	col := fsClient.Collection(fsBaselinesCol)
+	refs := make([]*firestore.DocumentRef, len(keys))
+	for i, k := range keys {
+		refs[i] = col.Doc(baseline.DocID(k))
+	}
+
+	var out baseline.Anomaly
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		var scores []baseline.Anomaly
+		now := time.Now().UTC()
+		for i, snap := range snaps {
+			p := baseline.New(keys[i])
+			if snap.Exists() {
+				if err := snap.DataTo(p); err != nil {
+					return err
+				}
+			}
+			scores = append(scores, p.Score(ev, ts, baselineMinEvents))
+			if !p.Observe(ev, ts) {
+				continue
+			}
+			p.Updated = now
+			if err := tx.Set(refs[i], p); err != nil {
+				return err
+			}
+		}
+		out = baseline.Combine(scores...)
+		return nil
+	})
+	return out, err
+}
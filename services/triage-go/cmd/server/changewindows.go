@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/calendar"
+)
+
+// applyCalendar records the change window and freeze, if any, in effect for
+// the event's project when it happened.
+func applyCalendar(ev shared.Event, res *triageResult) {
+	ts, project := eventTime(ev), ev.Field("project")
+	if w, _, ok := changeCalendar.Active(calendar.KindWindow, project, ts); ok {
+		res.ChangeWindow = w.Name
+	}
+	if fr, _, ok := changeCalendar.Active(calendar.KindFreeze, project, ts); ok {
+		res.ChangeFreeze = fr.Name
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/correlate"
+)
+
+// correlateAlert folds the alert into an open incident sharing its principal
+// or target within the correlation window, or opens a new one. Returns the
+// incident ID.
+func correlateAlert(ctx context.Context, alertID string, ev shared.Event, sev shared.Severity) (string, error) {
+	keys := correlate.Keys(ev)
+	if len(keys) == 0 {
+		return "", nil
+	}
+	ts := eventTime(ev)
+
+	col := fsClient.Collection(fsIncidentsCol)
+	var incidentID string
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// only open incidents still active around ts can take the alert;
+		// needs the (status, keys, last_seen) index in infra/firestore.tf
+		q := col.Where("status", "==", correlate.StatusOpen).
+			Where("keys", "array-contains-any", keys).
+			Where("last_seen", ">=", ts.Add(-correlationWindow))
+		docs, err := tx.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+		var cands []*correlate.Incident
+		for _, d := range docs {
+			var inc correlate.Incident
+			if err := d.DataTo(&inc); err != nil {
+				continue
+			}
+			cands = append(cands, &inc)
+		}
+
+		now := time.Now().UTC()
+		inc := correlate.Pick(cands, keys, ts, correlationWindow)
+		if inc == nil {
+			inc = &correlate.Incident{
+				IncidentID: uuid.New().String(),
+				Status:     correlate.StatusOpen,
+				Created:    now,
+			}
+		}
+		inc.Add(alertID, ev.EventType, keys, sev, ts)
+		inc.Updated = now
+		incidentID = inc.IncidentID
+		return tx.Set(col.Doc(inc.IncidentID), inc)
+	})
+	return incidentID, err
+}
+
+func runIncidentCloser(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := closeIdleIncidents(ctx); err != nil {
+				log.Printf("incident close sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func handleIncidentsTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	closed, err := closeIdleIncidents(r.Context())
+	if err != nil {
+		log.Printf("incident close sweep error: %v", err)
+		http.Error(w, "sweep error", http.StatusInternalServerError)
+		return
+	}
+	shared.WriteJSON(w, http.StatusOK, map[string]int{"closed": closed})
+}
+
+// closeIdleIncidents closes open incidents nothing has joined for longer
+// than the correlation window, by wall clock (updated) rather than event
+// time. Each is re-checked in its own transaction so a concurrent join
+// keeps it open.
+func closeIdleIncidents(ctx context.Context) (int, error) {
+	col := fsClient.Collection(fsIncidentsCol)
+	cutoff := time.Now().UTC().Add(-correlationWindow)
+	docs, err := col.Where("status", "==", correlate.StatusOpen).Where("updated", "<", cutoff).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, d := range docs {
+		changed := false
+		err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+			snap, err := tx.Get(d.Ref)
+			if err != nil {
+				return err
+			}
+			var inc correlate.Incident
+			if err := snap.DataTo(&inc); err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			if !inc.Idle(now, correlationWindow) {
+				return nil
+			}
+			changed = true
+			return tx.Update(d.Ref, []firestore.Update{
+				{Path: "status", Value: correlate.StatusClosed},
+				{Path: "updated", Value: now},
+			})
+		})
+		if err != nil {
+			log.Printf("close incident %s: %v", d.Ref.ID, err)
+			continue
+		}
+		if changed {
+			closed++
+		}
+	}
+	return closed, nil
+}
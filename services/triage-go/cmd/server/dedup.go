@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+)
+
+// dedupResult says whether an event folded into an existing open alert.
+type dedupResult struct {
+	AlertID     string
+	Occurrences int
+	Duplicate   bool
+	Escalated   bool
+}
+
+// fingerprintDoc points a fingerprint at the alert currently collecting it.
+type fingerprintDoc struct {
+	Fingerprint string    `firestore:"fingerprint"`
+	AlertID     string    `firestore:"alert_id"`
+	LastSeen    time.Time `firestore:"last_seen"`
+}
+
+// foldedEvent marks an event already counted on an alert, so a Pub/Sub
+// redelivery returns the same alert and count instead of counting it again.
+// It is never reported as escalated again: the first delivery already
+// escalated, and doing it twice re-pages and re-comments downstream. Stored
+// as fingerprints/<fp>/folded_events/<event id>; expire_at drives a
+// Firestore TTL policy.
+type foldedEvent struct {
+	AlertID     string    `firestore:"alert_id"`
+	Occurrences int       `firestore:"occurrences"`
+	ExpireAt    time.Time `firestore:"expire_at"`
+}
+
+// dedupe looks up the open alert for fp. If one was seen within the dedup
+// window, the event is counted on it (escalating severity if higher) and the
+// existing alert ID is returned. Otherwise the event starts a new alert,
+// which the caller writes with createAlert.
+func dedupe(ctx context.Context, fp string, ev shared.Event, sev shared.Severity) (dedupResult, error) {
+	ts := eventTime(ev)
+	fpRef := fsClient.Collection(fsFingerprintsCol).Doc(fp)
+	foldRef := fpRef.Collection("folded_events").Doc(ev.ID)
+	var out dedupResult
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		out = dedupResult{AlertID: ev.ID, Occurrences: 1}
+
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{fpRef, foldRef})
+		if err != nil {
+			return err
+		}
+		if snaps[1].Exists() {
+			// redelivery of an event already folded
+			var prev foldedEvent
+			if err := snaps[1].DataTo(&prev); err != nil {
+				return err
+			}
+			out = dedupResult{AlertID: prev.AlertID, Occurrences: prev.Occurrences, Duplicate: true}
+			return nil
+		}
+		var cur fingerprintDoc
+		if snaps[0].Exists() {
+			if err := snaps[0].DataTo(&cur); err != nil {
+				return err
+			}
+		}
+		if cur.AlertID == "" || cur.AlertID == ev.ID || ts.Sub(cur.LastSeen) > dedupWindow {
+			return nil
+		}
+		alertRef := fsClient.Collection(fsAlertsCol).Doc(cur.AlertID)
+		asnaps, err := tx.GetAll([]*firestore.DocumentRef{alertRef})
+		if err != nil {
+			return err
+		}
+		status, _ := asnaps[0].Data()["status"].(string)
+		if !asnaps[0].Exists() || lifecycle.IsTerminal(status) {
+			return nil
+		}
+		var existing struct {
+			Triage      triageResult `firestore:"triage"`
+			Occurrences int          `firestore:"occurrences"`
+		}
+		if err := asnaps[0].DataTo(&existing); err != nil {
+			return err
+		}
+		out = dedupResult{
+			AlertID:     cur.AlertID,
+			Occurrences: existing.Occurrences + 1,
+			Duplicate:   true,
+			Escalated:   sev.Rank() > existing.Triage.Severity.Rank(),
+		}
+		updates := []firestore.Update{
+			{Path: "occurrences", Value: out.Occurrences},
+			{Path: "last_seen", Value: ts},
+			{Path: "last_event_id", Value: ev.ID},
+		}
+		if out.Escalated {
+			updates = append(updates,
+				firestore.Update{Path: "triage.severity", Value: string(sev)},
+				firestore.Update{Path: "escalated_at", Value: time.Now().UTC()})
+		}
+		if err := tx.Update(alertRef, updates); err != nil {
+			return err
+		}
+		if err := tx.Set(foldRef, foldedEvent{AlertID: out.AlertID, Occurrences: out.Occurrences,
+			ExpireAt: ts.Add(2 * dedupWindow)}); err != nil {
+			return err
+		}
+		return tx.Set(fpRef, fingerprintDoc{Fingerprint: fp, AlertID: out.AlertID, LastSeen: ts})
+	})
+	return out, err
+}
+
+// createAlert writes a new alert and points fp at it in one transaction, so
+// the pointer never names an alert that does not exist. A redelivered first
+// event finds the alert already written and leaves it, and its count, alone.
+func createAlert(ctx context.Context, fp, alertID string, doc map[string]any, ts time.Time) error {
+	alertRef := fsClient.Collection(fsAlertsCol).Doc(alertID)
+	fpRef := fsClient.Collection(fsFingerprintsCol).Doc(fp)
+	return fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{alertRef})
+		if err != nil {
+			return err
+		}
+		if snaps[0].Exists() {
+			return nil
+		}
+		if err := tx.Create(alertRef, doc); err != nil {
+			return err
+		}
+		return tx.Set(fpRef, fingerprintDoc{Fingerprint: fp, AlertID: alertID, LastSeen: ts})
+	})
+}
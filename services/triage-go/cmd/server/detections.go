@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/detect"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+)
+
+// runDetections feeds the event to every stateful rule and emits a synthetic
+// alert for each one that trips. fields carries the event plus triage features
+// for step conditions.
+func runDetections(ctx context.Context, ev shared.Event, fields match.Fields) {
+	ts := eventTime(ev)
+	for _, t := range detections.Thresholds {
+		key, ok := t.Applies(ev)
+		if !ok {
+			continue
+		}
+		f, err := observeThreshold(ctx, t, key, ev, ts)
+		if err != nil {
+			log.Printf("detection %s state error: %v", t.Name, err)
+			continue
+		}
+		if f == nil {
+			continue
+		}
+		desc := fmt.Sprintf("%d %s events for %s=%s within %s (threshold %d)",
+			f.Count, eventTypeOrAny(t.EventType), t.KeyBy, key, time.Duration(t.Window), t.Threshold)
+		emitDetection(ctx, ev, t.Severity, f, desc)
+	}
+
+	for _, sq := range detections.Sequences {
+		key, ok := sq.Applies(ev)
+		if !ok {
+			continue
+		}
+		f, err := advanceSequence(ctx, sq, key, ev, fields, ts)
+		if err != nil {
+			log.Printf("sequence %s state error: %v", sq.Name, err)
+			continue
+		}
+		if f == nil {
+			continue
+		}
+		desc := fmt.Sprintf("sequence %s completed for %s=%s within %s (%d steps)",
+			sq.Name, sq.KeyBy, key, time.Duration(sq.Within), len(sq.Steps))
+		emitDetection(ctx, ev, sq.Severity, f, desc)
+	}
+}
+
+// observeThreshold updates the persisted window for rule/key in a transaction
+// so counts survive restarts and concurrent instances.
+func observeThreshold(ctx context.Context, t detect.Threshold, key string, ev shared.Event, ts time.Time) (*detect.Firing, error) {
+	ref := fsClient.Collection(fsDetectionStateCol).Doc(detect.StateID(t.Name, key))
+	var fired *detect.Firing
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		fired = nil
+		st := detect.WindowState{Rule: t.Name, Key: key}
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if snaps[0].Exists() {
+			if err := snaps[0].DataTo(&st); err != nil {
+				return err
+			}
+		}
+		if f, ok := t.Observe(&st, ev, ts); ok {
+			fired = f
+		}
+		st.Updated = time.Now().UTC()
+		return tx.Set(ref, st)
+	})
+	return fired, err
+}
+
+// advanceSequence moves the persisted partial match for sequence/key.
+func advanceSequence(ctx context.Context, sq detect.Sequence, key string, ev shared.Event, fields match.Fields, ts time.Time) (*detect.Firing, error) {
+	ref := fsClient.Collection(fsDetectionStateCol).Doc(detect.StateID(sq.StateRule(), key))
+	var fired *detect.Firing
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		fired = nil
+		st := detect.SeqState{Rule: sq.Name, Key: key}
+		snaps, err := tx.GetAll([]*firestore.DocumentRef{ref})
+		if err != nil {
+			return err
+		}
+		if snaps[0].Exists() {
+			if err := snaps[0].DataTo(&st); err != nil {
+				return err
+			}
+		}
+		f, ok := sq.Advance(&st, ev, fields, ts)
+		if !ok && len(st.Partials) == 0 && !snaps[0].Exists() {
+			return nil // nothing started; don't write empty state
+		}
+		if ok {
+			fired = f
+		}
+		st.Updated = time.Now().UTC()
+		return tx.Set(ref, st)
+	})
+	return fired, err
+}
+
+// emitDetection stores and publishes a synthetic alert for a firing. The ID
+// is derived from rule, key and firing time so redeliveries stay idempotent.
+func emitDetection(ctx context.Context, trigger shared.Event, sev shared.Severity, f *detect.Firing, desc string) {
+	syn := shared.Event{
+		ID:           fmt.Sprintf("det-%s-%d", detect.StateID(f.Rule, f.Key)[:12], f.At.Unix()),
+		EventType:    "detection." + f.Kind + "." + f.Rule,
+		Principal:    trigger.Principal,
+		Target:       trigger.Target,
+		Network:      trigger.Network,
+		SeverityHint: string(sev),
+		Labels:       []string{"detection", f.Kind, f.Rule},
+		Description:  desc,
+		TS:           f.At,
+	}
+	res := triageResult{
+		Severity:     sev,
+		Confidence:   1,
+		ReasonTokens: []string{f.Rule},
+	}
+	applyCalendar(syn, &res)
+	emit(ctx, syn, res, ruleFields(syn, res), map[string]any{"detection": f})
+}
+
+func eventTime(ev shared.Event) time.Time {
+	if ev.TS.IsZero() {
+		return time.Now().UTC()
+	}
+	return ev.TS
+}
+
+func eventTypeOrAny(t string) string {
+	if t == "" {
+		return "matching"
+	}
+	return t
+}
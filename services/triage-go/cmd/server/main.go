@@ -16,7 +16,14 @@ import (
 	cloudpubsub "cloud.google.com/go/pubsub"
 
 	"github.com/jinishshah00/sentinelflow/internal/shared"
+	"github.com/jinishshah00/sentinelflow/internal/shared/baseline"
+	"github.com/jinishshah00/sentinelflow/internal/shared/calendar"
 	"github.com/jinishshah00/sentinelflow/internal/shared/classifier"
+	"github.com/jinishshah00/sentinelflow/internal/shared/detect"
+	"github.com/jinishshah00/sentinelflow/internal/shared/fingerprint"
+	"github.com/jinishshah00/sentinelflow/internal/shared/intel"
+	"github.com/jinishshah00/sentinelflow/internal/shared/lifecycle"
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
 )
 
 // ---------- helpers ----------
@@ -41,9 +48,13 @@ type pubsubPush struct {
 }
 
 type triageResult struct {
-	Severity     shared.Severity `json:"severity"`
-	Confidence   float64         `json:"confidence"`
-	ReasonTokens []string        `json:"reason_tokens"`
+	Severity     shared.Severity   `json:"severity" firestore:"severity"`
+	Confidence   float64           `json:"confidence" firestore:"confidence"`
+	ReasonTokens []string          `json:"reason_tokens" firestore:"reason_tokens"`
+	IntelMatches []intel.Match     `json:"intel_matches,omitempty" firestore:"intel_matches,omitempty"`
+	Anomaly      *baseline.Anomaly `json:"anomaly,omitempty" firestore:"anomaly,omitempty"`
+	ChangeWindow string            `json:"change_window,omitempty" firestore:"change_window,omitempty"` // calendar window the event fell in
+	ChangeFreeze string            `json:"change_freeze,omitempty" firestore:"change_freeze,omitempty"` // calendar freeze the event fell in
 }
 
 // ---------- globals ----------
@@ -56,6 +67,28 @@ var (
 	fsAlertsCol  string
 	devPull      bool
 	subPull      string
+
+	intelStore        *intel.Store
+	intelEscalateConf int
+
+	fsIncidentsCol     string
+	correlationWindow  time.Duration
+	incidentCloseEvery time.Duration
+
+	detections          detect.Config
+	fsDetectionStateCol string
+
+	fsBaselinesCol    string
+	baselineMinEvents int
+
+	fsSuppressionsCol  string
+	suppressionRefresh time.Duration
+
+	fsFingerprintsCol string
+	fingerprintFields []string
+	dedupWindow       time.Duration
+
+	changeCalendar calendar.Config
 )
 
 func main() {
@@ -67,6 +100,17 @@ func main() {
 	fsAlertsCol = getenv("FIRESTORE_COLLECTION_ALERTS", "alerts")
 	devPull = getenv("DEV_PULL", "") == "1"
 	subPull = getenv("SUBSCRIPTION_PULL", "triage-dev")
+	fsIncidentsCol = getenv("FIRESTORE_COLLECTION_INCIDENTS", "incidents")
+	correlationWindow = must(time.ParseDuration(getenv("CORRELATION_WINDOW", "30m")))
+	incidentCloseEvery = must(time.ParseDuration(getenv("INCIDENT_CLOSE_INTERVAL", "10m")))
+	fsDetectionStateCol = getenv("FIRESTORE_COLLECTION_DETECTION_STATE", "detection_state")
+	fsBaselinesCol = getenv("FIRESTORE_COLLECTION_BASELINES", "baselines")
+	baselineMinEvents = must(strconv.Atoi(getenv("BASELINE_MIN_EVENTS", "20")))
+	fsSuppressionsCol = getenv("FIRESTORE_COLLECTION_SUPPRESSIONS", "suppressions")
+	suppressionRefresh = must(time.ParseDuration(getenv("SUPPRESSION_REFRESH", "30s")))
+	fsFingerprintsCol = getenv("FIRESTORE_COLLECTION_FINGERPRINTS", "fingerprints")
+	fingerprintFields = fingerprint.ParseFields(getenv("FINGERPRINT_FIELDS", ""))
+	dedupWindow = must(time.ParseDuration(getenv("DEDUP_WINDOW", "1h")))
 
 	if projectID == "" {
 		log.Fatal("GOOGLE_CLOUD_PROJECT must be set")
@@ -94,6 +138,34 @@ func main() {
 	nb.Train(train)
 	log.Printf("triage-go: trained on %d labeled events (dir=%s)", len(train), dataDir)
 
+	// threat intel: optional comma-separated STIX (.json) / CSV feeds
+	intelStore = intel.NewStore()
+	intelEscalateConf = must(strconv.Atoi(getenv("INTEL_ESCALATE_CONFIDENCE", "80")))
+	for _, path := range strings.Split(getenv("INTEL_FEEDS", ""), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		n, err := intelStore.LoadFile(path)
+		if err != nil {
+			log.Fatalf("cannot load intel feed %q: %v", path, err)
+		}
+		log.Printf("triage-go: loaded %d indicators from %s", n, path)
+	}
+
+	// stateful detections: built-in defaults unless DETECTIONS_FILE is set
+	detections = detect.DefaultConfig()
+	if path := getenv("DETECTIONS_FILE", ""); path != "" {
+		detections = must(detect.LoadConfig(path))
+	}
+	log.Printf("triage-go: %d threshold and %d sequence detections", len(detections.Thresholds), len(detections.Sequences))
+
+	// change windows and freezes: none unless CALENDAR_FILE is set
+	changeCalendar = calendar.DefaultConfig()
+	if path := getenv("CALENDAR_FILE", ""); path != "" {
+		changeCalendar = must(calendar.LoadConfig(path))
+	}
+
 	// clients
 	fsClient = must(firestore.NewClient(ctx, projectID))
 	pubClient = must(cloudpubsub.NewClient(ctx, projectID))
@@ -117,11 +189,15 @@ func main() {
 	})
 
 	mux.HandleFunc("/pubsub/push", handlePush)
+	mux.HandleFunc("/tasks/incidents", handleIncidentsTask)
 
 	// start optional puller first so it runs alongside the server
 	if devPull {
 		go runPuller(ctx)
 	}
+	if incidentCloseEvery > 0 {
+		go runIncidentCloser(ctx, incidentCloseEvery)
+	}
 
 	// graceful shutdown watcher
 	port := getenv("PORT", "8080")
@@ -198,41 +274,148 @@ func process(ctx context.Context, ev shared.Event) {
 		y = shared.SeverityMedium
 	}
 
-	res := triageResult{Severity: y, Confidence: conf, ReasonTokens: reasons}
+	// threat intel: a confident indicator hit raises severity one level
+	matches := intelStore.Match(ev)
+	for _, m := range matches {
+		if m.Confidence >= intelEscalateConf {
+			y = escalate(y)
+			break
+		}
+	}
+
+	res := triageResult{Severity: y, Confidence: conf, ReasonTokens: reasons, IntelMatches: matches}
+	applyCalendar(ev, &res)
+
+	// behavioral baseline: score against history, then learn from the event
+	anomaly, err := scoreAndLearn(ctx, ev)
+	if err != nil {
+		log.Printf("baseline error: %v", err)
+	} else if anomaly.Score > 0 {
+		res.Anomaly = &anomaly
+	}
+
+	fields := ruleFields(ev, res)
+	if !emit(ctx, ev, res, fields, nil) {
+		return // suppressed: known-benign, keep it out of detections too
+	}
+
+	// stateful detections may raise their own synthetic alerts
+	runDetections(ctx, ev, fields)
+}
+
+// ruleFields exposes the event plus triage features to rule conditions.
+func ruleFields(ev shared.Event, res triageResult) match.Fields {
+	f := match.EventFields(ev)
+	f["severity"] = string(res.Severity)
+	f["confidence"] = fmtFloat(res.Confidence, 3)
+	f["intel_matches"] = strconv.Itoa(len(res.IntelMatches))
+	f["anomaly_score"] = "0"
+	if res.Anomaly != nil {
+		f["anomaly_score"] = fmtFloat(res.Anomaly.Score, 3)
+		f["anomaly_reasons"] = strings.Join(res.Anomaly.Reasons, ",")
+	}
+	f["inside_change_window"] = strconv.FormatBool(res.ChangeWindow != "")
+	f["change_window"] = res.ChangeWindow
+	f["inside_change_freeze"] = strconv.FormatBool(res.ChangeFreeze != "")
+	f["change_freeze"] = res.ChangeFreeze
+	return f
+}
+
+// emit correlates, stores and publishes an alert. extra fields are merged
+// into the alert document (e.g. detection details on synthetic alerts).
+// Events matching an active suppression rule are stored as suppressed and
+// not published; emit then returns false.
+func emit(ctx context.Context, ev shared.Event, res triageResult, fields match.Fields, extra map[string]any) bool {
+	if rule := matchSuppression(ctx, fields); rule != nil {
+		now := time.Now().UTC()
+		doc := lifecycle.Initial(lifecycle.StatusSuppressed, "triage-go", now)
+		doc["alert_id"] = ev.ID
+		doc["event"] = ev
+		doc["triage"] = res
+		doc["suppressed_by"] = rule.ID
+		doc["created"] = now
+		for k, v := range extra {
+			doc[k] = v
+		}
+		if _, err := fsClient.Collection(fsAlertsCol).Doc(ev.ID).Set(ctx, doc); err != nil {
+			log.Printf("firestore set error: %v", err)
+		}
+		log.Printf("suppressed %s by rule %s (%s)", ev.ID, rule.ID, rule.Name)
+		return false
+	}
 
-	// write to Firestore
-	doc := map[string]any{
-		"alert_id": ev.ID,
-		"event":    ev,
-		"triage":   res,
-		"status":   "pending",
-		"created":  time.Now().UTC(),
+	// fingerprint: repeats within the window count on the open alert
+	fp := fingerprint.Compute(fields, fingerprintFields)
+	dd, err := dedupe(ctx, fp, ev, res.Severity)
+	if err != nil {
+		log.Printf("dedup error: %v", err)
+		dd = dedupResult{AlertID: ev.ID, Occurrences: 1}
 	}
-	_, err := fsClient.Collection(fsAlertsCol).Doc(ev.ID).Set(ctx, doc)
+
+	// correlate into an incident (principal/target within window)
+	incidentID, err := correlateAlert(ctx, dd.AlertID, ev, res.Severity)
 	if err != nil {
-		log.Printf("firestore set error: %v", err)
+		log.Printf("correlation error: %v", err)
+	}
+
+	// write to Firestore (repeats were already counted by dedupe)
+	if !dd.Duplicate {
+		ts, now := eventTime(ev), time.Now().UTC()
+		doc := lifecycle.Initial(lifecycle.StatusTriaged, "triage-go", now)
+		doc["alert_id"] = ev.ID
+		doc["event"] = ev
+		doc["triage"] = res
+		doc["fingerprint"] = fp
+		doc["occurrences"] = 1
+		doc["first_seen"] = ts
+		doc["last_seen"] = ts
+		doc["created"] = now
+		if incidentID != "" {
+			doc["incident_id"] = incidentID
+		}
+		for k, v := range extra {
+			doc[k] = v
+		}
+		if err := createAlert(ctx, fp, ev.ID, doc, ts); err != nil {
+			log.Printf("firestore set error: %v", err)
+		}
 	}
 
 	// publish to alerts.triaged
 	payload := map[string]any{
-		"event":  ev,
-		"triage": res,
+		"alert_id":    dd.AlertID,
+		"event":       ev,
+		"triage":      res,
+		"fingerprint": fp,
+		"occurrences": dd.Occurrences,
+		"escalated":   dd.Escalated,
 	}
 	b, _ := json.Marshal(payload)
 	topic := pubClient.Topic(topicTriaged)
 	id, err := topic.Publish(ctx, &cloudpubsub.Message{
 		Data: b,
 		Attributes: map[string]string{
-			"severity":   string(y),
-			"confidence": formatFloat(conf),
-			"source":     "triage-go",
+			"severity":    string(res.Severity),
+			"confidence":  formatFloat(res.Confidence),
+			"source":      "triage-go",
+			"occurrences": strconv.Itoa(dd.Occurrences),
 		},
 	}).Get(ctx)
 	if err != nil {
 		log.Printf("publish triaged error: %v", err)
 	} else {
-		log.Printf("triaged %s -> %s (id=%s) severity=%s conf=%.3f reasons=%v",
-			ev.ID, topicTriaged, id, y, conf, reasons)
+		log.Printf("triaged %s -> %s (id=%s alert=%s occurrences=%d) severity=%s conf=%.3f reasons=%v intel=%d",
+			ev.ID, topicTriaged, id, dd.AlertID, dd.Occurrences, res.Severity, res.Confidence, res.ReasonTokens, len(res.IntelMatches))
+	}
+	return true
+}
+
+func escalate(s shared.Severity) shared.Severity {
+	switch s {
+	case shared.SeverityLow:
+		return shared.SeverityMedium
+	default:
+		return shared.SeverityHigh
 	}
 }
 
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"github.com/jinishshah00/sentinelflow/internal/shared/match"
+	"github.com/jinishshah00/sentinelflow/internal/shared/suppress"
+)
+
+// suppression rules are read from Firestore and cached for suppressionRefresh.
+var (
+	suppressMu     sync.Mutex
+	suppressRules  []suppress.Rule
+	suppressLoaded time.Time
+)
+
+// matchSuppression returns the active rule silencing these fields, if any.
+func matchSuppression(ctx context.Context, f match.Fields) *suppress.Rule {
+	return suppress.First(activeSuppressions(ctx), f, time.Now().UTC())
+}
+
+func activeSuppressions(ctx context.Context) []suppress.Rule {
+	suppressMu.Lock()
+	defer suppressMu.Unlock()
+	if time.Since(suppressLoaded) < suppressionRefresh {
+		return suppressRules
+	}
+
+	now := time.Now().UTC()
+	iter := fsClient.Collection(fsSuppressionsCol).Where("expires", ">", now).Documents(ctx)
+	var rules []suppress.Rule
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			// keep serving the last good set rather than dropping
+			// suppressions, and wait a full refresh before trying again so
+			// an outage is not queried on every event
+			log.Printf("suppressions load error: %v", err)
+			suppressLoaded = now
+			return suppressRules
+		}
+		var r suppress.Rule
+		if err := doc.DataTo(&r); err != nil {
+			log.Printf("suppression %s decode error: %v", doc.Ref.ID, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	suppressRules = rules
+	suppressLoaded = now
+	return suppressRules
+}
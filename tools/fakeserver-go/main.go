@@ -0,0 +1,579 @@
+// fakeserver-go serves the small slice of the IAM, Cloud Storage and Compute
+// REST APIs that actions-go's live executors call, backed by in-memory state,
+// so remediation can be exercised locally without touching a real project.
+//
+//	go run ./tools/fakeserver-go -addr :9099
+//
+//	GCP_IAM_ENDPOINT=http://localhost:9099/ \
+//	GCP_STORAGE_ENDPOINT=http://localhost:9099/storage/v1/ \
+//	GCP_COMPUTE_ENDPOINT=http://localhost:9099/compute/v1/ \
+//	GCP_ENDPOINT_NOAUTH=1 EXECUTOR_MODE=live go run ./services/actions-go/cmd/server
+//
+// It also stands in for the paging services: a pagerduty channel with
+// "url": "http://localhost:9099/v2/enqueue" or an opsgenie channel with
+// "url": "http://localhost:9099" (any key) opens, acknowledges and resolves
+// pages here, keyed by dedup key. A JIRA_FILE with "base_url":
+// "http://localhost:9099" (any token) files issues here, and they can be
+// commented on and transitioned (To Do, In Progress, Done) as in Jira.
+//
+// GET /_state dumps the current state.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type key struct {
+	Name           string `json:"name"`
+	KeyType        string `json:"keyType"`
+	ValidAfterTime string `json:"validAfterTime"`
+	Disabled       bool   `json:"disabled,omitempty"`
+}
+
+type binding struct {
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+}
+
+type bucketPolicy struct {
+	Bindings []binding `json:"bindings"`
+	Etag     string    `json:"etag"`
+}
+
+type tags struct {
+	Items       []string `json:"items,omitempty"`
+	Fingerprint string   `json:"fingerprint"`
+}
+
+type nic struct {
+	Network string `json:"network"`
+}
+
+type instance struct {
+	Name              string `json:"name"`
+	Zone              string `json:"zone"`
+	Tags              tags   `json:"tags"`
+	NetworkInterfaces []nic  `json:"networkInterfaces"`
+}
+
+type firewall struct {
+	Name         string           `json:"name"`
+	Network      string           `json:"network"`
+	Direction    string           `json:"direction"`
+	Priority     int64            `json:"priority"`
+	Denied       []map[string]any `json:"denied,omitempty"`
+	SourceRanges []string         `json:"sourceRanges,omitempty"`
+	TargetTags   []string         `json:"targetTags,omitempty"`
+	Description  string           `json:"description,omitempty"`
+}
+
+type state struct {
+	mu        sync.Mutex
+	Keys      map[string][]*key        `json:"keys"`      // service account name -> keys
+	Buckets   map[string]*bucketPolicy `json:"buckets"`   // bucket -> policy
+	Instances map[string]*instance     `json:"instances"` // project/zone/name -> instance
+	Firewalls map[string]*firewall     `json:"firewalls"` // project/name -> rule
+	Pages     map[string]*page         `json:"pages"`     // pagerduty/<dedup key> or opsgenie/<alias> -> page
+	Issues    map[string]*issue        `json:"issues"`    // Jira key -> issue
+}
+
+// page is an incident opened through the PagerDuty or Opsgenie stub.
+type page struct {
+	Service string           `json:"service"` // pagerduty | opsgenie
+	Status  string           `json:"status"`  // triggered | acknowledged | resolved
+	Summary string           `json:"summary"`
+	Events  []map[string]any `json:"events"` // every request for the page, in order
+}
+
+// issue is a Jira issue filed through the stub.
+type issue struct {
+	Key      string         `json:"key"`
+	Status   string         `json:"status"` // To Do | In Progress | Done
+	Fields   map[string]any `json:"fields"`
+	Comments []any          `json:"comments"`
+}
+
+// jiraTransitions are the stub workflow's transitions by name: where they
+// lead and from which statuses.
+var jiraTransitions = []struct {
+	ID, Name, To string
+	From         []string
+}{
+	{"11", "Start Progress", "In Progress", []string{"To Do"}},
+	{"21", "Done", "Done", []string{"To Do", "In Progress"}},
+	{"31", "Reopen", "To Do", []string{"Done"}},
+}
+
+// seed mirrors the targets used by data/udm-samples.
+func seed() *state {
+	now := time.Now().UTC()
+	sa := "projects/acme-secops/serviceAccounts/ci-deployer@acme-secops.iam.gserviceaccount.com"
+	return &state{
+		Keys: map[string][]*key{sa: {
+			{Name: sa + "/keys/old0001", KeyType: "USER_MANAGED", ValidAfterTime: now.Add(-90 * 24 * time.Hour).Format(time.RFC3339)},
+			{Name: sa + "/keys/new0002", KeyType: "USER_MANAGED", ValidAfterTime: now.Format(time.RFC3339)},
+		}},
+		Buckets: map[string]*bucketPolicy{"site-assets": {
+			Bindings: []binding{
+				{Role: "roles/storage.objectViewer", Members: []string{"allUsers", "projectViewer:acme-prod"}},
+				{Role: "roles/storage.legacyBucketOwner", Members: []string{"projectOwner:acme-prod"}},
+			},
+			Etag: "CAE=",
+		}},
+		Instances: map[string]*instance{"acme-prod/us-central1-a/web-01": {
+			Name:              "web-01",
+			Zone:              "us-central1-a",
+			Tags:              tags{Items: []string{"http-server"}, Fingerprint: "fp-1"},
+			NetworkInterfaces: []nic{{Network: "projects/acme-prod/global/networks/default"}},
+		}},
+		Firewalls: map[string]*firewall{},
+		Pages:     map[string]*page{},
+		Issues:    map[string]*issue{},
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":9099", "listen address")
+	flag.Parse()
+
+	s := seed()
+	mux := http.NewServeMux()
+
+	// IAM
+	mux.HandleFunc("GET /v1/projects/{p}/serviceAccounts/{sa}/keys", s.listKeys)
+	mux.HandleFunc("POST /v1/projects/{p}/serviceAccounts/{sa}/keys/{key}", s.keyAction) // {id}:disable | {id}:enable
+
+	// Cloud Storage
+	mux.HandleFunc("GET /storage/v1/b/{bucket}/iam", s.getBucketPolicy)
+	mux.HandleFunc("PUT /storage/v1/b/{bucket}/iam", s.setBucketPolicy)
+
+	// Compute
+	mux.HandleFunc("GET /compute/v1/projects/{p}/zones/{z}/instances/{i}", s.getInstance)
+	mux.HandleFunc("POST /compute/v1/projects/{p}/zones/{z}/instances/{i}/setTags", s.setTags)
+	mux.HandleFunc("GET /compute/v1/projects/{p}/aggregated/instances", s.aggregatedInstances)
+	mux.HandleFunc("GET /compute/v1/projects/{p}/global/firewalls/{name}", s.getFirewall)
+	mux.HandleFunc("POST /compute/v1/projects/{p}/global/firewalls", s.insertFirewall)
+	mux.HandleFunc("DELETE /compute/v1/projects/{p}/global/firewalls/{name}", s.deleteFirewall)
+	mux.HandleFunc("GET /compute/v1/projects/{p}/zones/{z}/operations/{op}", doneOp)
+	mux.HandleFunc("GET /compute/v1/projects/{p}/global/operations/{op}", doneOp)
+
+	// Paging
+	mux.HandleFunc("POST /v2/enqueue", s.pagerDutyEvent)
+	mux.HandleFunc("POST /v2/alerts", s.opsgenieCreate)
+	mux.HandleFunc("POST /v2/alerts/{alias}/{verb}", s.opsgenieUpdate) // acknowledge | close
+
+	// Jira (REST v2 and v3)
+	mux.HandleFunc("POST /rest/api/{v}/issue", s.jiraCreate)
+	mux.HandleFunc("GET /rest/api/{v}/search", s.jiraSearch)
+	mux.HandleFunc("GET /rest/api/{v}/search/jql", s.jiraSearch)
+	mux.HandleFunc("POST /rest/api/{v}/issue/{key}/comment", s.jiraComment)
+	mux.HandleFunc("GET /rest/api/{v}/issue/{key}/transitions", s.jiraTransitions)
+	mux.HandleFunc("POST /rest/api/{v}/issue/{key}/transitions", s.jiraTransition)
+
+	mux.HandleFunc("GET /_state", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s)
+	})
+
+	log.Printf("fakeserver-go listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, logRequests(mux)))
+}
+
+// ----------- IAM -----------
+func (s *state) listKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := "projects/" + r.PathValue("p") + "/serviceAccounts/" + r.PathValue("sa")
+	keys, ok := s.Keys[name]
+	if !ok {
+		apiError(w, http.StatusNotFound, "service account "+name+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func (s *state) keyAction(w http.ResponseWriter, r *http.Request) {
+	id, verb, ok := strings.Cut(r.PathValue("key"), ":")
+	if !ok || (verb != "disable" && verb != "enable") {
+		apiError(w, http.StatusNotFound, "unknown method")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sa := "projects/" + r.PathValue("p") + "/serviceAccounts/" + r.PathValue("sa")
+	for _, k := range s.Keys[sa] {
+		if k.Name == sa+"/keys/"+id {
+			k.Disabled = verb == "disable"
+			writeJSON(w, http.StatusOK, map[string]any{})
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "key "+id+" not found")
+}
+
+// ----------- Cloud Storage -----------
+func (s *state) getBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.Buckets[r.PathValue("bucket")]
+	if !ok {
+		apiError(w, http.StatusNotFound, "bucket not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *state) setBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	var in bucketPolicy
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.Buckets[r.PathValue("bucket")]
+	if !ok {
+		apiError(w, http.StatusNotFound, "bucket not found")
+		return
+	}
+	if in.Etag != "" && in.Etag != cur.Etag {
+		apiError(w, http.StatusPreconditionFailed, "etag mismatch")
+		return
+	}
+	in.Etag = uuid.NewString()[:8]
+	s.Buckets[r.PathValue("bucket")] = &in
+	writeJSON(w, http.StatusOK, in)
+}
+
+// ----------- Compute -----------
+func (s *state) getInstance(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in, ok := s.Instances[r.PathValue("p")+"/"+r.PathValue("z")+"/"+r.PathValue("i")]
+	if !ok {
+		apiError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, in)
+}
+
+func (s *state) setTags(w http.ResponseWriter, r *http.Request) {
+	var in tags
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.Instances[r.PathValue("p")+"/"+r.PathValue("z")+"/"+r.PathValue("i")]
+	if !ok {
+		apiError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if in.Fingerprint != inst.Tags.Fingerprint {
+		apiError(w, http.StatusPreconditionFailed, "tags fingerprint mismatch")
+		return
+	}
+	inst.Tags = tags{Items: in.Items, Fingerprint: uuid.NewString()[:8]}
+	doneOp(w, r)
+}
+
+func (s *state) aggregatedInstances(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := strings.TrimSpace(strings.TrimPrefix(r.URL.Query().Get("filter"), "name ="))
+	items := map[string]map[string][]*instance{}
+	for k, in := range s.Instances {
+		if strings.HasPrefix(k, r.PathValue("p")+"/") && (name == "" || in.Name == name) {
+			scope := "zones/" + in.Zone
+			if items[scope] == nil {
+				items[scope] = map[string][]*instance{}
+			}
+			items[scope]["instances"] = append(items[scope]["instances"], in)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *state) getFirewall(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fw, ok := s.Firewalls[r.PathValue("p")+"/"+r.PathValue("name")]
+	if !ok {
+		apiError(w, http.StatusNotFound, "firewall not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, fw)
+}
+
+func (s *state) insertFirewall(w http.ResponseWriter, r *http.Request) {
+	var fw firewall
+	if err := json.NewDecoder(r.Body).Decode(&fw); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := r.PathValue("p") + "/" + fw.Name
+	if _, ok := s.Firewalls[k]; ok {
+		apiError(w, http.StatusConflict, "firewall already exists")
+		return
+	}
+	s.Firewalls[k] = &fw
+	doneOp(w, r)
+}
+
+func (s *state) deleteFirewall(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := r.PathValue("p") + "/" + r.PathValue("name")
+	if _, ok := s.Firewalls[k]; !ok {
+		apiError(w, http.StatusNotFound, "firewall not found")
+		return
+	}
+	delete(s.Firewalls, k)
+	doneOp(w, r)
+}
+
+// ----------- Paging -----------
+
+// pagerDutyEvent accepts Events API v2 trigger, acknowledge and resolve
+// events.
+func (s *state) pagerDutyEvent(w http.ResponseWriter, r *http.Request) {
+	var ev map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"status": "invalid event", "message": err.Error()})
+		return
+	}
+	key, _ := ev["dedup_key"].(string)
+	action, _ := ev["event_action"].(string)
+	if rk, _ := ev["routing_key"].(string); rk == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"status": "invalid event", "message": "routing_key is required"})
+		return
+	}
+	if key == "" {
+		key = uuid.NewString()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.Pages["pagerduty/"+key]
+	switch action {
+	case "trigger":
+		payload, _ := ev["payload"].(map[string]any)
+		summary, _ := payload["summary"].(string)
+		// a repeat joins the open page and leaves it acknowledged
+		if p == nil || p.Status == "resolved" {
+			p = &page{Service: "pagerduty", Status: "triggered"}
+			s.Pages["pagerduty/"+key] = p
+		}
+		p.Summary = summary
+	case "acknowledge", "resolve":
+		if p == nil || p.Status == "resolved" {
+			// PagerDuty accepts these and drops them
+			writeJSON(w, http.StatusAccepted, map[string]any{"status": "success", "message": "Event processed", "dedup_key": key})
+			return
+		}
+		p.Status = map[string]string{"acknowledge": "acknowledged", "resolve": "resolved"}[action]
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"status": "invalid event", "message": "unknown event_action " + action})
+		return
+	}
+	p.Events = append(p.Events, ev)
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "success", "message": "Event processed", "dedup_key": key})
+}
+
+// opsgenieCreate opens an alert, or counts a repeat of an open one with
+// the same alias as Opsgenie does.
+func (s *state) opsgenieCreate(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "GenieKey ") {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "Key format is not valid!"})
+		return
+	}
+	var in map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": err.Error()})
+		return
+	}
+	alias, _ := in["alias"].(string)
+	msg, _ := in["message"].(string)
+	if alias == "" {
+		alias = uuid.NewString()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.Pages["opsgenie/"+alias]
+	if p == nil || p.Status == "resolved" {
+		p = &page{Service: "opsgenie", Status: "triggered"}
+		s.Pages["opsgenie/"+alias] = p
+	}
+	p.Summary = msg
+	p.Events = append(p.Events, in)
+	writeJSON(w, http.StatusAccepted, map[string]any{"result": "Request will be processed", "requestId": uuid.NewString()})
+}
+
+func (s *state) opsgenieUpdate(w http.ResponseWriter, r *http.Request) {
+	status := map[string]string{"acknowledge": "acknowledged", "close": "resolved"}[r.PathValue("verb")]
+	if status == "" || r.URL.Query().Get("identifierType") != "alias" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "unsupported request"})
+		return
+	}
+	var in map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&in)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// like Opsgenie, accept requests for unknown aliases and drop them
+	if p, ok := s.Pages["opsgenie/"+r.PathValue("alias")]; ok {
+		p.Status = status
+		p.Events = append(p.Events, map[string]any{"action": r.PathValue("verb"), "body": in})
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"result": "Request will be processed", "requestId": uuid.NewString()})
+}
+
+// ----------- Jira -----------
+
+func jiraAuthorized(r *http.Request) bool {
+	return r.Header.Get("Authorization") != ""
+}
+
+func jiraError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]any{"errorMessages": []string{msg}, "errors": map[string]any{}})
+}
+
+func (s *state) jiraCreate(w http.ResponseWriter, r *http.Request) {
+	if !jiraAuthorized(r) {
+		jiraError(w, http.StatusUnauthorized, "You are not authenticated.")
+		return
+	}
+	var in struct {
+		Fields map[string]any `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		jiraError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	project, _ := in.Fields["project"].(map[string]any)
+	pkey, _ := project["key"].(string)
+	if pkey == "" || in.Fields["summary"] == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errorMessages": []string{}, "errors": map[string]string{"project": "project and summary are required"}})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := fmt.Sprintf("%s-%d", pkey, len(s.Issues)+1)
+	s.Issues[key] = &issue{Key: key, Status: "To Do", Fields: in.Fields, Comments: []any{}}
+	writeJSON(w, http.StatusCreated, map[string]any{"id": strconv.Itoa(10000 + len(s.Issues)), "key": key, "self": "/rest/api/" + r.PathValue("v") + "/issue/" + key})
+}
+
+// jiraSearch understands only the `labels = "x"` queries sentinelflow sends.
+func (s *state) jiraSearch(w http.ResponseWriter, r *http.Request) {
+	label := strings.Trim(strings.TrimSpace(strings.TrimPrefix(r.URL.Query().Get("jql"), "labels =")), `"`)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []map[string]any{}
+	for key, is := range s.Issues {
+		labels, _ := is.Fields["labels"].([]any)
+		if slices.Contains(labels, any(label)) {
+			out = append(out, map[string]any{"key": key})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"issues": out})
+}
+
+func (s *state) jiraComment(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Body any `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		jiraError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	is, ok := s.Issues[r.PathValue("key")]
+	if !ok {
+		jiraError(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+		return
+	}
+	is.Comments = append(is.Comments, in.Body)
+	writeJSON(w, http.StatusCreated, map[string]any{"id": strconv.Itoa(len(is.Comments))})
+}
+
+func (s *state) jiraTransitions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	is, ok := s.Issues[r.PathValue("key")]
+	if !ok {
+		jiraError(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+		return
+	}
+	out := []map[string]any{}
+	for _, t := range jiraTransitions {
+		if slices.Contains(t.From, is.Status) {
+			out = append(out, map[string]any{"id": t.ID, "name": t.Name, "to": map[string]string{"name": t.To}})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"transitions": out})
+}
+
+func (s *state) jiraTransition(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		jiraError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	is, ok := s.Issues[r.PathValue("key")]
+	if !ok {
+		jiraError(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+		return
+	}
+	for _, t := range jiraTransitions {
+		if t.ID == in.Transition.ID && slices.Contains(t.From, is.Status) {
+			is.Status = t.To
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	jiraError(w, http.StatusBadRequest, "Transition id '"+in.Transition.ID+"' is not valid for this issue.")
+}
+
+// doneOp answers every mutation with an already finished operation.
+func doneOp(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"name": "op-" + uuid.NewString()[:8], "status": "DONE"})
+}
+
+// ----------- utils -----------
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// apiError mimics the googleapi error envelope so clients surface the code.
+func apiError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]any{"error": map[string]any{"code": code, "message": msg}})
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
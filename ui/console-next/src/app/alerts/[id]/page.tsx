@@ -1,4 +1,4 @@
-import ApproveButton from "@/components/ApproveButton";
+import ApprovalControls from "@/components/ApprovalControls";
 import { AlertT } from "@/types";
 
 export const dynamic = "force-dynamic";
@@ -27,6 +27,7 @@ export default async function AlertDetail(
   const a = await getAlert(id);
   const labels  = a.event.labels ?? [];
   const reasons = a.triage.reason_tokens ?? [];
+  const history = a.history ?? [];
 
   return (
     <div className="space-y-6">
@@ -47,7 +48,22 @@ export default async function AlertDetail(
       {a.status === "awaiting_approval" && (
         <div className="border rounded-md p-4">
           <div className="mb-2 font-medium">Action required</div>
-          <ApproveButton id={a.alert_id} />
+          <ApprovalControls id={a.alert_id} />
+        </div>
+      )}
+
+      {history.length > 0 && (
+        <div className="border rounded-md p-4">
+          <div className="mb-2 font-medium">History</div>
+          <ul className="text-sm space-y-1">
+            {history.map((t, i) => (
+              <li key={i}>
+                <span className="text-gray-500">{new Date(t.at).toLocaleString()}</span>{" "}
+                {t.from ? `${t.from} → ` : ""}<code>{t.to}</code> by {t.by}
+                {t.reason && <span className="text-gray-600"> — {t.reason}</span>}
+              </li>
+            ))}
+          </ul>
         </div>
       )}
     </div>
@@ -30,6 +30,7 @@ export async function POST(req: NextRequest, ctx: Ctx) {
     headers: {
       "X-API-Key": API_KEY,
       "content-type": req.headers.get("content-type") ?? "application/json",
+      ...(req.headers.get("x-actor") ? { "X-Actor": req.headers.get("x-actor")! } : {}),
     },
     body,
     cache: "no-store",
@@ -0,0 +1,86 @@
+"use client";
+
+import { useEffect, useState, useTransition } from "react";
+
+type Decision = "approve" | "reject" | "request-changes";
+
+export default function ApprovalControls({ id }: { id: string }) {
+  const [pending, start] = useTransition();
+  const [msg, setMsg] = useState<string | null>(null);
+  const [reason, setReason] = useState("");
+  const [actor, setActor] = useState("");
+
+  // approvals are counted per person, so remember who is acting
+  useEffect(() => setActor(localStorage.getItem("sf.actor") ?? ""), []);
+
+  const decide = (d: Decision) => {
+    setMsg(null);
+    if (!actor.trim()) {
+      setMsg("Enter your identity first.");
+      return;
+    }
+    if (d !== "approve" && !reason.trim()) {
+      setMsg("A reason is required.");
+      return;
+    }
+    start(async () => {
+      const res = await fetch(`/api/sf/alerts/${id}/${d}`, {
+        method: "POST",
+        headers: { "content-type": "application/json", "x-actor": actor.trim() },
+        body: JSON.stringify(d === "approve" ? { comment: reason } : { reason }),
+      });
+      if (res.ok) {
+        setMsg("Done. Refreshing…");
+        location.reload();
+      } else {
+        setMsg(`Error: ${res.status} ${await res.text()}`);
+      }
+    });
+  };
+
+  return (
+    <div className="space-y-2">
+      <input
+        value={actor}
+        onChange={(e) => {
+          setActor(e.target.value);
+          localStorage.setItem("sf.actor", e.target.value);
+        }}
+        placeholder="Your identity (e.g. alice@example.com)"
+        className="w-full border rounded p-2 text-sm"
+      />
+      <textarea
+        value={reason}
+        onChange={(e) => setReason(e.target.value)}
+        placeholder="Comment (required to reject or request changes)"
+        className="w-full border rounded p-2 text-sm"
+        rows={2}
+      />
+      <div className="flex items-center gap-3">
+        <button
+          onClick={() => decide("approve")}
+          className="px-3 py-1 rounded bg-blue-600 text-white text-sm disabled:opacity-50"
+          disabled={pending}
+        >
+          Approve
+        </button>
+        <button
+          onClick={() => decide("reject")}
+          className="px-3 py-1 rounded bg-red-600 text-white text-sm disabled:opacity-50"
+          disabled={pending}
+        >
+          Reject
+        </button>
+        <button
+          onClick={() => decide("request-changes")}
+          className="px-3 py-1 rounded border text-sm disabled:opacity-50"
+          disabled={pending}
+        >
+          Request changes
+        </button>
+        {pending && <span className="text-xs text-gray-600">Working…</span>}
+        {msg && <span className="text-xs text-gray-600">{msg}</span>}
+      </div>
+    </div>
+  );
+}
@@ -18,12 +18,34 @@ export interface TriageT {
   reason_tokens?: string[];
 }
 
+export type AlertStatus =
+  | "triaged"
+  | "reviewed"
+  | "awaiting_approval"
+  | "action_executed"
+  | "acknowledged"
+  | "in_progress"
+  | "resolved"
+  | "false_positive"
+  | "suppressed"
+  | "rejected";
+
+export interface TransitionT {
+  from: string;
+  to: AlertStatus;
+  by: string;
+  reason?: string;
+  at: string;
+}
+
 export interface AlertT {
   alert_id: string;
   event: EventT;
   triage: TriageT;
-  status: "pending" | "awaiting_approval" | "action_executed" | "reviewed";
+  status: AlertStatus;
+  history?: TransitionT[];
   created: string;
+  updated?: string;
 }
 
 export interface AlertsResponse {